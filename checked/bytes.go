@@ -20,6 +20,8 @@
 
 package checked
 
+import "sync/atomic"
+
 var (
 	defaultBytesOptions = NewBytesOptions()
 )
@@ -35,6 +37,12 @@ type Bytes interface {
 	Append(value byte)
 	AppendAll(values []byte)
 	Reset(v []byte)
+
+	// Slice returns a read only view of the bytes between start and end
+	// which holds a reference on the bytes until the view is finalized,
+	// writes through the view are rejected. Finalizing the bytes while
+	// views are live is deferred until the last view is finalized.
+	Slice(start, end int) Bytes
 }
 
 type bytesRef struct {
@@ -42,6 +50,10 @@ type bytesRef struct {
 
 	opts  BytesOptions
 	value []byte
+
+	// views is twice the number of live views plus one once the bytes are
+	// finalized, the bytes are released when it drops to exactly one.
+	views int32
 }
 
 // NewBytes returns a new checked byte slice.
@@ -54,10 +66,11 @@ func NewBytes(value []byte, opts BytesOptions) Bytes {
 		value: value,
 	}
 	b.SetFinalizer(b)
+	b.trackCensus("checked.Bytes")
 	// NB(r): Tracking objects causes interface allocation
-	// so avoid if we are not performing any leak detection.
-	if leakDetectionEnabled() {
-		b.TrackObject(b.value)
+	// so avoid if we are not performing leak detection on this object.
+	if sampleLeakDetection() {
+		b.trackObject(b.value)
 	}
 	return b
 }
@@ -76,6 +89,12 @@ func (b *bytesRef) Cap() int {
 	return v
 }
 
+// UncheckedCap returns the capacity without checking the refs, pools use it
+// to size the bytes they hold without taking refs on them.
+func (b *bytesRef) UncheckedCap() int {
+	return cap(b.value)
+}
+
 func (b *bytesRef) Len() int {
 	b.IncReads()
 	v := len(b.value)
@@ -107,12 +126,109 @@ func (b *bytesRef) Reset(v []byte) {
 	b.DecWrites()
 }
 
+func (b *bytesRef) Slice(start, end int) Bytes {
+	b.IncReads()
+	v := b.value[start:end:end]
+	b.DecReads()
+	return newBytesView(b, v)
+}
+
+// Finalize releases the bytes unless views of them are live, in which case
+// the last view finalized releases them.
 func (b *bytesRef) Finalize() {
+	if atomic.AddInt32(&b.views, 1) == 1 {
+		b.release()
+	}
+}
+
+func (b *bytesRef) release() {
+	// Nothing else references the bytes, reset for their next use.
+	atomic.StoreInt32(&b.views, 0)
 	if finalizer := b.opts.Finalizer(); finalizer != nil {
 		finalizer.FinalizeBytes(b)
 	}
 }
 
+// bytesView is a read only view of a sub slice of checked bytes, all the
+// views of the same bytes hold a reference on them. Views are tracked by
+// the ref census and leak detection like the bytes themselves.
+type bytesView struct {
+	RefCount
+
+	parent *bytesRef
+	value  []byte
+}
+
+func newBytesView(parent *bytesRef, value []byte) *bytesView {
+	parent.IncRef()
+	atomic.AddInt32(&parent.views, 2)
+	v := &bytesView{parent: parent, value: value}
+	v.readOnly = true
+	v.SetFinalizer(v)
+	v.trackCensus("checked.BytesView")
+	if sampleLeakDetection() {
+		v.trackObject(v.value)
+	}
+	return v
+}
+
+func (v *bytesView) Get() []byte {
+	v.IncReads()
+	value := v.value
+	v.DecReads()
+	return value
+}
+
+func (v *bytesView) Cap() int {
+	v.IncReads()
+	n := cap(v.value)
+	v.DecReads()
+	return n
+}
+
+func (v *bytesView) Len() int {
+	v.IncReads()
+	n := len(v.value)
+	v.DecReads()
+	return n
+}
+
+func (v *bytesView) Resize(size int) {
+	v.IncWrites()
+	v.DecWrites()
+}
+
+func (v *bytesView) Append(value byte) {
+	v.IncWrites()
+	v.DecWrites()
+}
+
+func (v *bytesView) AppendAll(values []byte) {
+	v.IncWrites()
+	v.DecWrites()
+}
+
+func (v *bytesView) Reset(value []byte) {
+	v.IncWrites()
+	v.DecWrites()
+}
+
+func (v *bytesView) Slice(start, end int) Bytes {
+	v.IncReads()
+	value := v.value[start:end:end]
+	v.DecReads()
+	return newBytesView(v.parent, value)
+}
+
+// Finalize releases the reference the view holds on the bytes, releasing
+// the bytes if they were finalized and this was their last view.
+func (v *bytesView) Finalize() {
+	v.parent.DecRef()
+	if atomic.AddInt32(&v.parent.views, -2) == 1 {
+		v.parent.release()
+	}
+}
+
 type bytesOptions struct {
 	finalizer BytesFinalizer
 }
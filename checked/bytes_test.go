@@ -24,6 +24,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestBytes(t *testing.T) {
@@ -71,3 +72,138 @@ func TestBytes(t *testing.T) {
 	b.Finalize()
 	assert.Equal(t, 1, finalizerCalls)
 }
+
+func TestBytesSlice(t *testing.T) {
+	finalizerCalls := 0
+	b := NewBytes([]byte("segment-id-1-id-2"), NewBytesOptions().SetFinalizer(
+		BytesFinalizerFn(func(finalizing Bytes) {
+			finalizerCalls++
+		})))
+	b.IncRef()
+
+	first := b.Slice(8, 12)
+	second := b.Slice(13, 17)
+	assert.Equal(t, 3, b.NumRef())
+
+	// The owner releasing the bytes leaves them alive for the views.
+	b.DecRef()
+	b.Finalize()
+	assert.Equal(t, 2, b.NumRef())
+	assert.Equal(t, 0, finalizerCalls)
+
+	first.IncRef()
+	assert.Equal(t, []byte("id-1"), first.Get())
+	assert.Equal(t, 4, first.Len())
+	assert.Equal(t, 4, first.Cap())
+
+	nested := first.Slice(3, 4)
+	assert.Equal(t, 3, b.NumRef())
+
+	first.DecRef()
+	first.Finalize()
+	assert.Equal(t, 0, finalizerCalls)
+
+	nested.IncRef()
+	assert.Equal(t, []byte("1"), nested.Get())
+	nested.DecRef()
+	nested.Finalize()
+
+	second.IncRef()
+	assert.Equal(t, []byte("id-2"), second.Get())
+	second.DecRef()
+	assert.Equal(t, 0, finalizerCalls)
+
+	// Finalizing the last view releases the bytes.
+	second.Finalize()
+	assert.Equal(t, 1, finalizerCalls)
+	assert.Equal(t, 0, b.NumRef())
+}
+
+func TestBytesSliceOwnerFinalizesFirst(t *testing.T) {
+	finalizerCalls := 0
+	b := NewBytes([]byte("segment-id-1-id-2"), NewBytesOptions().SetFinalizer(
+		BytesFinalizerFn(func(finalizing Bytes) {
+			finalizerCalls++
+		})))
+	b.IncRef()
+	v := b.Slice(8, 12)
+	b.DecRef()
+	b.Finalize()
+	assert.Equal(t, 0, finalizerCalls)
+
+	v.IncRef()
+	assert.Equal(t, []byte("id-1"), v.Get())
+	v.DecRef()
+	v.Finalize()
+	assert.Equal(t, 1, finalizerCalls)
+
+	// Released bytes are finalized as usual on their next use.
+	b.IncRef()
+	b.DecRef()
+	b.Finalize()
+	assert.Equal(t, 2, finalizerCalls)
+}
+
+func TestBytesSliceViewsFinalizeFirst(t *testing.T) {
+	finalizerCalls := 0
+	b := NewBytes([]byte("segment-id-1-id-2"), NewBytesOptions().SetFinalizer(
+		BytesFinalizerFn(func(finalizing Bytes) {
+			finalizerCalls++
+		})))
+	b.IncRef()
+	v := b.Slice(8, 12)
+	v.IncRef()
+	v.DecRef()
+	v.Finalize()
+	assert.Equal(t, 0, finalizerCalls)
+
+	b.DecRef()
+	b.Finalize()
+	assert.Equal(t, 1, finalizerCalls)
+}
+
+func TestBytesSliceReadOnly(t *testing.T) {
+	var errs []error
+	SetPanicFn(func(e error) {
+		errs = append(errs, e)
+	})
+	defer ResetPanicFn()
+
+	b := NewBytes([]byte("abcdef"), nil)
+	b.IncRef()
+
+	v := b.Slice(0, 3)
+	v.IncRef()
+
+	v.Append('x')
+	v.AppendAll([]byte("xyz"))
+	v.Resize(1)
+	v.Reset([]byte("xyz"))
+
+	require.Equal(t, 4, len(errs))
+	for _, err := range errs {
+		assert.Equal(t, "write to read only: writes=1, ref=1", err.Error())
+	}
+
+	assert.Equal(t, []byte("abc"), v.Get())
+	assert.Equal(t, []byte("abcdef"), b.Get())
+	assert.Equal(t, 0, v.NumWriters())
+}
+
+func TestBytesSliceCensus(t *testing.T) {
+	EnableRefCensus()
+	defer DisableRefCensus()
+
+	b := NewBytes([]byte("abc"), nil)
+	b.IncRef()
+	v := b.Slice(0, 1)
+	v.IncRef()
+
+	assert.Equal(t, 1, censusObjects("checked.Bytes", "TestBytesSliceCensus"))
+	assert.Equal(t, 1, censusObjects("checked.BytesView", "TestBytesSliceCensus"))
+
+	v.DecRef()
+	v.Finalize()
+	b.DecRef()
+	b.Finalize()
+}
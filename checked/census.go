@@ -0,0 +1,201 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package checked
+
+import (
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	defaultRefCensus = false
+
+	// RefCensusProfileName is the name of the runtime/pprof profile of live
+	// refs, it is served by pprof handlers such as pprof.RegisterHandler at
+	// /debug/pprof/checked.refs.
+	RefCensusProfileName = "checked.refs"
+
+	// refCensusSkip skips the census functions and the IncRef frame so the
+	// stacks start at the site which took the first ref.
+	refCensusSkip = 2
+
+	// refCensusUnknownType is the type of objects not tracked while the
+	// census was on.
+	refCensusUnknownType = "unknown"
+
+	maxCensusTypes = 1<<16 - 1
+)
+
+var refCensusFlag = boolFlag(defaultRefCensus)
+
+// census holds the objects with live refs, objects are added when they take
+// their first ref while the census is on and removed when they release
+// their last so they are kept alive by the census while they hold refs.
+var census = struct {
+	sync.Mutex
+	types   []string
+	typeIdx map[string]uint16
+	live    map[*RefCount]censusEntry
+	profile *pprof.Profile
+}{
+	// Type zero is reserved for objects not tracked while the census was on.
+	types:   []string{refCensusUnknownType},
+	typeIdx: make(map[string]uint16),
+	live:    make(map[*RefCount]censusEntry),
+	profile: pprof.NewProfile(RefCensusProfileName),
+}
+
+type censusEntry struct {
+	typ uint16
+	pc  []uintptr
+}
+
+// RefCensusRecord is the number of objects of a type holding live refs which
+// took their first ref from the same site.
+type RefCensusRecord struct {
+	// Type is the type of the objects.
+	Type string `json:"type"`
+
+	// Objects is the number of objects holding live refs.
+	Objects int `json:"objects"`
+
+	// Frames is the stack of the site which took the first ref.
+	Frames []LeakFrame `json:"frames"`
+}
+
+// EnableRefCensus turns the ref census on, objects taking their first ref
+// while it is on are counted by type and by the site which took the ref for
+// as long as they hold live refs. Pooled objects take their first ref where
+// they are taken from the pool so the sites are the holders of the objects.
+// Objects tracked while the census was off are counted as of unknown type.
+func EnableRefCensus() {
+	setFlag(&refCensusFlag, true)
+}
+
+// DisableRefCensus turns the ref census off, objects already counted are
+// removed once they release their last ref.
+func DisableRefCensus() {
+	setFlag(&refCensusFlag, false)
+}
+
+func refCensusEnabled() bool {
+	return flagEnabled(&refCensusFlag)
+}
+
+// RefCensus returns the objects currently holding live refs grouped by type
+// and site, sorted by objects descending.
+func RefCensus() []RefCensusRecord {
+	type censusKey struct {
+		typ  uint16
+		site string
+	}
+
+	var (
+		counts = make(map[censusKey]int)
+		sites  = make(map[censusKey][]uintptr)
+		types  []string
+	)
+
+	census.Lock()
+	for _, entry := range census.live {
+		key := censusKey{typ: entry.typ, site: pcKey(entry.pc)}
+		counts[key]++
+		sites[key] = entry.pc
+	}
+	types = census.types
+	census.Unlock()
+
+	result := make([]RefCensusRecord, 0, len(counts))
+	for key, n := range counts {
+		result = append(result, RefCensusRecord{
+			Type:    types[key.typ],
+			Objects: n,
+			Frames:  leakFrames(sites[key]),
+		})
+	}
+	sort.Sort(refCensusByObjects(result))
+	return result
+}
+
+// refCensusByObjects sorts census records by objects descending then by type.
+type refCensusByObjects []RefCensusRecord
+
+func (x refCensusByObjects) Len() int {
+	return len(x)
+}
+
+func (x refCensusByObjects) Swap(i, j int) {
+	x[i], x[j] = x[j], x[i]
+}
+
+func (x refCensusByObjects) Less(i, j int) bool {
+	if x[i].Objects != x[j].Objects {
+		return x[i].Objects > x[j].Objects
+	}
+	return x[i].Type < x[j].Type
+}
+
+// trackCensus sets the type the object is counted as by the census if the
+// census is on, it must be called before the object is shared.
+func (c *RefCount) trackCensus(typ string) {
+	if !refCensusEnabled() {
+		return
+	}
+
+	census.Lock()
+	idx, ok := census.typeIdx[typ]
+	if !ok && len(census.types) <= maxCensusTypes {
+		idx = uint16(len(census.types))
+		census.types = append(census.types, typ)
+		census.typeIdx[typ] = idx
+	}
+	census.Unlock()
+
+	c.censusType = idx
+}
+
+func (c *RefCount) censusAdd() {
+	pc := make([]uintptr, getTracebackMaxDepth())
+	// Skip the frames of runtime.Callers, censusAdd and IncRef.
+	skipEntry := 3
+	pc = pc[:runtime.Callers(skipEntry, pc)]
+
+	census.Lock()
+	if _, ok := census.live[c]; !ok && c.NumRef() > 0 {
+		census.live[c] = censusEntry{typ: c.censusType, pc: pc}
+		census.profile.Add(c, refCensusSkip)
+		atomic.StoreInt32(&c.censused, 1)
+	}
+	census.Unlock()
+}
+
+func (c *RefCount) censusRemove() {
+	census.Lock()
+	if _, ok := census.live[c]; ok && c.NumRef() == 0 {
+		delete(census.live, c)
+		census.profile.Remove(c)
+		atomic.StoreInt32(&c.censused, 0)
+	}
+	census.Unlock()
+}
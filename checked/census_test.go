@@ -0,0 +1,150 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package checked
+
+import (
+	"bytes"
+	"runtime/pprof"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type censusObject struct {
+	RefCount
+}
+
+func newCensusObject() *censusObject {
+	obj := &censusObject{}
+	obj.TrackObject(obj)
+	return obj
+}
+
+//go:noinline
+func takeCensusRef(obj *censusObject) {
+	obj.IncRef()
+}
+
+//go:noinline
+func takeOtherCensusRef(obj *censusObject) {
+	obj.IncRef()
+}
+
+// censusObjects returns the objects of a type counted by the census at the
+// site whose stack starts with fn, other tests may leave objects holding
+// refs at other sites behind.
+func censusObjects(typ, fn string) int {
+	var result int
+	for _, r := range RefCensus() {
+		if r.Type != typ || len(r.Frames) == 0 {
+			continue
+		}
+		if r.Frames[0].Function == "github.com/m3db/m3x/checked."+fn {
+			result += r.Objects
+		}
+	}
+	return result
+}
+
+func TestRefCensus(t *testing.T) {
+	EnableRefCensus()
+	defer DisableRefCensus()
+
+	profile := pprof.Lookup(RefCensusProfileName)
+	require.NotNil(t, profile)
+	live := profile.Count()
+
+	var objects []*censusObject
+	for i := 0; i < 3; i++ {
+		objects = append(objects, newCensusObject())
+	}
+
+	// Objects are only counted while they hold refs.
+	assert.Equal(t, live, profile.Count())
+
+	// Objects allocated at the same site are counted at the sites which
+	// took their first ref.
+	takeCensusRef(objects[0])
+	takeCensusRef(objects[1])
+	takeOtherCensusRef(objects[2])
+
+	// Further refs of live objects are not counted again.
+	takeOtherCensusRef(objects[0])
+
+	assert.Equal(t, 2, censusObjects("*checked.censusObject", "takeCensusRef"))
+	assert.Equal(t, 1, censusObjects("*checked.censusObject", "takeOtherCensusRef"))
+	assert.Equal(t, live+3, profile.Count())
+
+	var buf bytes.Buffer
+	require.NoError(t, profile.WriteTo(&buf, 1))
+	assert.True(t, strings.HasPrefix(buf.String(), "checked.refs profile: total "))
+	assert.True(t, strings.Contains(buf.String(), "checked.takeCensusRef"))
+	assert.True(t, strings.Contains(buf.String(), "checked.takeOtherCensusRef"))
+
+	// Objects leave the census when they release their last ref.
+	objects[0].DecRef()
+	assert.Equal(t, 2, censusObjects("*checked.censusObject", "takeCensusRef"))
+	for _, obj := range objects {
+		obj.DecRef()
+	}
+	assert.Equal(t, 0, censusObjects("*checked.censusObject", "takeCensusRef"))
+	assert.Equal(t, 0, censusObjects("*checked.censusObject", "takeOtherCensusRef"))
+	assert.Equal(t, live, profile.Count())
+}
+
+func TestRefCensusTrackedBeforeEnabled(t *testing.T) {
+	obj := newCensusObject()
+
+	EnableRefCensus()
+	defer DisableRefCensus()
+
+	// Objects tracked while the census was off are counted without a type.
+	takeCensusRef(obj)
+	assert.Equal(t, 1, censusObjects(refCensusUnknownType, "takeCensusRef"))
+
+	obj.DecRef()
+	assert.Equal(t, 0, censusObjects(refCensusUnknownType, "takeCensusRef"))
+}
+
+func TestRefCensusDisabled(t *testing.T) {
+	profile := pprof.Lookup(RefCensusProfileName)
+	live := profile.Count()
+
+	// Objects taking their first ref while the census is off are not counted.
+	obj := newCensusObject()
+	takeCensusRef(obj)
+	assert.Equal(t, live, profile.Count())
+	assert.Equal(t, uint16(0), obj.censusType)
+	obj.DecRef()
+
+	// Objects counted before the census was turned off are removed once
+	// they release their last ref.
+	EnableRefCensus()
+	obj = newCensusObject()
+	takeCensusRef(obj)
+	DisableRefCensus()
+	assert.Equal(t, live+1, profile.Count())
+
+	obj.DecRef()
+	assert.Equal(t, live, profile.Count())
+}
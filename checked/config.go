@@ -0,0 +1,189 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package checked
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/m3db/m3x/instrument"
+)
+
+// PanicMode is how invalid checked state is reported.
+type PanicMode int
+
+const (
+	// PanicOnError panics on invalid checked state.
+	PanicOnError PanicMode = iota
+
+	// LogOnError logs invalid checked state and counts it with the
+	// checked-errors counter instead of panicking.
+	LogOnError
+
+	// DefaultPanicMode is the default panic mode.
+	DefaultPanicMode = PanicOnError
+)
+
+var validPanicModes = []PanicMode{
+	PanicOnError,
+	LogOnError,
+}
+
+func (m PanicMode) String() string {
+	switch m {
+	case PanicOnError:
+		return "panic"
+	case LogOnError:
+		return "log"
+	}
+	return "unknown"
+}
+
+// UnmarshalYAML unmarshals a PanicMode into a valid mode from string.
+func (m *PanicMode) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var str string
+	if err := unmarshal(&str); err != nil {
+		return err
+	}
+	if str == "" {
+		*m = DefaultPanicMode
+		return nil
+	}
+	strs := make([]string, 0, len(validPanicModes))
+	for _, valid := range validPanicModes {
+		if str == valid.String() {
+			*m = valid
+			return nil
+		}
+		strs = append(strs, "'"+valid.String()+"'")
+	}
+	return fmt.Errorf("invalid PanicMode '%s' valid modes are: %s",
+		str, strings.Join(strs, ", "))
+}
+
+// Configuration configures checked debugging, it is process wide.
+type Configuration struct {
+	// The traceback configuration.
+	Tracebacks TracebackConfiguration `yaml:"tracebacks"`
+
+	// The leak detection configuration.
+	LeakDetection LeakDetectionConfiguration `yaml:"leakDetection"`
+
+	// Whether ownership of references taken with IncRefOwned is enforced.
+	Ownership bool `yaml:"ownership"`
+
+	// Whether live refs are counted by type and site, see EnableRefCensus.
+	RefCensus bool `yaml:"refCensus"`
+
+	// How invalid checked state is reported.
+	PanicMode PanicMode `yaml:"panicMode"`
+}
+
+// Apply applies the configuration to the process wide checked debugging,
+// the instrument options are used to report errors in the log panic mode.
+func (c Configuration) Apply(instrumentOpts instrument.Options) {
+	c.Tracebacks.Apply()
+	c.LeakDetection.Apply()
+	if c.Ownership {
+		EnableOwnership()
+	} else {
+		DisableOwnership()
+	}
+	if c.RefCensus {
+		EnableRefCensus()
+	} else {
+		DisableRefCensus()
+	}
+
+	switch c.PanicMode {
+	case LogOnError:
+		var (
+			logger  = instrumentOpts.Logger()
+			counter = instrumentOpts.MetricsScope().Counter("checked-errors")
+		)
+		SetPanicFn(func(e error) {
+			counter.Inc(1)
+			logger.Errorf("invalid checked state: %v", e)
+		})
+	default:
+		ResetPanicFn()
+	}
+}
+
+// TracebackConfiguration configures tracebacks.
+type TracebackConfiguration struct {
+	// Whether tracebacks are collected for events.
+	Enabled bool `yaml:"enabled"`
+
+	// The count of traceback cycles to keep, if zero the default.
+	Cycles int `yaml:"cycles" validate:"min=0"`
+
+	// The max amount of frames to capture, if zero the default.
+	MaxDepth int `yaml:"maxDepth" validate:"min=0"`
+}
+
+// Apply applies the configuration to the process wide tracebacks.
+func (c TracebackConfiguration) Apply() {
+	cycles := defaultTracebackCycles
+	if c.Cycles > 0 {
+		cycles = c.Cycles
+	}
+	SetTracebackCycles(cycles)
+
+	maxDepth := defaultTracebackMaxDepth
+	if c.MaxDepth > 0 {
+		maxDepth = c.MaxDepth
+	}
+	SetTracebackMaxDepth(maxDepth)
+
+	if c.Enabled {
+		EnableTracebacks()
+	} else {
+		DisableTracebacks()
+	}
+}
+
+// LeakDetectionConfiguration configures leak detection.
+type LeakDetectionConfiguration struct {
+	// Whether leak detection is enabled.
+	Enabled bool `yaml:"enabled"`
+
+	// Track one in every sampleEvery objects, if zero or one every object.
+	SampleEvery int `yaml:"sampleEvery" validate:"min=0"`
+
+	// Whether to capture the stack sampled objects are tracked from.
+	CaptureStacks bool `yaml:"captureStacks"`
+}
+
+// Apply applies the configuration to the process wide leak detection.
+func (c LeakDetectionConfiguration) Apply() {
+	SetLeakDetectionSampleEvery(c.SampleEvery)
+	if c.CaptureStacks {
+		EnableLeakDetectionStacks()
+	} else {
+		DisableLeakDetectionStacks()
+	}
+	if c.Enabled {
+		EnableLeakDetection()
+	} else {
+		DisableLeakDetection()
+	}
+}
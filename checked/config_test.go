@@ -0,0 +1,118 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package checked
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/m3db/m3x/config"
+	"github.com/m3db/m3x/instrument"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestConfigurationLoadFile(t *testing.T) {
+	fd, err := ioutil.TempFile("", "checked")
+	require.NoError(t, err)
+	defer os.Remove(fd.Name())
+
+	_, err = fd.WriteString(`
+tracebacks:
+  enabled: true
+  cycles: 5
+  maxDepth: 32
+leakDetection:
+  enabled: true
+  sampleEvery: 1000
+  captureStacks: true
+ownership: true
+panicMode: log
+`)
+	require.NoError(t, err)
+	require.NoError(t, fd.Close())
+
+	var cfg Configuration
+	require.NoError(t, config.LoadFile(&cfg, fd.Name()))
+	assert.Equal(t, Configuration{
+		Tracebacks: TracebackConfiguration{
+			Enabled:  true,
+			Cycles:   5,
+			MaxDepth: 32,
+		},
+		LeakDetection: LeakDetectionConfiguration{
+			Enabled:       true,
+			SampleEvery:   1000,
+			CaptureStacks: true,
+		},
+		Ownership: true,
+		PanicMode: LogOnError,
+	}, cfg)
+}
+
+func TestConfigurationApply(t *testing.T) {
+	scope := tally.NewTestScope("", nil)
+	Configuration{
+		Tracebacks:    TracebackConfiguration{Enabled: true, Cycles: 5, MaxDepth: 32},
+		LeakDetection: LeakDetectionConfiguration{Enabled: true, SampleEvery: 10},
+		Ownership:     true,
+		PanicMode:     LogOnError,
+	}.Apply(instrument.NewOptions().SetMetricsScope(scope))
+	defer Configuration{}.Apply(instrument.NewOptions())
+
+	assert.Equal(t, Toggles{
+		Tracebacks:      true,
+		LeakDetection:   true,
+		LeakSampleEvery: 10,
+		Ownership:       true,
+	}, CurrentToggles())
+	assert.Equal(t, 5, getTracebackCycles())
+	assert.Equal(t, 32, getTracebackMaxDepth())
+
+	assert.NotPanics(t, func() {
+		Panic(errors.New("an error"))
+	})
+	assert.Equal(t, int64(1), scope.Snapshot().Counters()["checked-errors+"].Value())
+
+	Configuration{}.Apply(instrument.NewOptions())
+	assert.Equal(t, Toggles{LeakSampleEvery: 1}, CurrentToggles())
+	assert.Equal(t, defaultTracebackCycles, getTracebackCycles())
+	assert.Panics(t, func() {
+		Panic(errors.New("an error"))
+	})
+}
+
+func TestConfigurationInvalidPanicMode(t *testing.T) {
+	fd, err := ioutil.TempFile("", "checked")
+	require.NoError(t, err)
+	defer os.Remove(fd.Name())
+
+	_, err = fd.WriteString("panicMode: ignore\n")
+	require.NoError(t, err)
+	require.NoError(t, fd.Close())
+
+	var cfg Configuration
+	assert.Error(t, config.LoadFile(&cfg, fd.Name()))
+}
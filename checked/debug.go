@@ -25,6 +25,7 @@ import (
 	"fmt"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -33,16 +34,40 @@ const (
 	defaultTracebackCycles   = 3
 	defaultTracebackMaxDepth = 64
 	defaultLeakDetection     = false
+	defaultLeakSampleEvery   = 1
+	defaultLeakStacks        = false
 )
 
+// The settings below are read on every checked operation and may be changed
+// at any time, for instance through the toggles handler, so they are only
+// accessed atomically.
 var (
-	traceback         = defaultTraceback
-	tracebackCycles   = defaultTracebackCycles
-	tracebackMaxDepth = defaultTracebackMaxDepth
-	panicFn           = defaultPanic
-	leakDetectionFlag = defaultLeakDetection
+	traceback         = boolFlag(defaultTraceback)
+	tracebackCycles   = int64(defaultTracebackCycles)
+	tracebackMaxDepth = int64(defaultTracebackMaxDepth)
+	panicFn           atomic.Value
+	leakDetectionFlag = boolFlag(defaultLeakDetection)
+
+	leakDetectionSampleEvery = uint64(defaultLeakSampleEvery)
+	leakDetectionSampled     uint64
+	leakDetectionStacks      = boolFlag(defaultLeakStacks)
 )
 
+func boolFlag(value bool) int32 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+func setFlag(flag *int32, value bool) {
+	atomic.StoreInt32(flag, boolFlag(value))
+}
+
+func flagEnabled(flag *int32) bool {
+	return atomic.LoadInt32(flag) == 1
+}
+
 var tracebackCallersPool = sync.Pool{New: func() interface{} {
 	// Pools should generally only return pointer types, since a pointer
 	// can be put into the return interface value without an allocation.
@@ -50,83 +75,111 @@ var tracebackCallersPool = sync.Pool{New: func() interface{} {
 	// tradeoff of greater code clarity by putting slices directly into the
 	// pool at the cost of an additional allocation of the three words which
 	// comprise the slice on each put.
-	return make([]uintptr, tracebackMaxDepth)
+	return make([]uintptr, getTracebackMaxDepth())
 }}
 
 var tracebackEntryPool = sync.Pool{New: func() interface{} {
 	return &debuggerEntry{}
 }}
 
-var leaks struct {
-	sync.RWMutex
-	m map[string]uint64
-}
-
 // PanicFn is a panic function to call on invalid checked state
 type PanicFn func(e error)
 
 // SetPanicFn sets the panic function
 func SetPanicFn(fn PanicFn) {
-	panicFn = fn
+	panicFn.Store(fn)
 }
 
 // Panic will execute the currently set panic function
 func Panic(e error) {
-	panicFn(e)
+	getPanicFn()(e)
 }
 
 // ResetPanicFn resets the panic function to the default runtime panic
 func ResetPanicFn() {
-	panicFn = defaultPanic
+	SetPanicFn(defaultPanic)
+}
+
+func getPanicFn() PanicFn {
+	return panicFn.Load().(PanicFn)
 }
 
 // EnableTracebacks turns traceback collection for events on
 func EnableTracebacks() {
-	traceback = true
+	setFlag(&traceback, true)
 }
 
 // DisableTracebacks turns traceback collection for events off
 func DisableTracebacks() {
-	traceback = false
+	setFlag(&traceback, false)
+}
+
+func tracebacksEnabled() bool {
+	return flagEnabled(&traceback)
 }
 
 // SetTracebackCycles sets the count of traceback cycles to keep if enabled
 func SetTracebackCycles(value int) {
-	tracebackCycles = value
+	atomic.StoreInt64(&tracebackCycles, int64(value))
+}
+
+func getTracebackCycles() int {
+	return int(atomic.LoadInt64(&tracebackCycles))
 }
 
 // SetTracebackMaxDepth sets the max amount of frames to capture for traceback
 func SetTracebackMaxDepth(frames int) {
-	tracebackMaxDepth = frames
+	atomic.StoreInt64(&tracebackMaxDepth, int64(frames))
+}
+
+func getTracebackMaxDepth() int {
+	return int(atomic.LoadInt64(&tracebackMaxDepth))
 }
 
 // EnableLeakDetection turns leak detection on.
 func EnableLeakDetection() {
-	leakDetectionFlag = true
+	setFlag(&leakDetectionFlag, true)
 }
 
 // DisableLeakDetection turns leak detection off.
 func DisableLeakDetection() {
-	leakDetectionFlag = false
+	setFlag(&leakDetectionFlag, false)
 }
 
-func leakDetectionEnabled() bool {
-	return leakDetectionFlag
+// SetLeakDetectionSampleEvery sets leak detection to track only one in every
+// n objects, which makes it cheap enough to leave on in production. Leaks
+// are reported for the sampled objects only. If n is one or less every
+// object is tracked.
+func SetLeakDetectionSampleEvery(n int) {
+	if n < 1 {
+		n = 1
+	}
+	atomic.StoreUint64(&leakDetectionSampleEvery, uint64(n))
 }
 
-// DumpLeaks returns all detected leaks so far.
-func DumpLeaks() []string {
-	var r []string
+// EnableLeakDetectionStacks turns capturing the stack objects are tracked
+// from on, stacks are only captured for sampled objects.
+func EnableLeakDetectionStacks() {
+	setFlag(&leakDetectionStacks, true)
+}
 
-	leaks.RLock()
+// DisableLeakDetectionStacks turns capturing the stack objects are tracked
+// from off.
+func DisableLeakDetectionStacks() {
+	setFlag(&leakDetectionStacks, false)
+}
 
-	for k, v := range leaks.m {
-		r = append(r, fmt.Sprintf("leaked %d bytes, origin:\n%s", v, k))
+// sampleLeakDetection returns whether leak detection is enabled and the next
+// object should be tracked.
+func sampleLeakDetection() bool {
+	if !flagEnabled(&leakDetectionFlag) {
+		return false
 	}
-
-	leaks.RUnlock()
-
-	return r
+	every := atomic.LoadUint64(&leakDetectionSampleEvery)
+	if every <= 1 {
+		return true
+	}
+	return atomic.AddUint64(&leakDetectionSampled, 1)%every == 0
 }
 
 func defaultPanic(e error) {
@@ -134,12 +187,12 @@ func defaultPanic(e error) {
 }
 
 func panicRef(c *RefCount, err error) {
-	if traceback {
+	if tracebacksEnabled() {
 		trace := getDebuggerRef(c).String()
 		err = fmt.Errorf("%v, traceback:\n\n%s", err, trace)
 	}
 
-	panicFn(err)
+	getPanicFn()(err)
 }
 
 type debuggerEvent int
@@ -183,9 +236,10 @@ type debugger struct {
 }
 
 func (d *debugger) append(event debuggerEvent, ref int, pc []uintptr) {
+	cycles := getTracebackCycles()
 	d.Lock()
 	if len(d.entries) == 0 {
-		d.entries = make([][]*debuggerEntry, 1, tracebackCycles)
+		d.entries = make([][]*debuggerEntry, 1, cycles)
 	}
 	idx := len(d.entries) - 1
 	entry := tracebackEntryPool.Get().(*debuggerEntry)
@@ -195,7 +249,8 @@ func (d *debugger) append(event debuggerEvent, ref int, pc []uintptr) {
 	entry.t = time.Now()
 	d.entries[idx] = append(d.entries[idx], entry)
 	if event == finalizeEvent {
-		if len(d.entries) == tracebackCycles {
+		// The cycles may have changed since the entries were allocated.
+		if len(d.entries) >= cycles || len(d.entries) == cap(d.entries) {
 			// Shift all tracebacks back one if at end of traceback cycles
 			slice := d.entries[0]
 			for i, entry := range slice {
@@ -294,12 +349,12 @@ func getDebuggerRef(c *RefCount) *debuggerRef {
 }
 
 func tracebackEvent(c *RefCount, ref int, e debuggerEvent) {
-	if !traceback {
+	if !tracebacksEnabled() {
 		return
 	}
 
 	d := getDebuggerRef(c)
-	depth := tracebackMaxDepth
+	depth := getTracebackMaxDepth()
 	pc := tracebackCallersPool.Get().([]uintptr)
 	if capacity := cap(pc); capacity < depth {
 		// Defensive programming here in case someone changes
@@ -313,5 +368,6 @@ func tracebackEvent(c *RefCount, ref int, e debuggerEvent) {
 }
 
 func init() {
-	leaks.m = make(map[string]uint64)
+	ResetPanicFn()
+	leaks.m = make(map[string]*LeakRecord)
 }
@@ -0,0 +1,191 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build ignore
+// +build ignore
+
+// gen_slices generates the checked slices in slices_gen.go, run it with
+// go generate after changing the element types below.
+package main
+
+import (
+	"bytes"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"text/template"
+)
+
+type slice struct {
+	Name  string
+	Ref   string
+	Elem  string
+	Clear bool
+	Zero  string
+}
+
+// Slices whose elements hold references are cleared before they are pooled.
+var slices = []slice{
+	{Name: "Int64s", Ref: "int64sRef", Elem: "int64"},
+	{Name: "Uint64s", Ref: "uint64sRef", Elem: "uint64"},
+	{Name: "Ints", Ref: "intsRef", Elem: "int"},
+	{Name: "Strings", Ref: "stringsRef", Elem: "string", Clear: true, Zero: `""`},
+	{Name: "Times", Ref: "timesRef", Elem: "time.Time", Clear: true, Zero: "time.Time{}"},
+}
+
+func main() {
+	var buf bytes.Buffer
+	if err := slicesTemplate.Execute(&buf, slices); err != nil {
+		log.Fatal(err)
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile("slices_gen.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+var slicesTemplate = template.Must(template.New("slices").Parse(`// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Code generated by gen_slices.go. DO NOT EDIT.
+
+package checked
+
+import "time"
+{{range .}}
+// {{.Name}} is a checked {{.Elem}} slice.
+type {{.Name}} interface {
+	ReadWriteRef
+
+	Get() []{{.Elem}}
+	Cap() int
+	Len() int
+	Resize(size int)
+	Append(value {{.Elem}})
+	AppendAll(values []{{.Elem}})
+	Reset(v []{{.Elem}})
+{{- if .Clear}}
+
+	// Clear zeroes the values up to the capacity and resizes to zero so
+	// that the backing array no longer retains references.
+	Clear()
+{{- end}}
+}
+
+type {{.Ref}} struct {
+	RefCount
+
+	value []{{.Elem}}
+}
+
+// New{{.Name}} returns a new checked {{.Elem}} slice.
+func New{{.Name}}(value []{{.Elem}}) {{.Name}} {
+	s := &{{.Ref}}{value: value}
+	s.trackCensus("checked.{{.Name}}")
+	if sampleLeakDetection() {
+		s.trackObject(s.value)
+	}
+	return s
+}
+
+func (s *{{.Ref}}) Get() []{{.Elem}} {
+	s.IncReads()
+	v := s.value
+	s.DecReads()
+	return v
+}
+
+func (s *{{.Ref}}) Cap() int {
+	s.IncReads()
+	v := cap(s.value)
+	s.DecReads()
+	return v
+}
+
+// UncheckedCap returns the capacity without checking the refs, pools use it
+// to size the slices they hold without taking refs on them.
+func (s *{{.Ref}}) UncheckedCap() int {
+	return cap(s.value)
+}
+
+func (s *{{.Ref}}) Len() int {
+	s.IncReads()
+	v := len(s.value)
+	s.DecReads()
+	return v
+}
+
+func (s *{{.Ref}}) Resize(size int) {
+	s.IncWrites()
+	s.value = s.value[:size]
+	s.DecWrites()
+}
+
+func (s *{{.Ref}}) Append(value {{.Elem}}) {
+	s.IncWrites()
+	s.value = append(s.value, value)
+	s.DecWrites()
+}
+
+func (s *{{.Ref}}) AppendAll(values []{{.Elem}}) {
+	s.IncWrites()
+	s.value = append(s.value, values...)
+	s.DecWrites()
+}
+
+func (s *{{.Ref}}) Reset(v []{{.Elem}}) {
+	s.IncWrites()
+	s.value = v
+	s.DecWrites()
+}
+{{- if .Clear}}
+
+func (s *{{.Ref}}) Clear() {
+	s.IncWrites()
+	all := s.value[:cap(s.value)]
+	for i := range all {
+		all[i] = {{.Zero}}
+	}
+	s.value = all[:0]
+	s.DecWrites()
+}
+{{- end}}
+{{end -}}
+`))
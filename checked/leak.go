@@ -0,0 +1,393 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package checked
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/m3db/m3x/instrument"
+	xlog "github.com/m3db/m3x/log"
+
+	"github.com/uber-go/tally"
+)
+
+const leaksPath = "/debug/checked/leaks"
+
+var leaks struct {
+	sync.RWMutex
+	m map[string]*LeakRecord
+}
+
+// LeakRecord aggregates the objects leaked from the same site, objects leak
+// from the same site when they were tracked from the same stack and the
+// events recorded for them before they were garbage collected happened at
+// the same call sites. Events are only recorded with tracebacks enabled and
+// stacks only captured with leak detection stacks enabled, without either
+// all leaks share one record. When leak detection is sampled only sampled
+// objects are counted.
+type LeakRecord struct {
+	// Bytes is the number of bytes leaked.
+	Bytes uint64 `json:"bytes"`
+
+	// Objects is the number of objects leaked.
+	Objects uint64 `json:"objects"`
+
+	// FirstSeen is when the first object leaked was collected.
+	FirstSeen time.Time `json:"firstSeen"`
+
+	// LastSeen is when the last object leaked was collected.
+	LastSeen time.Time `json:"lastSeen"`
+
+	// Allocation is the stack the leaked objects were tracked from, if leak
+	// detection stacks are enabled.
+	Allocation []LeakFrame `json:"allocation,omitempty"`
+
+	// Events are the events recorded for the leaked objects, most recent
+	// first.
+	Events []LeakEvent `json:"events"`
+
+	// origin is the traceback of the first object leaked as dumped by
+	// DumpLeaks.
+	origin string
+}
+
+// LeakEvent is an event recorded for leaked objects.
+type LeakEvent struct {
+	Event  string      `json:"event"`
+	Ref    int         `json:"ref"`
+	Frames []LeakFrame `json:"frames"`
+}
+
+// LeakFrame is a frame of the traceback of an event.
+type LeakFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+func (r LeakRecord) String() string {
+	buf := bytes.NewBuffer(nil)
+	if len(r.Allocation) > 0 {
+		buf.WriteString("TrackObject:\n")
+		writeLeakFrames(buf, r.Allocation)
+		buf.WriteString("\n")
+	}
+	for _, e := range r.Events {
+		fmt.Fprintf(buf, "%s, ref=%d:\n", e.Event, e.Ref)
+		writeLeakFrames(buf, e.Frames)
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+func writeLeakFrames(buf *bytes.Buffer, frames []LeakFrame) {
+	for _, f := range frames {
+		fmt.Fprintf(buf, "%s(...)\n\t%s:%d\n", f.Function, f.File, f.Line)
+	}
+}
+
+// Leaks returns all detected leaks so far sorted by bytes leaked descending.
+func Leaks() []LeakRecord {
+	leaks.RLock()
+	r := make([]LeakRecord, 0, len(leaks.m))
+	for _, record := range leaks.m {
+		r = append(r, *record)
+	}
+	leaks.RUnlock()
+
+	sort.Sort(leaksByBytes(r))
+	return r
+}
+
+// leaksByBytes sorts leak records by bytes descending then by first seen.
+type leaksByBytes []LeakRecord
+
+func (x leaksByBytes) Len() int {
+	return len(x)
+}
+
+func (x leaksByBytes) Swap(i, j int) {
+	x[i], x[j] = x[j], x[i]
+}
+
+func (x leaksByBytes) Less(i, j int) bool {
+	if x[i].Bytes != x[j].Bytes {
+		return x[i].Bytes > x[j].Bytes
+	}
+	return x[i].FirstSeen.Before(x[j].FirstSeen)
+}
+
+// DumpLeaks returns all detected leaks so far, one per leak site with the
+// traceback of the first object leaked from the site.
+func DumpLeaks() []string {
+	var r []string
+	for _, record := range Leaks() {
+		r = append(r, fmt.Sprintf("leaked %d bytes, origin:\n%s",
+			record.Bytes, record.origin))
+	}
+	return r
+}
+
+func recordLeak(d *debugger, size int, alloc []uintptr) {
+	key, entries := d.leakSite()
+	if len(alloc) > 0 {
+		key = pcKey(alloc) + "|" + key
+	}
+	origin := leakOrigin(d, alloc)
+	now := time.Now()
+
+	leaks.Lock()
+	record, ok := leaks.m[key]
+	if !ok {
+		record = &LeakRecord{
+			FirstSeen:  now,
+			Allocation: leakFrames(alloc),
+			Events:     leakEvents(entries),
+			origin:     origin,
+		}
+		leaks.m[key] = record
+	}
+	// Keep track of bytes leaked as well as objects.
+	record.Bytes += uint64(size)
+	record.Objects++
+	record.LastSeen = now
+	leaks.Unlock()
+}
+
+// leakOrigin returns the traceback of a leaked object followed by the stack
+// it was tracked from, if captured.
+func leakOrigin(d *debugger, alloc []uintptr) string {
+	origin := d.String()
+	if len(alloc) == 0 {
+		return origin
+	}
+	buf := bytes.NewBufferString(origin)
+	buf.WriteString("TrackObject:\n")
+	writeLeakFrames(buf, leakFrames(alloc))
+	buf.WriteString("\n")
+	return buf.String()
+}
+
+// leakSite returns a key identifying the call sites of the events recorded,
+// regardless of when they happened, along with the events most recent first.
+func (d *debugger) leakSite() (string, []debuggerEntry) {
+	var (
+		key     = bytes.NewBuffer(nil)
+		entries []debuggerEntry
+	)
+
+	d.Lock()
+	for i := len(d.entries) - 1; i >= 0; i-- {
+		for j := len(d.entries[i]) - 1; j >= 0; j-- {
+			e := d.entries[i][j]
+			key.WriteString(e.event.String())
+			key.WriteString(strconv.Itoa(e.ref))
+			key.WriteString(pcKey(e.pc))
+			key.WriteString(";")
+			entries = append(entries, debuggerEntry{
+				event: e.event,
+				ref:   e.ref,
+				pc:    append([]uintptr(nil), e.pc...),
+			})
+		}
+	}
+	d.Unlock()
+
+	return key.String(), entries
+}
+
+func pcKey(pc []uintptr) string {
+	key := make([]byte, 0, len(pc)*8)
+	for _, pc := range pc {
+		key = strconv.AppendUint(key, uint64(pc), 16)
+		key = append(key, ',')
+	}
+	return string(key)
+}
+
+func leakEvents(entries []debuggerEntry) []LeakEvent {
+	events := make([]LeakEvent, 0, len(entries))
+	for _, e := range entries {
+		events = append(events, LeakEvent{
+			Event:  e.event.String(),
+			Ref:    e.ref,
+			Frames: leakFrames(e.pc),
+		})
+	}
+	return events
+}
+
+func leakFrames(pc []uintptr) []LeakFrame {
+	if len(pc) == 0 {
+		return nil
+	}
+
+	var (
+		result []LeakFrame
+		frames = runtime.CallersFrames(pc)
+	)
+	for {
+		frame, more := frames.Next()
+		result = append(result, LeakFrame{
+			Function: frame.Function,
+			File:     frame.File,
+			Line:     frame.Line,
+		})
+		if !more {
+			break
+		}
+	}
+	return result
+}
+
+// RegisterLeaksHandler registers the leaks handler with the given http mux,
+// the handler returns all detected leaks so far as JSON.
+func RegisterLeaksHandler(mux *http.ServeMux) {
+	mux.Handle(leaksPath, leaksHandler())
+}
+
+func leaksHandler() http.Handler {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(Leaks()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+	return http.HandlerFunc(h)
+}
+
+// LeakReporter periodically reports the leaks detected so far, the bytes and
+// objects leaked are emitted as counters and the top leak sites by bytes
+// leaked are logged. The reporter is not thread-safe.
+type LeakReporter struct {
+	reportInterval time.Duration
+	topN           int
+	logger         xlog.Logger
+	metrics        leakReporterMetrics
+	reported       leakTotals
+	started        bool
+	quit           chan struct{}
+}
+
+type leakReporterMetrics struct {
+	bytes   tally.Counter
+	objects tally.Counter
+	sites   tally.Gauge
+}
+
+// leakTotals are the bytes and objects leaked across all leak sites.
+type leakTotals struct {
+	bytes   uint64
+	objects uint64
+}
+
+// NewLeakReporter creates a new leak reporter logging the top n leak sites
+// on every report.
+func NewLeakReporter(
+	instrumentOpts instrument.Options,
+	reportInterval time.Duration,
+	topN int,
+) *LeakReporter {
+	scope := instrumentOpts.MetricsScope().SubScope("leaks")
+	return &LeakReporter{
+		reportInterval: reportInterval,
+		topN:           topN,
+		logger:         instrumentOpts.Logger(),
+		metrics: leakReporterMetrics{
+			bytes:   scope.Counter("bytes"),
+			objects: scope.Counter("objects"),
+			sites:   scope.Gauge("sites"),
+		},
+		quit: make(chan struct{}),
+	}
+}
+
+// Start starts the reporter thread that periodically reports leaks.
+func (r *LeakReporter) Start() {
+	if r.started {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(r.reportInterval)
+		for {
+			select {
+			case <-ticker.C:
+				r.report()
+			case <-r.quit:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	r.started = true
+}
+
+// Stop stops reporting leaks.
+// The reporter cannot be started again after it's been stopped.
+func (r *LeakReporter) Stop() {
+	close(r.quit)
+}
+
+func (r *LeakReporter) report() {
+	var totals leakTotals
+
+	leaks.RLock()
+	sites := len(leaks.m)
+	for _, record := range leaks.m {
+		totals.bytes += record.Bytes
+		totals.objects += record.Objects
+	}
+	leaks.RUnlock()
+
+	// Records only grow unless the leaks detected are reset, in which case
+	// all the leaks since are new.
+	bytes, objects := totals.bytes, totals.objects
+	if totals.bytes >= r.reported.bytes && totals.objects >= r.reported.objects {
+		bytes -= r.reported.bytes
+		objects -= r.reported.objects
+	}
+	r.reported = totals
+
+	r.metrics.bytes.Inc(int64(bytes))
+	r.metrics.objects.Inc(int64(objects))
+	r.metrics.sites.Update(float64(sites))
+
+	if objects == 0 {
+		return
+	}
+
+	top := Leaks()
+	if len(top) > r.topN {
+		top = top[:r.topN]
+	}
+	for i, record := range top {
+		r.logger.Warnf("leak site %d of %d: leaked %d bytes in %d objects since %v, origin:\n%s",
+			i+1, sites, record.Bytes, record.Objects, record.FirstSeen, record.String())
+	}
+}
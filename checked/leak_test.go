@@ -0,0 +1,210 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package checked
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/m3db/m3x/instrument"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func resetLeaks() {
+	leaks.Lock()
+	leaks.m = make(map[string]*LeakRecord)
+	leaks.Unlock()
+}
+
+func leakFrom(size int) {
+	v := &RefCount{}
+	v.IncRef()
+	recordLeak(&getDebuggerRef(v).debugger, size, nil)
+}
+
+func TestLeakRecords(t *testing.T) {
+	EnableTracebacks()
+	defer DisableTracebacks()
+	resetLeaks()
+	defer resetLeaks()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		leakFrom(16)
+	}
+	leakFrom(100)
+
+	records := Leaks()
+	require.Equal(t, 2, len(records))
+
+	// Leaks from the same site are aggregated, larger leaks first.
+	assert.Equal(t, uint64(100), records[0].Bytes)
+	assert.Equal(t, uint64(1), records[0].Objects)
+	assert.Equal(t, uint64(48), records[1].Bytes)
+	assert.Equal(t, uint64(3), records[1].Objects)
+	assert.False(t, records[1].FirstSeen.Before(start))
+	assert.False(t, records[1].LastSeen.Before(records[1].FirstSeen))
+
+	require.Equal(t, 1, len(records[1].Events))
+	event := records[1].Events[0]
+	assert.Equal(t, "IncRef", event.Event)
+	assert.Equal(t, 1, event.Ref)
+	require.True(t, len(event.Frames) > 2)
+	assert.Equal(t, "github.com/m3db/m3x/checked.(*RefCount).IncRef", event.Frames[0].Function)
+	assert.Equal(t, "github.com/m3db/m3x/checked.leakFrom", event.Frames[1].Function)
+	assert.True(t, strings.HasSuffix(event.Frames[1].File, "leak_test.go"))
+
+	dump := DumpLeaks()
+	require.Equal(t, 2, len(dump))
+	assert.True(t, strings.HasPrefix(dump[1], "leaked 48 bytes, origin:\nIncRef, ref=1, unixnanos="))
+	assert.True(t, strings.Contains(dump[1], "checked.leakFrom(...)\n"))
+}
+
+func TestLeaksHandler(t *testing.T) {
+	resetLeaks()
+	defer resetLeaks()
+
+	leakFrom(8)
+
+	mux := http.NewServeMux()
+	RegisterLeaksHandler(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", leaksPath, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var records []LeakRecord
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &records))
+	require.Equal(t, 1, len(records))
+	assert.Equal(t, uint64(8), records[0].Bytes)
+	assert.Equal(t, uint64(1), records[0].Objects)
+}
+
+func TestLeakReporter(t *testing.T) {
+	resetLeaks()
+	defer resetLeaks()
+
+	scope := tally.NewTestScope("", nil)
+	r := NewLeakReporter(instrument.NewOptions().SetMetricsScope(scope), time.Minute, 1)
+
+	leakFrom(8)
+	leakFrom(8)
+	r.report()
+
+	leakFrom(8)
+	r.report()
+
+	snapshot := scope.Snapshot()
+	assert.Equal(t, int64(24), snapshot.Counters()["leaks.bytes+"].Value())
+	assert.Equal(t, int64(3), snapshot.Counters()["leaks.objects+"].Value())
+	assert.Equal(t, 1.0, snapshot.Gauges()["leaks.sites+"].Value())
+
+	// Leaks detected after a reset are all reported.
+	resetLeaks()
+	leakFrom(8)
+	r.report()
+
+	snapshot = scope.Snapshot()
+	assert.Equal(t, int64(32), snapshot.Counters()["leaks.bytes+"].Value())
+	assert.Equal(t, int64(4), snapshot.Counters()["leaks.objects+"].Value())
+}
+
+func TestLeakDetectionSampling(t *testing.T) {
+	EnableLeakDetection()
+	defer DisableLeakDetection()
+	SetLeakDetectionSampleEvery(4)
+	defer SetLeakDetectionSampleEvery(defaultLeakSampleEvery)
+
+	sampled := 0
+	for i := 0; i < 100; i++ {
+		if sampleLeakDetection() {
+			sampled++
+		}
+	}
+	assert.Equal(t, 25, sampled)
+
+	SetLeakDetectionSampleEvery(0)
+	assert.True(t, sampleLeakDetection())
+
+	DisableLeakDetection()
+	assert.False(t, sampleLeakDetection())
+}
+
+//go:noinline
+func trackLeakedObject() {
+	v := &RefCount{}
+	v.TrackObject(v)
+	v.IncRef()
+}
+
+func TestLeakDetectionStacks(t *testing.T) {
+	resetLeaks()
+	defer resetLeaks()
+
+	LeakDetectionConfiguration{
+		Enabled:       true,
+		SampleEvery:   1,
+		CaptureStacks: true,
+	}.Apply()
+	defer LeakDetectionConfiguration{}.Apply()
+
+	trackLeakedObject()
+
+	var records []LeakRecord
+	for ; len(records) == 0; records = Leaks() {
+		// Finalizers are run in a separate goroutine.
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	require.Equal(t, 1, len(records))
+	require.True(t, len(records[0].Allocation) > 1)
+	assert.Equal(t, "github.com/m3db/m3x/checked.(*RefCount).TrackObject",
+		records[0].Allocation[0].Function)
+	assert.Equal(t, "github.com/m3db/m3x/checked.trackLeakedObject",
+		records[0].Allocation[1].Function)
+	assert.True(t, strings.Contains(DumpLeaks()[0], "TrackObject:\n"))
+}
+
+func TestLeakDetectionConfigurationApply(t *testing.T) {
+	LeakDetectionConfiguration{
+		Enabled:       true,
+		SampleEvery:   100,
+		CaptureStacks: true,
+	}.Apply()
+	assert.True(t, flagEnabled(&leakDetectionFlag))
+	assert.Equal(t, uint64(100), atomic.LoadUint64(&leakDetectionSampleEvery))
+	assert.True(t, flagEnabled(&leakDetectionStacks))
+
+	LeakDetectionConfiguration{}.Apply()
+	assert.False(t, flagEnabled(&leakDetectionFlag))
+	assert.Equal(t, uint64(1), atomic.LoadUint64(&leakDetectionSampleEvery))
+	assert.False(t, flagEnabled(&leakDetectionStacks))
+}
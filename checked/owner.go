@@ -0,0 +1,202 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package checked
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+const defaultOwnership = false
+
+var (
+	ownershipFlag = boolFlag(defaultOwnership)
+
+	// ownerTokens is the last owner token issued.
+	ownerTokens uint64
+)
+
+// OwnerToken identifies a holder of a reference in ownership mode, the zero
+// token is issued when ownership mode is off and is never checked.
+type OwnerToken uint64
+
+// refOwners is the set of tokens of the live holders of references to an
+// entity, a token is live from when it is issued until it is moved or
+// released. Tokens are unique across all entities so a token held past its
+// release or move is never live again.
+type refOwners struct {
+	sync.Mutex
+	tokens map[OwnerToken]struct{}
+}
+
+// EnableOwnership turns ownership mode on, in which references taken with
+// IncRefOwned are checked to be used only through live tokens.
+func EnableOwnership() {
+	setFlag(&ownershipFlag, true)
+}
+
+// DisableOwnership turns ownership mode off, tokens already issued are still
+// checked until released.
+func DisableOwnership() {
+	setFlag(&ownershipFlag, false)
+}
+
+// IncRefOwned increments the reference count to this entity and returns a
+// token for the new holder of the reference. Every holder gets its own
+// token, which stays live until the reference is moved or released.
+func (c *RefCount) IncRefOwned() OwnerToken {
+	c.IncRef()
+	if !flagEnabled(&ownershipFlag) {
+		return 0
+	}
+
+	token := newOwnerToken()
+	c.loadOrCreateOwners().add(token)
+	return token
+}
+
+// MoveRefOwned signals a move of the reference held through a token to this
+// entity and returns a token for the new holder, the token moved from
+// becomes stale. Moving through a stale token returns it unchanged.
+func (c *RefCount) MoveRefOwned(from OwnerToken) OwnerToken {
+	c.MoveRef()
+	if from == 0 {
+		return 0
+	}
+
+	owners := c.loadOwners()
+	if owners == nil {
+		c.panicStaleOwner("move", from)
+		return from
+	}
+
+	to := newOwnerToken()
+	if !owners.replace(from, to) {
+		c.panicStaleOwner("move", from)
+		return from
+	}
+	return to
+}
+
+// DecRefOwned decrements the reference count held through a token to this
+// entity, the token becomes stale. Releasing through a stale token leaves
+// the reference count unchanged.
+func (c *RefCount) DecRefOwned(token OwnerToken) {
+	if token != 0 {
+		owners := c.loadOwners()
+		if owners == nil || !owners.remove(token) {
+			c.panicStaleOwner("release", token)
+			return
+		}
+	}
+	c.DecRef()
+}
+
+// IncReadsOwned increments the reads count to this entity through a token,
+// reads through a stale token are rejected.
+func (c *RefCount) IncReadsOwned(token OwnerToken) {
+	c.checkOwner(token, "read")
+	c.IncReads()
+}
+
+// IncWritesOwned increments the writes count to this entity through a
+// token, writes through a stale token are rejected.
+func (c *RefCount) IncWritesOwned(token OwnerToken) {
+	c.checkOwner(token, "write")
+	c.IncWrites()
+}
+
+func newOwnerToken() OwnerToken {
+	return OwnerToken(atomic.AddUint64(&ownerTokens, 1))
+}
+
+func (c *RefCount) loadOwners() *refOwners {
+	return (*refOwners)(atomic.LoadPointer(&c.owner))
+}
+
+// loadOrCreateOwners returns the owners of the entity, the set is created
+// on the first reference taken in ownership mode and kept once created.
+func (c *RefCount) loadOrCreateOwners() *refOwners {
+	if owners := c.loadOwners(); owners != nil {
+		return owners
+	}
+	owners := &refOwners{tokens: make(map[OwnerToken]struct{})}
+	if atomic.CompareAndSwapPointer(&c.owner, nil, unsafe.Pointer(owners)) {
+		return owners
+	}
+	return c.loadOwners()
+}
+
+// checkOwner checks that the token is live, the zero token is never checked.
+func (c *RefCount) checkOwner(token OwnerToken, op string) {
+	if token == 0 {
+		return
+	}
+	if owners := c.loadOwners(); owners != nil && owners.live(token) {
+		return
+	}
+	c.panicStaleOwner(op, token)
+}
+
+func (c *RefCount) panicStaleOwner(op string, token OwnerToken) {
+	err := fmt.Errorf("%s through stale owner: owner=%d, ref=%d",
+		op, token, atomic.LoadInt32(&c.ref))
+	panicRef(c, err)
+}
+
+func (o *refOwners) add(token OwnerToken) {
+	o.Lock()
+	o.tokens[token] = struct{}{}
+	o.Unlock()
+}
+
+func (o *refOwners) live(token OwnerToken) bool {
+	o.Lock()
+	_, ok := o.tokens[token]
+	o.Unlock()
+	return ok
+}
+
+// replace replaces a live token with another, it returns false if the token
+// replaced is not live.
+func (o *refOwners) replace(from, to OwnerToken) bool {
+	o.Lock()
+	defer o.Unlock()
+	if _, ok := o.tokens[from]; !ok {
+		return false
+	}
+	delete(o.tokens, from)
+	o.tokens[to] = struct{}{}
+	return true
+}
+
+// remove removes a live token, it returns false if the token is not live.
+func (o *refOwners) remove(token OwnerToken) bool {
+	o.Lock()
+	defer o.Unlock()
+	if _, ok := o.tokens[token]; !ok {
+		return false
+	}
+	delete(o.tokens, token)
+	return true
+}
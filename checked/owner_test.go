@@ -0,0 +1,222 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package checked
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOwnershipMoveRef(t *testing.T) {
+	EnableOwnership()
+	defer DisableOwnership()
+
+	var err error
+	SetPanicFn(func(e error) {
+		err = e
+	})
+	defer ResetPanicFn()
+
+	elem := &RefCount{}
+	first := elem.IncRefOwned()
+	require.NotEqual(t, OwnerToken(0), first)
+
+	elem.IncReadsOwned(first)
+	elem.DecReads()
+	require.NoError(t, err)
+
+	second := elem.MoveRefOwned(first)
+	elem.IncWritesOwned(second)
+	elem.DecWrites()
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, 1, elem.NumRef())
+
+	// The previous holder can no longer read or write, even from the same
+	// goroutine.
+	elem.IncReadsOwned(first)
+	elem.DecReads()
+	require.Error(t, err)
+	assert.Equal(t, fmt.Sprintf("read through stale owner: owner=%d, ref=1", first),
+		err.Error())
+
+	err = nil
+	elem.IncWritesOwned(first)
+	elem.DecWrites()
+	require.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "write through stale owner"))
+
+	err = nil
+	assert.Equal(t, first, elem.MoveRefOwned(first))
+	require.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "move through stale owner"))
+
+	err = nil
+	elem.DecRefOwned(first)
+	require.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "release through stale owner"))
+	assert.Equal(t, 1, elem.NumRef())
+
+	err = nil
+	elem.DecRefOwned(second)
+	require.NoError(t, err)
+	assert.Equal(t, 0, elem.NumRef())
+}
+
+func TestOwnershipMultipleHolders(t *testing.T) {
+	EnableOwnership()
+	defer DisableOwnership()
+
+	var err error
+	SetPanicFn(func(e error) {
+		err = e
+	})
+	defer ResetPanicFn()
+
+	elem := &RefCount{}
+	a := elem.IncRefOwned()
+	b := elem.IncRefOwned()
+	assert.NotEqual(t, a, b)
+	assert.Equal(t, 2, elem.NumRef())
+
+	// Both holders may read, and either may move its own reference without
+	// affecting the other.
+	elem.IncReadsOwned(a)
+	elem.IncReadsOwned(b)
+	elem.DecReads()
+	elem.DecReads()
+	c := elem.MoveRefOwned(b)
+	elem.IncReadsOwned(a)
+	elem.DecReads()
+	require.NoError(t, err)
+
+	elem.DecRefOwned(a)
+	elem.DecRefOwned(c)
+	require.NoError(t, err)
+	assert.Equal(t, 0, elem.NumRef())
+}
+
+func TestOwnershipBytesAccessors(t *testing.T) {
+	EnableOwnership()
+	defer DisableOwnership()
+
+	var errs []error
+	SetPanicFn(func(e error) {
+		errs = append(errs, e)
+	})
+	defer ResetPanicFn()
+
+	b := NewBytes([]byte("abc"), nil)
+	token := b.(Owned).IncRefOwned()
+	moved := b.(Owned).MoveRefOwned(token)
+
+	b.(Owned).IncWritesOwned(moved)
+	b.DecWrites()
+	b.Append('d')
+	b.(Owned).IncReadsOwned(moved)
+	assert.Equal(t, []byte("abcd"), b.Get())
+	b.DecReads()
+	require.Empty(t, errs)
+
+	// The previous holder is rejected.
+	b.(Owned).IncReadsOwned(token)
+	b.DecReads()
+	b.(Owned).IncWritesOwned(token)
+	b.DecWrites()
+	require.Equal(t, 2, len(errs))
+	assert.True(t, strings.HasPrefix(errs[0].Error(), "read through stale owner"))
+	assert.True(t, strings.HasPrefix(errs[1].Error(), "write through stale owner"))
+}
+
+func TestOwnershipDecRefOwned(t *testing.T) {
+	EnableOwnership()
+	defer DisableOwnership()
+
+	var err error
+	SetPanicFn(func(e error) {
+		err = e
+	})
+	defer ResetPanicFn()
+
+	elem := &RefCount{}
+	token := elem.IncRefOwned()
+	elem.IncRef()
+	assert.Equal(t, 2, elem.NumRef())
+
+	elem.DecRefOwned(token)
+	assert.Equal(t, 1, elem.NumRef())
+	require.NoError(t, err)
+
+	// Releasing twice is rejected without touching the ref count.
+	elem.DecRefOwned(token)
+	require.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "release through stale owner"))
+	assert.Equal(t, 1, elem.NumRef())
+
+	// References taken without a token are not checked.
+	err = nil
+	elem.IncReads()
+	elem.DecReads()
+	require.NoError(t, err)
+}
+
+func TestOwnershipTraceback(t *testing.T) {
+	EnableOwnership()
+	defer DisableOwnership()
+	EnableTracebacks()
+	defer DisableTracebacks()
+
+	var err error
+	SetPanicFn(func(e error) {
+		err = e
+	})
+	defer ResetPanicFn()
+
+	elem := &RefCount{}
+	token := elem.IncRefOwned()
+	elem.MoveRefOwned(token)
+	elem.IncReadsOwned(token)
+
+	require.Error(t, err)
+	str := err.Error()
+	assert.True(t, strings.Contains(str, "read through stale owner"))
+	assert.True(t, strings.Contains(str, "MoveRef, ref=1, unixnanos="))
+	assert.True(t, strings.Contains(str, "checked.(*RefCount).MoveRefOwned"))
+}
+
+func TestOwnershipDisabled(t *testing.T) {
+	elem := &RefCount{}
+	token := elem.IncRefOwned()
+	assert.Equal(t, OwnerToken(0), token)
+	assert.Equal(t, OwnerToken(0), elem.MoveRefOwned(token))
+
+	assert.NotPanics(t, func() {
+		elem.IncReadsOwned(token)
+		elem.DecReads()
+		elem.DecRefOwned(token)
+	})
+	assert.Equal(t, 0, elem.NumRef())
+	assert.Nil(t, elem.loadOwners())
+}
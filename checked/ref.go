@@ -30,20 +30,33 @@ import (
 
 // RefCount is an embeddable checked.Ref.
 type RefCount struct {
-	ref       int32
-	reads     int32
-	writes    int32
-	finalizer unsafe.Pointer
+	ref        int32
+	reads      int32
+	writes     int32
+	censused   int32
+	readOnly   bool
+	censusType uint16
+	finalizer  unsafe.Pointer
+	owner      unsafe.Pointer
 }
 
 // IncRef increments the reference count to this entity.
 func (c *RefCount) IncRef() {
 	n := atomic.AddInt32(&c.ref, 1)
 	tracebackEvent(c, int(n), incRefEvent)
+
+	if n == 1 && refCensusEnabled() {
+		c.censusAdd()
+	}
 }
 
 // DecRef decrements the reference count to this entity.
 func (c *RefCount) DecRef() {
+	c.decRef()
+}
+
+// decRef decrements the reference count and returns the new count.
+func (c *RefCount) decRef() int {
 	n := atomic.AddInt32(&c.ref, -1)
 	tracebackEvent(c, int(n), decRefEvent)
 
@@ -51,6 +64,12 @@ func (c *RefCount) DecRef() {
 		err := fmt.Errorf("negative ref count, ref=%d", n)
 		panicRef(c, err)
 	}
+
+	if n == 0 && atomic.LoadInt32(&c.censused) != 0 {
+		c.censusRemove()
+	}
+
+	return int(n)
 }
 
 // MoveRef signals a move of the ref to this entity.
@@ -96,11 +115,17 @@ func (c *RefCount) SetFinalizer(f Finalizer) {
 func (c *RefCount) IncReads() {
 	tracebackEvent(c, c.NumRef(), incReadsEvent)
 	n := atomic.AddInt32(&c.reads, 1)
+	ref := c.NumRef()
 
-	if ref := c.NumRef(); n > 0 && ref < 1 {
+	if n > 0 && ref < 1 {
 		err := fmt.Errorf("read after free: reads=%d, ref=%d", n, ref)
 		panicRef(c, err)
 	}
+
+	if writes := c.NumWriters(); writes > 0 {
+		err := fmt.Errorf("read during write: reads=%d, writes=%d, ref=%d", n, writes, ref)
+		panicRef(c, err)
+	}
 }
 
 // DecReads decrements the reads count to this entity.
@@ -125,6 +150,12 @@ func (c *RefCount) IncWrites() {
 	n := atomic.AddInt32(&c.writes, 1)
 	ref := c.NumRef()
 
+	if c.readOnly {
+		err := fmt.Errorf("write to read only: writes=%d, ref=%d", n, ref)
+		panicRef(c, err)
+		return
+	}
+
 	if n > 0 && ref < 1 {
 		err := fmt.Errorf("write after free: writes=%d, ref=%d", n, ref)
 		panicRef(c, err)
@@ -134,6 +165,11 @@ func (c *RefCount) IncWrites() {
 		err := fmt.Errorf("double write: writes=%d, ref=%d", n, ref)
 		panicRef(c, err)
 	}
+
+	if reads := c.NumReaders(); reads > 0 {
+		err := fmt.Errorf("write during read: writes=%d, reads=%d, ref=%d", n, reads, ref)
+		panicRef(c, err)
+	}
 }
 
 // DecWrites decrements the writes count to this entity.
@@ -153,12 +189,20 @@ func (c *RefCount) NumWriters() int {
 }
 
 // TrackObject sets up the initial internal state of the Ref for
-// leak detection.
+// leak detection and the ref census, if leak detection is sampled only the
+// sampled objects are tracked for leaks.
 func (c *RefCount) TrackObject(v interface{}) {
-	if !leakDetectionFlag {
+	if refCensusEnabled() {
+		c.trackCensus(reflect.TypeOf(v).String())
+	}
+	if !sampleLeakDetection() {
 		return
 	}
+	c.trackObject(v)
+}
 
+// trackObject tracks an object which was already sampled.
+func (c *RefCount) trackObject(v interface{}) {
 	var size int
 
 	switch v := reflect.ValueOf(v); v.Kind() {
@@ -172,16 +216,19 @@ func (c *RefCount) TrackObject(v interface{}) {
 		size = int(v.Type().Size())
 	}
 
+	var alloc []uintptr
+	if flagEnabled(&leakDetectionStacks) {
+		pc := make([]uintptr, getTracebackMaxDepth())
+		// Skip the frames of runtime.Callers and trackObject.
+		skipEntry := 2
+		alloc = pc[:runtime.Callers(skipEntry, pc)]
+	}
+
 	runtime.SetFinalizer(c, func(c *RefCount) {
 		if c.NumRef() == 0 {
 			return
 		}
 
-		origin := getDebuggerRef(c).String()
-
-		leaks.Lock()
-		// Keep track of bytes leaked, not objects.
-		leaks.m[origin] += uint64(size)
-		leaks.Unlock()
+		recordLeak(&getDebuggerRef(c).debugger, size, alloc)
 	})
 }
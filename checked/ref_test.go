@@ -23,10 +23,12 @@ package checked
 import (
 	"reflect"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRefCountNegativeRefCount(t *testing.T) {
@@ -207,6 +209,100 @@ func TestRefCountWriteFinishAfterFree(t *testing.T) {
 	assert.Equal(t, "write finish after free: writes=0, ref=0", err.Error())
 }
 
+func TestRefCountReadDuringWrite(t *testing.T) {
+	elem := &RefCount{}
+
+	var err error
+	SetPanicFn(func(e error) {
+		err = e
+	})
+	defer ResetPanicFn()
+
+	elem.IncRef()
+	elem.IncWrites()
+	assert.Nil(t, err)
+
+	elem.IncReads()
+	assert.Error(t, err)
+	assert.Equal(t, "read during write: reads=1, writes=1, ref=1", err.Error())
+}
+
+func TestRefCountWriteDuringRead(t *testing.T) {
+	elem := &RefCount{}
+
+	var err error
+	SetPanicFn(func(e error) {
+		err = e
+	})
+	defer ResetPanicFn()
+
+	elem.IncRef()
+	elem.IncReads()
+	elem.IncReads()
+	assert.Nil(t, err)
+
+	elem.IncWrites()
+	assert.Error(t, err)
+	assert.Equal(t, "write during read: writes=1, reads=2, ref=1", err.Error())
+}
+
+func TestRefCountReadsAfterWriteFinished(t *testing.T) {
+	elem := &RefCount{}
+
+	var err error
+	SetPanicFn(func(e error) {
+		err = e
+	})
+	defer ResetPanicFn()
+
+	elem.IncRef()
+	elem.IncWrites()
+	elem.DecWrites()
+	elem.IncReads()
+	elem.IncReads()
+	elem.DecReads()
+	elem.DecReads()
+	elem.IncWrites()
+	elem.DecWrites()
+	assert.Nil(t, err)
+}
+
+func TestRefCountReadDuringWriteTraceback(t *testing.T) {
+	EnableTracebacks()
+	defer DisableTracebacks()
+
+	elem := &RefCount{}
+
+	var err error
+	SetPanicFn(func(e error) {
+		err = e
+	})
+	defer ResetPanicFn()
+
+	elem.IncRef()
+
+	writing := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		elem.IncWrites()
+		close(writing)
+		<-done
+		elem.DecWrites()
+	}()
+
+	<-writing
+	elem.IncReads()
+	close(done)
+
+	require.Error(t, err)
+	str := err.Error()
+	assert.True(t, strings.Contains(str, "read during write: reads=1, writes=1, ref=1"))
+	assert.True(t, strings.Contains(str, "IncReads, ref=1, unixnanos="))
+	assert.True(t, strings.Contains(str, "checked.(*RefCount).IncReads"))
+	assert.True(t, strings.Contains(str, "IncWrites, ref=1, unixnanos="))
+	assert.True(t, strings.Contains(str, "checked.(*RefCount).IncWrites"))
+}
+
 func TestLeakDetection(t *testing.T) {
 	EnableLeakDetection()
 	defer DisableLeakDetection()
@@ -0,0 +1,453 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Code generated by gen_slices.go. DO NOT EDIT.
+
+package checked
+
+import "time"
+
+// Int64s is a checked int64 slice.
+type Int64s interface {
+	ReadWriteRef
+
+	Get() []int64
+	Cap() int
+	Len() int
+	Resize(size int)
+	Append(value int64)
+	AppendAll(values []int64)
+	Reset(v []int64)
+}
+
+type int64sRef struct {
+	RefCount
+
+	value []int64
+}
+
+// NewInt64s returns a new checked int64 slice.
+func NewInt64s(value []int64) Int64s {
+	s := &int64sRef{value: value}
+	s.trackCensus("checked.Int64s")
+	if sampleLeakDetection() {
+		s.trackObject(s.value)
+	}
+	return s
+}
+
+func (s *int64sRef) Get() []int64 {
+	s.IncReads()
+	v := s.value
+	s.DecReads()
+	return v
+}
+
+func (s *int64sRef) Cap() int {
+	s.IncReads()
+	v := cap(s.value)
+	s.DecReads()
+	return v
+}
+
+// UncheckedCap returns the capacity without checking the refs, pools use it
+// to size the slices they hold without taking refs on them.
+func (s *int64sRef) UncheckedCap() int {
+	return cap(s.value)
+}
+
+func (s *int64sRef) Len() int {
+	s.IncReads()
+	v := len(s.value)
+	s.DecReads()
+	return v
+}
+
+func (s *int64sRef) Resize(size int) {
+	s.IncWrites()
+	s.value = s.value[:size]
+	s.DecWrites()
+}
+
+func (s *int64sRef) Append(value int64) {
+	s.IncWrites()
+	s.value = append(s.value, value)
+	s.DecWrites()
+}
+
+func (s *int64sRef) AppendAll(values []int64) {
+	s.IncWrites()
+	s.value = append(s.value, values...)
+	s.DecWrites()
+}
+
+func (s *int64sRef) Reset(v []int64) {
+	s.IncWrites()
+	s.value = v
+	s.DecWrites()
+}
+
+// Uint64s is a checked uint64 slice.
+type Uint64s interface {
+	ReadWriteRef
+
+	Get() []uint64
+	Cap() int
+	Len() int
+	Resize(size int)
+	Append(value uint64)
+	AppendAll(values []uint64)
+	Reset(v []uint64)
+}
+
+type uint64sRef struct {
+	RefCount
+
+	value []uint64
+}
+
+// NewUint64s returns a new checked uint64 slice.
+func NewUint64s(value []uint64) Uint64s {
+	s := &uint64sRef{value: value}
+	s.trackCensus("checked.Uint64s")
+	if sampleLeakDetection() {
+		s.trackObject(s.value)
+	}
+	return s
+}
+
+func (s *uint64sRef) Get() []uint64 {
+	s.IncReads()
+	v := s.value
+	s.DecReads()
+	return v
+}
+
+func (s *uint64sRef) Cap() int {
+	s.IncReads()
+	v := cap(s.value)
+	s.DecReads()
+	return v
+}
+
+// UncheckedCap returns the capacity without checking the refs, pools use it
+// to size the slices they hold without taking refs on them.
+func (s *uint64sRef) UncheckedCap() int {
+	return cap(s.value)
+}
+
+func (s *uint64sRef) Len() int {
+	s.IncReads()
+	v := len(s.value)
+	s.DecReads()
+	return v
+}
+
+func (s *uint64sRef) Resize(size int) {
+	s.IncWrites()
+	s.value = s.value[:size]
+	s.DecWrites()
+}
+
+func (s *uint64sRef) Append(value uint64) {
+	s.IncWrites()
+	s.value = append(s.value, value)
+	s.DecWrites()
+}
+
+func (s *uint64sRef) AppendAll(values []uint64) {
+	s.IncWrites()
+	s.value = append(s.value, values...)
+	s.DecWrites()
+}
+
+func (s *uint64sRef) Reset(v []uint64) {
+	s.IncWrites()
+	s.value = v
+	s.DecWrites()
+}
+
+// Ints is a checked int slice.
+type Ints interface {
+	ReadWriteRef
+
+	Get() []int
+	Cap() int
+	Len() int
+	Resize(size int)
+	Append(value int)
+	AppendAll(values []int)
+	Reset(v []int)
+}
+
+type intsRef struct {
+	RefCount
+
+	value []int
+}
+
+// NewInts returns a new checked int slice.
+func NewInts(value []int) Ints {
+	s := &intsRef{value: value}
+	s.trackCensus("checked.Ints")
+	if sampleLeakDetection() {
+		s.trackObject(s.value)
+	}
+	return s
+}
+
+func (s *intsRef) Get() []int {
+	s.IncReads()
+	v := s.value
+	s.DecReads()
+	return v
+}
+
+func (s *intsRef) Cap() int {
+	s.IncReads()
+	v := cap(s.value)
+	s.DecReads()
+	return v
+}
+
+// UncheckedCap returns the capacity without checking the refs, pools use it
+// to size the slices they hold without taking refs on them.
+func (s *intsRef) UncheckedCap() int {
+	return cap(s.value)
+}
+
+func (s *intsRef) Len() int {
+	s.IncReads()
+	v := len(s.value)
+	s.DecReads()
+	return v
+}
+
+func (s *intsRef) Resize(size int) {
+	s.IncWrites()
+	s.value = s.value[:size]
+	s.DecWrites()
+}
+
+func (s *intsRef) Append(value int) {
+	s.IncWrites()
+	s.value = append(s.value, value)
+	s.DecWrites()
+}
+
+func (s *intsRef) AppendAll(values []int) {
+	s.IncWrites()
+	s.value = append(s.value, values...)
+	s.DecWrites()
+}
+
+func (s *intsRef) Reset(v []int) {
+	s.IncWrites()
+	s.value = v
+	s.DecWrites()
+}
+
+// Strings is a checked string slice.
+type Strings interface {
+	ReadWriteRef
+
+	Get() []string
+	Cap() int
+	Len() int
+	Resize(size int)
+	Append(value string)
+	AppendAll(values []string)
+	Reset(v []string)
+
+	// Clear zeroes the values up to the capacity and resizes to zero so
+	// that the backing array no longer retains references.
+	Clear()
+}
+
+type stringsRef struct {
+	RefCount
+
+	value []string
+}
+
+// NewStrings returns a new checked string slice.
+func NewStrings(value []string) Strings {
+	s := &stringsRef{value: value}
+	s.trackCensus("checked.Strings")
+	if sampleLeakDetection() {
+		s.trackObject(s.value)
+	}
+	return s
+}
+
+func (s *stringsRef) Get() []string {
+	s.IncReads()
+	v := s.value
+	s.DecReads()
+	return v
+}
+
+func (s *stringsRef) Cap() int {
+	s.IncReads()
+	v := cap(s.value)
+	s.DecReads()
+	return v
+}
+
+// UncheckedCap returns the capacity without checking the refs, pools use it
+// to size the slices they hold without taking refs on them.
+func (s *stringsRef) UncheckedCap() int {
+	return cap(s.value)
+}
+
+func (s *stringsRef) Len() int {
+	s.IncReads()
+	v := len(s.value)
+	s.DecReads()
+	return v
+}
+
+func (s *stringsRef) Resize(size int) {
+	s.IncWrites()
+	s.value = s.value[:size]
+	s.DecWrites()
+}
+
+func (s *stringsRef) Append(value string) {
+	s.IncWrites()
+	s.value = append(s.value, value)
+	s.DecWrites()
+}
+
+func (s *stringsRef) AppendAll(values []string) {
+	s.IncWrites()
+	s.value = append(s.value, values...)
+	s.DecWrites()
+}
+
+func (s *stringsRef) Reset(v []string) {
+	s.IncWrites()
+	s.value = v
+	s.DecWrites()
+}
+
+func (s *stringsRef) Clear() {
+	s.IncWrites()
+	all := s.value[:cap(s.value)]
+	for i := range all {
+		all[i] = ""
+	}
+	s.value = all[:0]
+	s.DecWrites()
+}
+
+// Times is a checked time.Time slice.
+type Times interface {
+	ReadWriteRef
+
+	Get() []time.Time
+	Cap() int
+	Len() int
+	Resize(size int)
+	Append(value time.Time)
+	AppendAll(values []time.Time)
+	Reset(v []time.Time)
+
+	// Clear zeroes the values up to the capacity and resizes to zero so
+	// that the backing array no longer retains references.
+	Clear()
+}
+
+type timesRef struct {
+	RefCount
+
+	value []time.Time
+}
+
+// NewTimes returns a new checked time.Time slice.
+func NewTimes(value []time.Time) Times {
+	s := &timesRef{value: value}
+	s.trackCensus("checked.Times")
+	if sampleLeakDetection() {
+		s.trackObject(s.value)
+	}
+	return s
+}
+
+func (s *timesRef) Get() []time.Time {
+	s.IncReads()
+	v := s.value
+	s.DecReads()
+	return v
+}
+
+func (s *timesRef) Cap() int {
+	s.IncReads()
+	v := cap(s.value)
+	s.DecReads()
+	return v
+}
+
+// UncheckedCap returns the capacity without checking the refs, pools use it
+// to size the slices they hold without taking refs on them.
+func (s *timesRef) UncheckedCap() int {
+	return cap(s.value)
+}
+
+func (s *timesRef) Len() int {
+	s.IncReads()
+	v := len(s.value)
+	s.DecReads()
+	return v
+}
+
+func (s *timesRef) Resize(size int) {
+	s.IncWrites()
+	s.value = s.value[:size]
+	s.DecWrites()
+}
+
+func (s *timesRef) Append(value time.Time) {
+	s.IncWrites()
+	s.value = append(s.value, value)
+	s.DecWrites()
+}
+
+func (s *timesRef) AppendAll(values []time.Time) {
+	s.IncWrites()
+	s.value = append(s.value, values...)
+	s.DecWrites()
+}
+
+func (s *timesRef) Reset(v []time.Time) {
+	s.IncWrites()
+	s.value = v
+	s.DecWrites()
+}
+
+func (s *timesRef) Clear() {
+	s.IncWrites()
+	all := s.value[:cap(s.value)]
+	for i := range all {
+		all[i] = time.Time{}
+	}
+	s.value = all[:0]
+	s.DecWrites()
+}
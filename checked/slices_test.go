@@ -0,0 +1,97 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package checked
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInt64s(t *testing.T) {
+	raw := make([]int64, 3, 5)
+	copy(raw, []int64{1, 2, 3})
+
+	s := NewInt64s(raw)
+	s.IncRef()
+
+	assert.Equal(t, []int64{1, 2, 3}, s.Get())
+	assert.Equal(t, 3, s.Len())
+	assert.Equal(t, 5, s.Cap())
+
+	s.Append(4)
+	s.AppendAll([]int64{5, 6})
+	assert.Equal(t, []int64{1, 2, 3, 4, 5, 6}, s.Get())
+
+	s.Resize(4)
+	assert.Equal(t, []int64{1, 2, 3, 4}, s.Get())
+
+	s.Reset([]int64{7})
+	assert.Equal(t, []int64{7}, s.Get())
+
+	s.DecRef()
+
+	finalizerCalls := 0
+	s.SetFinalizer(FinalizerFn(func() {
+		finalizerCalls++
+	}))
+
+	s.Finalize()
+	assert.Equal(t, 1, finalizerCalls)
+}
+
+func TestStringsClear(t *testing.T) {
+	raw := make([]string, 2, 3)
+	copy(raw, []string{"a", "b"})
+
+	s := NewStrings(raw)
+	s.IncRef()
+	s.Append("c")
+	s.Resize(1)
+	s.Clear()
+	assert.Equal(t, 0, s.Len())
+	assert.Equal(t, 3, s.Cap())
+	s.DecRef()
+
+	// Cleared past the length up to the capacity.
+	assert.Equal(t, []string{"", "", ""}, raw[:3])
+}
+
+func TestSlicesAccessWithoutRef(t *testing.T) {
+	var panics int
+	SetPanicFn(func(e error) {
+		panics++
+	})
+	defer ResetPanicFn()
+
+	for _, fn := range []func(){
+		func() { NewUint64s(nil).Append(1) },
+		func() { NewInts(nil).Append(1) },
+		func() { NewStrings(nil).Append("a") },
+		func() { NewTimes(nil).Append(time.Time{}) },
+		func() { NewStrings(nil).Clear() },
+	} {
+		panics = 0
+		fn()
+		assert.True(t, panics > 0)
+	}
+}
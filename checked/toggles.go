@@ -0,0 +1,132 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package checked
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+)
+
+const togglesPath = "/debug/checked/toggles"
+
+// Toggles is the process wide state of the checked debugging which can be
+// flipped on a live process.
+type Toggles struct {
+	Tracebacks      bool `json:"tracebacks"`
+	LeakDetection   bool `json:"leakDetection"`
+	LeakSampleEvery int  `json:"leakSampleEvery"`
+	LeakStacks      bool `json:"leakStacks"`
+	Ownership       bool `json:"ownership"`
+	RefCensus       bool `json:"refCensus"`
+}
+
+// CurrentToggles returns the current state of the checked debugging.
+func CurrentToggles() Toggles {
+	return Toggles{
+		Tracebacks:      tracebacksEnabled(),
+		LeakDetection:   flagEnabled(&leakDetectionFlag),
+		LeakSampleEvery: int(atomic.LoadUint64(&leakDetectionSampleEvery)),
+		LeakStacks:      flagEnabled(&leakDetectionStacks),
+		Ownership:       flagEnabled(&ownershipFlag),
+		RefCensus:       refCensusEnabled(),
+	}
+}
+
+// RegisterTogglesHandler registers the toggles handler with the given http
+// mux, the handler returns the current toggles as JSON and on POST first
+// sets the toggles given as form values, for instance tracebacks=true.
+func RegisterTogglesHandler(mux *http.ServeMux) {
+	mux.Handle(togglesPath, togglesHandler())
+}
+
+var toggleFlags = map[string]*int32{
+	"tracebacks":    &traceback,
+	"leakDetection": &leakDetectionFlag,
+	"leakStacks":    &leakDetectionStacks,
+	"ownership":     &ownershipFlag,
+	"refCensus":     &refCensusFlag,
+}
+
+func togglesHandler() http.Handler {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			if err := setToggles(r); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(CurrentToggles()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+	return http.HandlerFunc(h)
+}
+
+// setToggles validates all the toggles of a request before setting any.
+func setToggles(r *http.Request) error {
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+
+	var (
+		flags       = make(map[*int32]bool)
+		sampleEvery int
+	)
+	for name, values := range r.Form {
+		value := values[len(values)-1]
+		if name == "leakSampleEvery" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid leakSampleEvery '%s'", value)
+			}
+			sampleEvery = n
+			continue
+		}
+
+		flag, ok := toggleFlags[name]
+		if !ok {
+			return fmt.Errorf("unknown toggle '%s'", name)
+		}
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid toggle %s '%s'", name, value)
+		}
+		flags[flag] = enabled
+	}
+
+	if sampleEvery > 0 {
+		SetLeakDetectionSampleEvery(sampleEvery)
+	}
+	for flag, enabled := range flags {
+		setFlag(flag, enabled)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package checked
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func togglesRequest(t *testing.T, method string, form url.Values) (int, Toggles) {
+	mux := http.NewServeMux()
+	RegisterTogglesHandler(mux)
+
+	req := httptest.NewRequest(method, togglesPath, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	var toggles Toggles
+	if w.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &toggles))
+	}
+	return w.Code, toggles
+}
+
+func TestTogglesHandler(t *testing.T) {
+	defer DisableTracebacks()
+	defer DisableLeakDetection()
+	defer SetLeakDetectionSampleEvery(defaultLeakSampleEvery)
+
+	code, toggles := togglesRequest(t, http.MethodGet, nil)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, CurrentToggles(), toggles)
+
+	code, toggles = togglesRequest(t, http.MethodPost, url.Values{
+		"tracebacks":      []string{"true"},
+		"leakDetection":   []string{"true"},
+		"leakSampleEvery": []string{"100"},
+	})
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, Toggles{
+		Tracebacks:      true,
+		LeakDetection:   true,
+		LeakSampleEvery: 100,
+	}, toggles)
+	assert.True(t, tracebacksEnabled())
+
+	code, toggles = togglesRequest(t, http.MethodPost, url.Values{
+		"tracebacks": []string{"false"},
+	})
+	require.Equal(t, http.StatusOK, code)
+	assert.False(t, toggles.Tracebacks)
+	assert.True(t, toggles.LeakDetection)
+}
+
+func TestTogglesHandlerInvalid(t *testing.T) {
+	for _, form := range []url.Values{
+		{"unknown": []string{"true"}},
+		{"tracebacks": []string{"maybe"}},
+		{"leakSampleEvery": []string{"0"}},
+		{"tracebacks": []string{"true"}, "leakDetection": []string{"maybe"}},
+	} {
+		code, _ := togglesRequest(t, http.MethodPost, form)
+		assert.Equal(t, http.StatusBadRequest, code)
+	}
+
+	// Nothing is set unless the whole request is valid.
+	assert.False(t, tracebacksEnabled())
+
+	code, _ := togglesRequest(t, http.MethodDelete, nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+}
@@ -86,6 +86,33 @@ type Write interface {
 	NumWriters() int
 }
 
+// Owned is an entity that checks references are only used through the
+// tokens of their live holders, references taken with IncRefOwned must be
+// released with DecRefOwned. Each holder gets its own token, a token moved
+// or released is stale and reads, writes, moves and releases through it are
+// rejected. RefCount and the entities embedding it implement Owned.
+type Owned interface {
+	// IncRefOwned increments the ref count to this entity and returns a
+	// token for the new holder of the reference.
+	IncRefOwned() OwnerToken
+
+	// MoveRefOwned signals a move of the ref held through a token to this
+	// entity and returns a token for the new holder.
+	MoveRefOwned(from OwnerToken) OwnerToken
+
+	// DecRefOwned decrements the ref count held through a token to this
+	// entity.
+	DecRefOwned(token OwnerToken)
+
+	// IncReadsOwned increments the reads count to this entity through a
+	// token, the reads are finished with DecReads.
+	IncReadsOwned(token OwnerToken)
+
+	// IncWritesOwned increments the writes count to this entity through a
+	// token, the writes are finished with DecWrites.
+	IncWritesOwned(token OwnerToken)
+}
+
 // ReadWriteRef is an entity that checks ref counts, reads and writes.
 type ReadWriteRef interface {
 	Ref
@@ -0,0 +1,330 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/m3db/m3x/clock"
+	"github.com/m3db/m3x/log"
+
+	"github.com/uber-go/tally"
+)
+
+const (
+	// The sliding window is split into slots that are rotated out one
+	// at a time as the window advances.
+	adaptiveWindowSlots = 10
+)
+
+// adaptiveResizeFn applies a new size to a pool.
+type adaptiveResizeFn func(size int)
+
+// adaptiveFreeFn returns the number of free objects of a pool.
+type adaptiveFreeFn func() int
+
+// adaptiveSizer observes the get on empty and put on full rates of a pool
+// over a sliding window and resizes the pool within its min and max bounds.
+// The pool grows when either rate exceeds the grow threshold and shrinks by
+// the number of objects that sat idle for the whole window when neither
+// a get on empty nor a put on full occurred. The window is advanced by gets
+// and puts as well as by a ticker so that idle pools shrink too.
+type adaptiveSizer struct {
+	sync.Mutex
+
+	nowFn         clock.NowFn
+	minSize       int
+	maxSize       int
+	slotNanos     int64
+	growThreshold float64
+	stepFactor    float64
+	resizeFn      adaptiveResizeFn
+	freeFn        adaptiveFreeFn
+	logger        log.Logger
+	metrics       adaptiveSizerMetrics
+	stopped       chan struct{}
+	stopOnce      sync.Once
+
+	size       int64
+	nextRotate int64
+
+	// Counters for the current slot.
+	gets      int64
+	misses    int64
+	puts      int64
+	overflows int64
+	minFree   int64
+
+	slots  []adaptiveWindowSlot
+	idx    int
+	filled int
+}
+
+type adaptiveWindowSlot struct {
+	gets      int64
+	misses    int64
+	puts      int64
+	overflows int64
+	minFree   int64
+}
+
+type adaptiveSizerMetrics struct {
+	grow   tally.Counter
+	shrink tally.Counter
+	size   tally.Gauge
+}
+
+func newAdaptiveSizer(
+	size int,
+	opts ObjectPoolOptions,
+	resizeFn adaptiveResizeFn,
+	freeFn adaptiveFreeFn,
+) *adaptiveSizer {
+	var (
+		aopts   = opts.AdaptiveSizeOptions()
+		iopts   = opts.InstrumentOptions()
+		scope   = iopts.MetricsScope()
+		minSize = aopts.MinSize()
+		maxSize = aopts.MaxSize()
+	)
+	if minSize <= 0 || minSize > size {
+		minSize = size
+	}
+	if maxSize < size {
+		maxSize = size
+	}
+
+	s := &adaptiveSizer{
+		nowFn:         aopts.NowFn(),
+		minSize:       minSize,
+		maxSize:       maxSize,
+		slotNanos:     int64(aopts.Window()) / adaptiveWindowSlots,
+		growThreshold: aopts.GrowThreshold(),
+		stepFactor:    aopts.StepFactor(),
+		resizeFn:      resizeFn,
+		freeFn:        freeFn,
+		logger:        iopts.Logger(),
+		metrics: adaptiveSizerMetrics{
+			grow: scope.Tagged(map[string]string{
+				"direction": "grow",
+			}).Counter("resize"),
+			shrink: scope.Tagged(map[string]string{
+				"direction": "shrink",
+			}).Counter("resize"),
+			size: scope.Gauge("adaptive-size"),
+		},
+		stopped: make(chan struct{}),
+		size:    int64(size),
+		minFree: math.MaxInt64,
+		slots:   make([]adaptiveWindowSlot, adaptiveWindowSlots),
+	}
+	s.nextRotate = s.nowFn().UnixNano() + s.slotNanos
+	s.metrics.size.Update(float64(size))
+
+	return s
+}
+
+// start advances the window every slot in the background until stopped.
+func (s *adaptiveSizer) start() {
+	if s.slotNanos <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(s.slotNanos))
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.tryRotate()
+			case <-s.stopped:
+				return
+			}
+		}
+	}()
+}
+
+// stop stops advancing the window in the background, used when a pool is
+// dropped.
+func (s *adaptiveSizer) stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopped)
+	})
+}
+
+// currentSize returns the current target size of the pool.
+func (s *adaptiveSizer) currentSize() int {
+	return int(atomic.LoadInt64(&s.size))
+}
+
+// recordGet records a get and the number of free objects left after it.
+func (s *adaptiveSizer) recordGet(miss bool, free int) {
+	atomic.AddInt64(&s.gets, 1)
+	if miss {
+		atomic.AddInt64(&s.misses, 1)
+	}
+	for {
+		curr := atomic.LoadInt64(&s.minFree)
+		if int64(free) >= curr ||
+			atomic.CompareAndSwapInt64(&s.minFree, curr, int64(free)) {
+			break
+		}
+	}
+	s.tryRotate()
+}
+
+// recordPut records a put.
+func (s *adaptiveSizer) recordPut(overflow bool) {
+	atomic.AddInt64(&s.puts, 1)
+	if overflow {
+		atomic.AddInt64(&s.overflows, 1)
+	}
+	s.tryRotate()
+}
+
+func (s *adaptiveSizer) tryRotate() {
+	now := s.nowFn().UnixNano()
+	if now < atomic.LoadInt64(&s.nextRotate) {
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	// Double check now holding the lock in case another caller rotated.
+	next := atomic.LoadInt64(&s.nextRotate)
+	if now < next {
+		return
+	}
+
+	// Rotate out every slot that elapsed since the last rotation, the slots
+	// skipped saw no gets or puts so their objects all sat idle.
+	rotate := (now-next)/s.slotNanos + 1
+	atomic.StoreInt64(&s.nextRotate, next+rotate*s.slotNanos)
+
+	free := int64(s.freeFn())
+	minFree := atomic.SwapInt64(&s.minFree, math.MaxInt64)
+	if free < minFree {
+		minFree = free
+	}
+	s.rotateWithLock(adaptiveWindowSlot{
+		gets:      atomic.SwapInt64(&s.gets, 0),
+		misses:    atomic.SwapInt64(&s.misses, 0),
+		puts:      atomic.SwapInt64(&s.puts, 0),
+		overflows: atomic.SwapInt64(&s.overflows, 0),
+		minFree:   minFree,
+	})
+	for i := int64(1); i < rotate && i <= int64(len(s.slots)); i++ {
+		s.rotateWithLock(adaptiveWindowSlot{minFree: free})
+	}
+
+	// Only make decisions once a full window has been observed.
+	if s.filled == len(s.slots) {
+		s.evaluateWithLock()
+	}
+}
+
+func (s *adaptiveSizer) rotateWithLock(slot adaptiveWindowSlot) {
+	s.slots[s.idx] = slot
+	s.idx = (s.idx + 1) % len(s.slots)
+	if s.filled < len(s.slots) {
+		s.filled++
+	}
+}
+
+func (s *adaptiveSizer) evaluateWithLock() {
+	var (
+		window  adaptiveWindowSlot
+		minFree = int64(math.MaxInt64)
+	)
+	for _, slot := range s.slots {
+		window.gets += slot.gets
+		window.misses += slot.misses
+		window.puts += slot.puts
+		window.overflows += slot.overflows
+		if slot.minFree < minFree {
+			minFree = slot.minFree
+		}
+	}
+
+	var missRate, overflowRate float64
+	if window.gets > 0 {
+		missRate = float64(window.misses) / float64(window.gets)
+	}
+	if window.puts > 0 {
+		overflowRate = float64(window.overflows) / float64(window.puts)
+	}
+
+	var (
+		size = s.currentSize()
+		step = int(math.Ceil(float64(size) * s.stepFactor))
+		next = size
+	)
+	if step < 1 {
+		step = 1
+	}
+
+	switch {
+	case missRate > s.growThreshold || overflowRate > s.growThreshold:
+		next = size + step
+		if next > s.maxSize {
+			next = s.maxSize
+		}
+	case window.misses == 0 && window.overflows == 0 &&
+		minFree != math.MaxInt64 && minFree > 0:
+		// Objects that were never taken during the whole window are idle.
+		if int64(step) > minFree {
+			step = int(minFree)
+		}
+		next = size - step
+		if next < s.minSize {
+			next = s.minSize
+		}
+	}
+
+	if next == size {
+		return
+	}
+
+	if next > size {
+		s.metrics.grow.Inc(1)
+	} else {
+		s.metrics.shrink.Inc(1)
+	}
+	s.metrics.size.Update(float64(next))
+	s.logger.Infof("object pool resized from %d to %d, "+
+		"get on empty rate=%.4f, put on full rate=%.4f, min free=%d",
+		size, next, missRate, overflowRate, minFree)
+
+	atomic.StoreInt64(&s.size, int64(next))
+	s.resizeFn(next)
+
+	// Start a fresh window so decisions are not based on the old size.
+	for i := range s.slots {
+		s.slots[i] = adaptiveWindowSlot{}
+	}
+	s.idx = 0
+	s.filled = 0
+}
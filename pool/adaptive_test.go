@@ -0,0 +1,222 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/m3db/m3x/instrument"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func newTestAdaptivePool(
+	t *testing.T,
+	size int,
+	aopts AdaptiveSizeOptions,
+) (*objectPool, tally.TestScope, func(time.Duration)) {
+	now := time.Now()
+	scope := tally.NewTestScope("", nil)
+	opts := NewObjectPoolOptions().
+		SetSize(size).
+		SetInstrumentOptions(instrument.NewOptions().SetMetricsScope(scope)).
+		SetAdaptiveSizeOptions(aopts.
+			SetWindow(10 * time.Second).
+			SetNowFn(func() time.Time {
+				return now
+			}))
+
+	pool, ok := NewObjectPool(opts).(*objectPool)
+	require.True(t, ok)
+	pool.Init(func() interface{} {
+		return new(int)
+	})
+
+	return pool, scope, func(d time.Duration) {
+		now = now.Add(d)
+	}
+}
+
+func TestAdaptiveObjectPoolGrowsOnMisses(t *testing.T) {
+	pool, scope, advance := newTestAdaptivePool(t, 4, NewAdaptiveSizeOptions().
+		SetMinSize(2).
+		SetMaxSize(8).
+		SetStepFactor(0.5))
+
+	assert.Equal(t, 8, cap(pool.values))
+
+	for i := 0; i < adaptiveWindowSlots; i++ {
+		advance(time.Second)
+
+		values := make([]interface{}, 0, 8)
+		for j := 0; j < 8; j++ {
+			values = append(values, pool.Get())
+		}
+		for _, v := range values {
+			pool.Put(v)
+		}
+	}
+
+	assert.Equal(t, 6, pool.currentSize())
+	assert.Equal(t, 6, len(pool.values))
+
+	counters := scope.Snapshot().Counters()
+	assert.Equal(t, int64(1), counters["resize+direction=grow"].Value())
+}
+
+func TestAdaptiveObjectPoolShrinksWhenIdle(t *testing.T) {
+	pool, scope, advance := newTestAdaptivePool(t, 8, NewAdaptiveSizeOptions().
+		SetMinSize(2).
+		SetMaxSize(8).
+		SetStepFactor(0.5))
+
+	for i := 0; i < adaptiveWindowSlots; i++ {
+		advance(time.Second)
+
+		a, b := pool.Get(), pool.Get()
+		pool.Put(a)
+		pool.Put(b)
+	}
+
+	assert.Equal(t, 4, pool.currentSize())
+	assert.Equal(t, 4, len(pool.values))
+
+	counters := scope.Snapshot().Counters()
+	assert.Equal(t, int64(1), counters["resize+direction=shrink"].Value())
+}
+
+func TestAdaptiveObjectPoolShrinksWithoutTraffic(t *testing.T) {
+	pool, _, advance := newTestAdaptivePool(t, 8, NewAdaptiveSizeOptions().
+		SetMinSize(2).
+		SetMaxSize(8).
+		SetStepFactor(0.5))
+
+	// The ticker advances the window of a pool with no gets or puts.
+	advance(10 * time.Second)
+	pool.adaptive.tryRotate()
+
+	assert.Equal(t, 4, pool.currentSize())
+	assert.Equal(t, 4, len(pool.values))
+}
+
+func TestAdaptiveObjectPoolRotatesElapsedSlots(t *testing.T) {
+	pool, scope, advance := newTestAdaptivePool(t, 4, NewAdaptiveSizeOptions().
+		SetMinSize(2).
+		SetMaxSize(8).
+		SetStepFactor(0.5))
+
+	values := make([]interface{}, 0, 8)
+	for j := 0; j < 8; j++ {
+		values = append(values, pool.Get())
+	}
+	for _, v := range values {
+		pool.Put(v)
+	}
+
+	// The misses fell out of the window during the idle period.
+	advance(time.Hour)
+	pool.Put(pool.Get())
+
+	assert.Equal(t, 2, pool.currentSize())
+
+	counters := scope.Snapshot().Counters()
+	assert.Equal(t, int64(0), counters["resize+direction=grow"].Value())
+	assert.Equal(t, int64(1), counters["resize+direction=shrink"].Value())
+}
+
+func TestAdaptiveObjectPoolBounds(t *testing.T) {
+	pool, _, advance := newTestAdaptivePool(t, 4, NewAdaptiveSizeOptions().
+		SetMinSize(4).
+		SetMaxSize(4))
+
+	for i := 0; i < 3*adaptiveWindowSlots; i++ {
+		advance(time.Second)
+
+		for j := 0; j < 8; j++ {
+			pool.Put(pool.Get())
+		}
+	}
+
+	assert.Equal(t, 4, pool.currentSize())
+}
+
+func TestAdaptiveBucketizedObjectPoolBucketBounds(t *testing.T) {
+	opts := NewObjectPoolOptions().
+		SetAdaptiveSizeOptions(NewAdaptiveSizeOptions().SetMaxSize(4))
+
+	pool := NewBucketizedObjectPool([]Bucket{
+		{Capacity: 8, Count: 2, MaxCount: 16},
+		{Capacity: 16, Count: 2},
+	}, opts).(*bucketizedObjectPool)
+	pool.Init(func(capacity int) interface{} {
+		return make([]byte, 0, capacity)
+	})
+
+	small := pool.buckets()[0].pool.(*objectPool)
+	assert.Equal(t, 16, small.adaptive.maxSize)
+	assert.Equal(t, 2, small.adaptive.minSize)
+
+	large := pool.buckets()[1].pool.(*objectPool)
+	assert.Equal(t, 4, large.adaptive.maxSize)
+	assert.Equal(t, 2, large.adaptive.minSize)
+}
+
+func TestAdaptiveObjectPoolWarmsToCurrentSize(t *testing.T) {
+	opts := NewObjectPoolOptions().
+		SetSize(8).
+		SetAdaptiveSizeOptions(NewAdaptiveSizeOptions().
+			SetMinSize(2).
+			SetMaxSize(8))
+
+	pool := NewObjectPool(opts).(*objectPool)
+
+	// Shrink before warming as if the sizer ran while warming.
+	atomic.StoreInt64(&pool.adaptive.size, 2)
+	pool.Init(func() interface{} {
+		return new(int)
+	})
+
+	assert.Equal(t, 2, len(pool.values))
+}
+
+func TestAdaptiveObjectPoolUnsupportedType(t *testing.T) {
+	for _, typ := range []ObjectPoolType{ShardedObjectPoolType, SyncObjectPoolType} {
+		var errs []error
+		opts := NewObjectPoolOptions().
+			SetType(typ).
+			SetAdaptiveSizeOptions(NewAdaptiveSizeOptions()).
+			SetOnPoolAccessErrorFn(func(err error) {
+				errs = append(errs, err)
+			})
+
+		pool := NewObjectPool(opts)
+		require.Equal(t, []error{errAdaptiveChannelOnly}, errs, typ.String())
+
+		// Falls back to a channel pool honouring the adaptive options.
+		channelPool, ok := pool.(*objectPool)
+		require.True(t, ok, typ.String())
+		require.NotNil(t, channelPool.adaptive)
+	}
+}
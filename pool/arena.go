@@ -0,0 +1,232 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"unsafe"
+)
+
+const (
+	defaultArenaChunkSize = 64 << 10
+
+	// arenaPoison is the byte released memory is filled with in checked
+	// mode, eight of them read as a float64 make a NaN.
+	arenaPoison = 0xff
+
+	arenaFloatSize  = int(unsafe.Sizeof(float64(0)))
+	arenaFloatAlign = int(unsafe.Alignof(float64(0)))
+)
+
+var errArenaChunkSize = errors.New("arena chunk size must be positive")
+
+// ArenaOptions specify options for an arena.
+type ArenaOptions struct {
+	// ChunkSize is the size of the chunks slices are carved from, slices
+	// larger than a chunk get a chunk of their own which is released on
+	// reset. Defaults to 64KiB.
+	ChunkSize int
+
+	// BytesPool if set is where chunks are borrowed from, otherwise chunks
+	// are mapped directly from the system.
+	BytesPool BytesPool
+
+	// Checked fills released memory with a poison byte on reset and panics
+	// when memory about to be handed out again has been written to since,
+	// which catches slices used after the arena was reset.
+	Checked bool
+}
+
+type arenaChunk struct {
+	bytes []byte
+	used  int
+}
+
+type arena struct {
+	opts ArenaOptions
+
+	chunks    []*arenaChunk
+	current   int
+	large     []*arenaChunk
+	allocated int
+}
+
+// NewArena creates a new arena.
+func NewArena(opts ArenaOptions) (Arena, error) {
+	if opts.ChunkSize == 0 {
+		opts.ChunkSize = defaultArenaChunkSize
+	}
+	if opts.ChunkSize < 0 {
+		return nil, errArenaChunkSize
+	}
+	return &arena{opts: opts}, nil
+}
+
+func (a *arena) Bytes(capacity int) []byte {
+	if capacity < 1 {
+		return nil
+	}
+	return a.alloc(capacity, 1)[0:0:capacity]
+}
+
+func (a *arena) Floats(capacity int) []float64 {
+	if capacity < 1 {
+		return nil
+	}
+
+	b := a.alloc(capacity*arenaFloatSize, arenaFloatAlign)
+
+	var result []float64
+	header := (*reflect.SliceHeader)(unsafe.Pointer(&result))
+	header.Data = uintptr(unsafe.Pointer(&b[0]))
+	header.Len = 0
+	header.Cap = capacity
+	return result
+}
+
+func (a *arena) Allocated() int {
+	return a.allocated
+}
+
+func (a *arena) alloc(n, align int) []byte {
+	a.allocated += n
+
+	// Leave room for the alignment so that a large slice always fits its
+	// own chunk whatever the alignment of the chunk is.
+	if n+align-1 > a.opts.ChunkSize {
+		c := a.newChunk(n + align - 1)
+		a.large = append(a.large, c)
+		return a.carve(c, n, align)
+	}
+
+	for ; a.current < len(a.chunks); a.current++ {
+		if b := a.carve(a.chunks[a.current], n, align); b != nil {
+			return b
+		}
+	}
+
+	c := a.newChunk(a.opts.ChunkSize)
+	a.chunks = append(a.chunks, c)
+	return a.carve(c, n, align)
+}
+
+// carve returns the next n bytes of the chunk at the given alignment, or nil
+// if they do not fit in what is left of the chunk.
+func (a *arena) carve(c *arenaChunk, n, align int) []byte {
+	start := c.used
+	if rem := int(uintptr(unsafe.Pointer(&c.bytes[0]))+uintptr(start)) % align; rem != 0 {
+		start += align - rem
+	}
+
+	end := start + n
+	if end > len(c.bytes) {
+		return nil
+	}
+
+	b := c.bytes[start:end:end]
+	if a.opts.Checked {
+		checkArenaPoison(b)
+	}
+
+	c.used = end
+	return b
+}
+
+func (a *arena) newChunk(size int) *arenaChunk {
+	var b []byte
+	if a.opts.BytesPool != nil {
+		b = a.opts.BytesPool.Get(size)
+		b = b[:cap(b)]
+	} else {
+		var err error
+		if b, err = mmap(size); err != nil {
+			panic("mmap() error: " + err.Error())
+		}
+	}
+
+	if a.opts.Checked {
+		poison(b)
+	}
+
+	return &arenaChunk{bytes: b}
+}
+
+func (a *arena) releaseChunk(c *arenaChunk) error {
+	if a.opts.BytesPool != nil {
+		a.opts.BytesPool.Put(c.bytes)
+		return nil
+	}
+	return munmap(c.bytes)
+}
+
+func (a *arena) Reset() {
+	for _, c := range a.chunks {
+		if a.opts.Checked {
+			poison(c.bytes[:c.used])
+		}
+		c.used = 0
+	}
+
+	for _, c := range a.large {
+		if err := a.releaseChunk(c); err != nil {
+			panic("munmap() error: " + err.Error())
+		}
+	}
+
+	a.large = nil
+	a.current = 0
+	a.allocated = 0
+}
+
+func (a *arena) Close() error {
+	var firstErr error
+	for _, chunks := range [][]*arenaChunk{a.chunks, a.large} {
+		for _, c := range chunks {
+			if err := a.releaseChunk(c); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	a.chunks = nil
+	a.large = nil
+	a.current = 0
+	a.allocated = 0
+
+	return firstErr
+}
+
+func poison(b []byte) {
+	for i := range b {
+		b[i] = arenaPoison
+	}
+}
+
+func checkArenaPoison(b []byte) {
+	for i := range b {
+		if b[i] != arenaPoison {
+			panic(fmt.Sprintf(
+				"arena memory written after reset: %p offset=%d", &b[0], i))
+		}
+	}
+}
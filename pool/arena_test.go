@@ -0,0 +1,136 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	"math"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArenaBumpAllocates(t *testing.T) {
+	a, err := NewArena(ArenaOptions{ChunkSize: 64})
+	require.NoError(t, err)
+	defer a.Close()
+
+	first := a.Bytes(10)
+	second := a.Bytes(10)
+	require.Equal(t, 0, len(first))
+	require.Equal(t, 10, cap(first))
+
+	// Slices are carved one after another from the same chunk.
+	assert.Equal(t, uintptr(10),
+		uintptr(unsafe.Pointer(&second[:1][0]))-uintptr(unsafe.Pointer(&first[:1][0])))
+
+	// Appending past the capacity never overwrites the next slice.
+	first = append(first, make([]byte, 11)...)
+	second = append(second, 'x')
+	assert.Equal(t, byte(0), first[10])
+
+	floats := a.Floats(4)
+	require.Equal(t, 4, cap(floats))
+	assert.Equal(t, uintptr(0), uintptr(unsafe.Pointer(&floats[:1][0]))%8)
+	floats = append(floats, 1, 2, 3, 4)
+	assert.Equal(t, []float64{1, 2, 3, 4}, floats)
+
+	assert.Equal(t, 52, a.Allocated())
+	assert.Nil(t, a.Bytes(0))
+	assert.Nil(t, a.Floats(0))
+}
+
+func TestArenaResetReusesChunks(t *testing.T) {
+	a, err := NewArena(ArenaOptions{ChunkSize: 64})
+	require.NoError(t, err)
+	defer a.Close()
+
+	first := a.Bytes(48)
+	a.Bytes(48)
+	a.Bytes(128)
+
+	impl := a.(*arena)
+	require.Equal(t, 2, len(impl.chunks))
+	require.Equal(t, 1, len(impl.large))
+
+	a.Reset()
+	assert.Equal(t, 0, a.Allocated())
+	assert.Equal(t, 0, len(impl.large))
+
+	again := a.Bytes(48)
+	assert.True(t, &first[:1][0] == &again[:1][0])
+	require.Equal(t, 2, len(impl.chunks))
+}
+
+func TestArenaBytesPoolChunks(t *testing.T) {
+	pool := newCountingBytesPool()
+	a, err := NewArena(ArenaOptions{ChunkSize: 64, BytesPool: pool})
+	require.NoError(t, err)
+
+	a.Bytes(32)
+	a.Floats(32)
+	assert.Equal(t, 2, pool.outstanding)
+
+	a.Reset()
+	assert.Equal(t, 1, pool.outstanding)
+
+	require.NoError(t, a.Close())
+	assert.Equal(t, 0, pool.outstanding)
+}
+
+func TestArenaCheckedPoisonsOnReset(t *testing.T) {
+	a, err := NewArena(ArenaOptions{ChunkSize: 64, Checked: true})
+	require.NoError(t, err)
+	defer a.Close()
+
+	b := a.Bytes(8)[:8]
+	f := a.Floats(1)[:1]
+	b[0], f[0] = 'x', 42
+
+	a.Reset()
+	assert.Equal(t, byte(arenaPoison), b[0])
+	assert.True(t, math.IsNaN(f[0]))
+
+	// Writing to a slice after reset is caught when the memory is reused.
+	b[1] = 'x'
+	assert.Panics(t, func() {
+		a.Bytes(8)
+	})
+}
+
+func TestArenaInvalidChunkSize(t *testing.T) {
+	_, err := NewArena(ArenaOptions{ChunkSize: -1})
+	assert.Equal(t, errArenaChunkSize, err)
+}
+
+func BenchmarkArenaBytes(b *testing.B) {
+	a, err := NewArena(ArenaOptions{})
+	require.NoError(b, err)
+	defer a.Close()
+
+	for n := 0; n < b.N; n++ {
+		if n%1024 == 0 {
+			a.Reset()
+		}
+		a.Bytes(64)
+	}
+}
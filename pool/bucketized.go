@@ -21,24 +21,41 @@
 package pool
 
 import (
+	"context"
 	"fmt"
 	"sort"
+	"sync"
+	"sync/atomic"
+
+	xlog "github.com/m3db/m3x/log"
 
 	"github.com/uber-go/tally"
 )
 
 type bucketPool struct {
+	bucket   Bucket
 	capacity int
 	pool     ObjectPool
 }
 
-type bucketizedObjectPool struct {
-	sizesAsc          []Bucket
+// bucketLayout is an immutable set of buckets, it is swapped as a whole
+// when the buckets are updated so gets and puts never observe a partially
+// applied layout.
+type bucketLayout struct {
 	buckets           []bucketPool
 	maxBucketCapacity int
-	opts              ObjectPoolOptions
-	alloc             BucketizedAllocator
-	maxAlloc          tally.Counter
+}
+
+type bucketizedObjectPool struct {
+	sync.Mutex
+
+	sizesAsc []Bucket
+	layout   atomic.Value
+	opts     ObjectPoolOptions
+	alloc    BucketizedAllocator
+	maxAlloc tally.Counter
+	overflow *overflowCache
+	profiler *capacityProfiler
 }
 
 // NewBucketizedObjectPool creates a bucketized object pool
@@ -47,72 +64,228 @@ func NewBucketizedObjectPool(sizes []Bucket, opts ObjectPoolOptions) BucketizedO
 		opts = NewObjectPoolOptions()
 	}
 
+	iopts := opts.InstrumentOptions()
+
+	p := &bucketizedObjectPool{
+		opts:     opts,
+		sizesAsc: sortedBuckets(sizes),
+		maxAlloc: iopts.MetricsScope().Counter("alloc-max"),
+		overflow: newOverflowCache(opts, iopts.MetricsScope()),
+	}
+	if profiler, ok := opts.CapacityProfiler().(*capacityProfiler); ok {
+		p.profiler = profiler
+	}
+	if tracker := newPoolTrackerFromOptions(opts); tracker != nil {
+		// All buckets own objects together since objects may be put back
+		// to a different bucket than the one they were taken from.
+		p.opts = opts.SetObjectTracker(tracker)
+	}
+	p.layout.Store(&bucketLayout{})
+
+	registerPool(opts, p)
+
+	return p
+}
+
+func sortedBuckets(sizes []Bucket) []Bucket {
 	sizesAsc := make([]Bucket, len(sizes))
 	copy(sizesAsc, sizes)
 	sort.Sort(BucketByCapacity(sizesAsc))
+	return sizesAsc
+}
 
-	var maxBucketCapacity int
-	if len(sizesAsc) != 0 {
-		maxBucketCapacity = sizesAsc[len(sizesAsc)-1].Capacity
+func (p *bucketizedObjectPool) Init(alloc BucketizedAllocator) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.alloc = alloc
+	p.layout.Store(p.newLayoutWithLock(nil))
+
+	if p.overflow != nil {
+		// Size an object on init so that objects which cannot be sized are
+		// reported once on init rather than on their first put.
+		if err := p.overflow.sizer.check(alloc(0)); err != nil {
+			fn := p.opts.OnPoolAccessErrorFn()
+			fn(err)
+		}
 	}
+}
 
-	iopts := opts.InstrumentOptions()
+func (p *bucketizedObjectPool) UpdateBuckets(sizes []Bucket) {
+	p.Lock()
+	defer p.Unlock()
 
-	return &bucketizedObjectPool{
-		opts:              opts,
-		sizesAsc:          sizesAsc,
-		maxBucketCapacity: maxBucketCapacity,
-		maxAlloc:          iopts.MetricsScope().Counter("alloc-max"),
+	p.sizesAsc = sortedBuckets(sizes)
+	if p.alloc == nil {
+		// Not initialized yet, the buckets are applied on init.
+		return
 	}
+
+	prev := p.layout.Load().(*bucketLayout)
+	p.layout.Store(p.newLayoutWithLock(prev))
 }
 
-func (p *bucketizedObjectPool) Init(alloc BucketizedAllocator) {
-	buckets := make([]bucketPool, len(p.sizesAsc))
-	for i := range p.sizesAsc {
-		size := p.sizesAsc[i].Count
-		capacity := p.sizesAsc[i].Capacity
+// newLayoutWithLock creates a layout for the current sizes reusing the pools
+// of unchanged buckets from the previous layout. Buckets that are resized or
+// removed are dropped and stop their background work, objects checked out from them are
+// returned to the bucket with the largest capacity they can still serve.
+// Object tracking is shared by all buckets so such objects are still owned.
+func (p *bucketizedObjectPool) newLayoutWithLock(prev *bucketLayout) *bucketLayout {
+	existing := make(map[Bucket]ObjectPool)
+	if prev != nil {
+		for _, b := range prev.buckets {
+			existing[b.bucket] = b.pool
+		}
+	}
 
-		opts := p.opts.SetSize(size)
+	layout := &bucketLayout{buckets: make([]bucketPool, len(p.sizesAsc))}
+	for i, bucket := range p.sizesAsc {
+		layout.buckets[i].bucket = bucket
+		layout.buckets[i].capacity = bucket.Capacity
+		if pool, ok := existing[bucket]; ok {
+			layout.buckets[i].pool = pool
+			delete(existing, bucket)
+			continue
+		}
+		layout.buckets[i].pool = p.newBucketPool(bucket)
+	}
+
+	for _, pool := range existing {
+		if stopper, ok := pool.(backgroundStopper); ok {
+			stopper.stopBackground()
+		}
+	}
+
+	if len(layout.buckets) != 0 {
+		layout.maxBucketCapacity = layout.buckets[len(layout.buckets)-1].capacity
+	}
+
+	return layout
+}
+
+func (p *bucketizedObjectPool) newBucketPool(bucket Bucket) ObjectPool {
+	var (
+		alloc    = p.alloc
+		capacity = bucket.Capacity
+		opts     = p.opts.SetSize(bucket.Count).SetName("").SetCapacityProfiler(nil)
+		iopts    = opts.InstrumentOptions()
+	)
+
+	if iopts.MetricsScope() != nil {
+		opts = opts.SetInstrumentOptions(iopts.SetMetricsScope(
+			iopts.MetricsScope().Tagged(map[string]string{
+				"bucket-capacity": fmt.Sprintf("%d", capacity),
+			})))
+	}
+
+	if aopts := opts.AdaptiveSizeOptions(); aopts != nil {
+		if minCount := bucket.MinCount; minCount > 0 {
+			aopts = aopts.SetMinSize(minCount)
+		}
+		if maxCount := bucket.MaxCount; maxCount > 0 {
+			aopts = aopts.SetMaxSize(maxCount)
+		}
 		iopts := opts.InstrumentOptions()
+		opts = opts.
+			SetAdaptiveSizeOptions(aopts).
+			SetInstrumentOptions(iopts.SetLogger(iopts.Logger().WithFields(
+				xlog.NewField("bucket-capacity", capacity))))
+	}
 
-		if iopts.MetricsScope() != nil {
-			opts = opts.SetInstrumentOptions(iopts.SetMetricsScope(
-				iopts.MetricsScope().Tagged(map[string]string{
-					"bucket-capacity": fmt.Sprintf("%d", capacity),
-				})))
+	pool := NewObjectPool(opts)
+	pool.Init(func() interface{} {
+		return alloc(capacity)
+	})
+	return pool
+}
+
+// WaitReady waits for the buckets of the current layout to be ready.
+func (p *bucketizedObjectPool) WaitReady(ctx context.Context) error {
+	for _, b := range p.buckets() {
+		if err := b.pool.WaitReady(ctx); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		buckets[i].capacity = capacity
-		buckets[i].pool = NewObjectPool(opts)
-		buckets[i].pool.Init(func() interface{} {
-			return alloc(capacity)
-		})
+func (p *bucketizedObjectPool) stats() PoolStats {
+	result := PoolStats{Type: "bucketized"}
+	for _, b := range p.buckets() {
+		bucket := BucketStats{Capacity: b.capacity}
+		if reporter, ok := b.pool.(statsReporter); ok {
+			stats := reporter.stats()
+			bucket.Size = stats.Size
+			bucket.Free = stats.Free
+			bucket.GetOnEmpty = stats.GetOnEmpty
+			bucket.PutOnFull = stats.PutOnFull
+			bucket.BudgetUsed = stats.BudgetUsed
+		}
+		result.Buckets = append(result.Buckets, bucket)
+		result.Size += bucket.Size
+		result.GetOnEmpty += bucket.GetOnEmpty
+		result.PutOnFull += bucket.PutOnFull
+		result.BudgetUsed += bucket.BudgetUsed
+		if result.Free != unknownFree {
+			result.Free += bucket.Free
+		}
+		if bucket.Free == unknownFree {
+			result.Free = unknownFree
+		}
 	}
-	p.buckets = buckets
-	p.alloc = alloc
+	return result
+}
+
+func (p *bucketizedObjectPool) buckets() []bucketPool {
+	return p.layout.Load().(*bucketLayout).buckets
+}
+
+func (p *bucketizedObjectPool) capacityProfiler() CapacityProfiler {
+	if p.profiler == nil {
+		return nil
+	}
+	return p.profiler
 }
 
 func (p *bucketizedObjectPool) Get(capacity int) interface{} {
-	if capacity > p.maxBucketCapacity {
+	if p.profiler != nil {
+		p.profiler.recordGet(capacity)
+	}
+
+	layout := p.layout.Load().(*bucketLayout)
+	if capacity > layout.maxBucketCapacity {
+		if p.overflow != nil {
+			if obj := p.overflow.get(capacity); obj != nil {
+				return obj
+			}
+		}
 		p.maxAlloc.Inc(1)
 		return p.alloc(capacity)
 	}
-	for i := range p.buckets {
-		if p.buckets[i].capacity >= capacity {
-			return p.buckets[i].pool.Get()
+	for i := range layout.buckets {
+		if layout.buckets[i].capacity >= capacity {
+			return layout.buckets[i].pool.Get()
 		}
 	}
 	return p.alloc(capacity)
 }
 
 func (p *bucketizedObjectPool) Put(obj interface{}, capacity int) {
-	if capacity > p.maxBucketCapacity {
+	if p.profiler != nil {
+		p.profiler.recordPut()
+	}
+
+	layout := p.layout.Load().(*bucketLayout)
+	if capacity > layout.maxBucketCapacity {
+		if p.overflow != nil {
+			p.overflow.put(obj, capacity)
+		}
 		return
 	}
 
-	for i := len(p.buckets) - 1; i >= 0; i-- {
-		if capacity >= p.buckets[i].capacity {
-			p.buckets[i].pool.Put(obj)
+	for i := len(layout.buckets) - 1; i >= 0; i-- {
+		if capacity >= layout.buckets[i].capacity {
+			layout.buckets[i].pool.Put(obj)
 			return
 		}
 	}
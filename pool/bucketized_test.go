@@ -0,0 +1,156 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBucketizedObjectPoolUpdateBuckets(t *testing.T) {
+	pool := NewBucketizedObjectPool([]Bucket{
+		{Capacity: 8, Count: 2},
+		{Capacity: 16, Count: 2},
+	}, nil).(*bucketizedObjectPool)
+	pool.Init(func(capacity int) interface{} {
+		return make([]byte, 0, capacity)
+	})
+
+	unchanged := pool.buckets()[0].pool
+	small := pool.Get(8).([]byte)
+	large := pool.Get(16).([]byte)
+
+	// Resize the 8 bucket, drain the 16 bucket and add a 32 bucket.
+	pool.UpdateBuckets([]Bucket{
+		{Capacity: 32, Count: 1},
+		{Capacity: 8, Count: 2},
+	})
+
+	buckets := pool.buckets()
+	require.Equal(t, 2, len(buckets))
+	assert.Equal(t, 8, buckets[0].capacity)
+	assert.True(t, unchanged == buckets[0].pool)
+	assert.Equal(t, 32, buckets[1].capacity)
+	assert.Equal(t, 1, len(buckets[1].pool.(*objectPool).values))
+
+	assert.Equal(t, 32, cap(pool.Get(32).([]byte)))
+
+	// Objects checked out before the update go to buckets they can serve.
+	pool.Put(small, cap(small))
+	pool.Put(large, cap(large))
+	assert.Equal(t, 2, len(buckets[0].pool.(*objectPool).values))
+	assert.Equal(t, 0, len(buckets[1].pool.(*objectPool).values))
+
+	pool.UpdateBuckets([]Bucket{
+		{Capacity: 8, Count: 4},
+	})
+
+	buckets = pool.buckets()
+	require.Equal(t, 1, len(buckets))
+	assert.False(t, unchanged == buckets[0].pool)
+	assert.Equal(t, 4, len(buckets[0].pool.(*objectPool).values))
+
+	// Larger than the largest bucket is no longer pooled.
+	pool.Put(make([]byte, 0, 32), 32)
+	assert.Equal(t, 4, len(buckets[0].pool.(*objectPool).values))
+}
+
+func TestBucketizedObjectPoolUpdateBucketsBeforeInit(t *testing.T) {
+	pool := NewBucketizedObjectPool([]Bucket{
+		{Capacity: 8, Count: 2},
+	}, nil).(*bucketizedObjectPool)
+
+	pool.UpdateBuckets([]Bucket{
+		{Capacity: 16, Count: 1},
+	})
+	pool.Init(func(capacity int) interface{} {
+		return make([]byte, 0, capacity)
+	})
+
+	buckets := pool.buckets()
+	require.Equal(t, 1, len(buckets))
+	assert.Equal(t, 16, buckets[0].capacity)
+}
+
+func TestBucketizedObjectPoolUpdateBucketsTracked(t *testing.T) {
+	var (
+		errs    []error
+		tracker = NewObjectTracker()
+	)
+	pool := NewBucketizedObjectPool([]Bucket{
+		{Capacity: 8, Count: 2},
+		{Capacity: 16, Count: 2},
+	}, newTestTrackedPoolOptions(tracker, &errs))
+	pool.Init(func(capacity int) interface{} {
+		return make([]byte, 0, capacity)
+	})
+
+	small := pool.Get(8)
+	large := pool.Get(16)
+
+	// Resize both buckets while the objects are checked out.
+	pool.UpdateBuckets([]Bucket{
+		{Capacity: 8, Count: 4},
+		{Capacity: 16, Count: 4},
+	})
+
+	pool.Put(small, 8)
+	pool.Put(large, 16)
+	require.Empty(t, errs)
+	assert.Empty(t, tracker.Outstanding(0))
+
+	pool.Put(large, 16)
+	require.Equal(t, 1, len(errs))
+}
+
+func TestBucketizedObjectPoolUpdateBucketsStopsWarming(t *testing.T) {
+	var (
+		allocs  int64
+		release = make(chan struct{})
+	)
+	pool := NewBucketizedObjectPool([]Bucket{
+		{Capacity: 8, Count: 100},
+	}, NewObjectPoolOptions().SetInitFraction(0.1)).(*bucketizedObjectPool)
+	pool.Init(func(capacity int) interface{} {
+		if capacity == 8 && atomic.AddInt64(&allocs, 1) > 10 {
+			<-release
+		}
+		return make([]byte, 0, capacity)
+	})
+
+	dropped := pool.buckets()[0].pool
+	pool.UpdateBuckets([]Bucket{
+		{Capacity: 16, Count: 1},
+	})
+	close(release)
+
+	// The dropped bucket stops warming instead of filling up.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, dropped.WaitReady(ctx))
+	assert.True(t, atomic.LoadInt64(&allocs) <= 12)
+	assert.True(t, len(dropped.(*objectPool).values) < 100)
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	xclose "github.com/m3db/m3x/close"
+	"github.com/m3db/m3x/watch"
+)
+
+// WatchBuckets applies the bucket layouts published to a watchable to the
+// updater until the returned closer is closed, published values must be
+// either a []Bucket or a *BucketizedPoolConfiguration.
+func WatchBuckets(
+	watchable watch.Watchable,
+	updater BucketsUpdater,
+) (xclose.SimpleCloser, error) {
+	_, w, err := watchable.Watch()
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for range w.C() {
+			switch value := w.Get().(type) {
+			case []Bucket:
+				updater.UpdateBuckets(value)
+			case *BucketizedPoolConfiguration:
+				updater.UpdateBuckets(value.NewBuckets())
+			}
+		}
+	}()
+
+	return w, nil
+}
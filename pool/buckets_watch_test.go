@@ -0,0 +1,65 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/m3db/m3x/clock"
+	"github.com/m3db/m3x/watch"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchBuckets(t *testing.T) {
+	p := getBytesPool(2, []int{8})
+	p.Init()
+
+	watchable := watch.NewWatchable()
+	closer, err := WatchBuckets(watchable, p)
+	require.NoError(t, err)
+	defer closer.Close()
+
+	bucketed := p.pool.(*bucketizedObjectPool)
+	hasCapacity := func(capacity int) clock.ConditionFn {
+		return func() bool {
+			buckets := bucketed.buckets()
+			return buckets[len(buckets)-1].capacity == capacity
+		}
+	}
+
+	require.NoError(t, watchable.Update([]Bucket{
+		{Capacity: 8, Count: 2},
+		{Capacity: 16, Count: 2},
+	}))
+	require.True(t, clock.WaitUntil(hasCapacity(16), 5*time.Second))
+	assert.Equal(t, 16, cap(p.Get(16)))
+
+	require.NoError(t, watchable.Update(&BucketizedPoolConfiguration{
+		Buckets: []BucketConfiguration{
+			{Capacity: 32, Count: 1},
+		},
+	}))
+	require.True(t, clock.WaitUntil(hasCapacity(32), 5*time.Second))
+	assert.Equal(t, 1, len(bucketed.buckets()))
+}
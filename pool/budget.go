@@ -0,0 +1,233 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	"errors"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/m3db/m3x/instrument"
+
+	"github.com/uber-go/tally"
+)
+
+// MemoryBudget is a limit on the bytes retained by all the pools sharing it,
+// pools referencing a budget charge the objects they retain against it and
+// drop objects put back to them once it is exhausted, as if they were full.
+type MemoryBudget interface {
+	// Limit returns the max bytes retained across all the pools.
+	Limit() int64
+
+	// Used returns the bytes currently retained across all the pools.
+	Used() int64
+}
+
+// ObjectSizeFn returns the bytes retained by a pooled object.
+type ObjectSizeFn func(obj interface{}) int64
+
+var errObjectSizeFnRequired = errors.New("object size fn required to size pointer objects")
+
+type memoryBudget struct {
+	limit   int64
+	used    int64
+	metrics memoryBudgetMetrics
+}
+
+type memoryBudgetMetrics struct {
+	limit    tally.Gauge
+	used     tally.Gauge
+	rejected tally.Counter
+}
+
+// NewMemoryBudget creates a new memory budget of limit bytes.
+func NewMemoryBudget(limit int64, instrumentOpts instrument.Options) MemoryBudget {
+	if instrumentOpts == nil {
+		instrumentOpts = instrument.NewOptions()
+	}
+	scope := instrumentOpts.MetricsScope()
+	b := &memoryBudget{
+		limit: limit,
+		metrics: memoryBudgetMetrics{
+			limit:    scope.Gauge("memory-budget-limit"),
+			used:     scope.Gauge("memory-budget-used"),
+			rejected: scope.Counter("memory-budget-rejected"),
+		},
+	}
+	b.metrics.limit.Update(float64(limit))
+	b.metrics.used.Update(0)
+	return b
+}
+
+func (b *memoryBudget) Limit() int64 {
+	return b.limit
+}
+
+func (b *memoryBudget) Used() int64 {
+	return atomic.LoadInt64(&b.used)
+}
+
+func (b *memoryBudget) tryCharge(n int64) bool {
+	for {
+		used := atomic.LoadInt64(&b.used)
+		if used+n > b.limit {
+			b.metrics.rejected.Inc(1)
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&b.used, used, used+n) {
+			b.metrics.used.Update(float64(used + n))
+			return true
+		}
+	}
+}
+
+func (b *memoryBudget) release(n int64) {
+	b.metrics.used.Update(float64(atomic.AddInt64(&b.used, -n)))
+}
+
+// budgetAccount charges the objects retained by a single pool against a
+// memory budget, objects are charged when they enter the pool and released
+// when they leave it so their size cannot change in between.
+type budgetAccount struct {
+	budget     *memoryBudget
+	sizer      objectSizer
+	used       int64
+	usedGauge  tally.Gauge
+	overBudget tally.Counter
+}
+
+// newBudgetAccount returns nil if the options do not reference a budget.
+func newBudgetAccount(opts ObjectPoolOptions, scope tally.Scope) *budgetAccount {
+	budget, ok := opts.MemoryBudget().(*memoryBudget)
+	if !ok {
+		return nil
+	}
+	return &budgetAccount{
+		budget:     budget,
+		sizer:      newObjectSizer(opts),
+		usedGauge:  scope.Gauge("budget-used"),
+		overBudget: scope.Counter("over-budget"),
+	}
+}
+
+func (a *budgetAccount) charge(obj interface{}) bool {
+	n, ok := a.sizer.size(obj)
+	if !ok {
+		return false
+	}
+	if !a.budget.tryCharge(n) {
+		a.overBudget.Inc(1)
+		return false
+	}
+	a.usedGauge.Update(float64(atomic.AddInt64(&a.used, n)))
+	return true
+}
+
+func (a *budgetAccount) release(obj interface{}) {
+	// Only objects which could be sized were charged.
+	n, _ := a.sizer.size(obj)
+	a.budget.release(n)
+	a.usedGauge.Update(float64(atomic.AddInt64(&a.used, -n)))
+}
+
+func (a *budgetAccount) value() int64 {
+	if a == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&a.used)
+}
+
+// objectSizer sizes objects with the object size fn of the options or by
+// default with defaultObjectSize. Pools check that their objects can be
+// sized once on init, objects which cannot be sized are not retained.
+type objectSizer struct {
+	sizeFn ObjectSizeFn
+}
+
+func newObjectSizer(opts ObjectPoolOptions) objectSizer {
+	return objectSizer{sizeFn: opts.ObjectSizeFn()}
+}
+
+func (s objectSizer) size(obj interface{}) (int64, bool) {
+	if s.sizeFn != nil {
+		return s.sizeFn(obj), true
+	}
+	n, err := defaultObjectSize(obj)
+	return n, err == nil
+}
+
+// check returns an error if the object cannot be sized, pools call it with
+// the first object allocated on init so that pools of objects which cannot
+// be sized fail on init rather than on their first put.
+func (s objectSizer) check(obj interface{}) error {
+	if s.sizeFn != nil {
+		return nil
+	}
+	_, err := defaultObjectSize(obj)
+	return err
+}
+
+// defaultObjectSize returns the size of the backing array for slices or the
+// size of the value otherwise. The memory referenced by pointers, maps and
+// channels cannot be known, charging their header alone would undercount
+// them, so objects of those kinds require an explicit object size fn.
+// Slices are charged for their backing array only, not for the memory their
+// elements may reference.
+func defaultObjectSize(obj interface{}) (int64, error) {
+	v := reflect.ValueOf(obj)
+	switch v.Kind() {
+	case reflect.Slice:
+		return int64(v.Cap()) * int64(v.Type().Elem().Size()), nil
+	case reflect.Ptr, reflect.Map, reflect.Chan, reflect.UnsafePointer:
+		return 0, errObjectSizeFnRequired
+	case reflect.Invalid:
+		return 0, nil
+	}
+	return int64(v.Type().Size()), nil
+}
+
+// checkedCap is implemented by checked.Bytes and the other checked slices.
+type checkedCap interface {
+	UncheckedCap() int
+}
+
+// checkedCapObjectSize returns the size of the backing array of pooled
+// checked slices, the capacity is read without taking a ref so that sizing
+// adds no ref events to the objects entering and leaving pools.
+func checkedCapObjectSize(elemSize int64) ObjectSizeFn {
+	return func(obj interface{}) int64 {
+		return int64(obj.(checkedCap).UncheckedCap()) * elemSize
+	}
+}
+
+// withCheckedCapObjectSize sets the object size function used to charge
+// checked slices against a memory budget or the overflow cache unless one is
+// already set.
+func withCheckedCapObjectSize(opts ObjectPoolOptions, elemSize int64) ObjectPoolOptions {
+	if opts == nil {
+		opts = NewObjectPoolOptions()
+	}
+	sized := opts.MemoryBudget() != nil || opts.OverflowCacheBytes() > 0
+	if !sized || opts.ObjectSizeFn() != nil {
+		return opts
+	}
+	return opts.SetObjectSizeFn(checkedCapObjectSize(elemSize))
+}
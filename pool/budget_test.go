@@ -0,0 +1,185 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	"testing"
+
+	"github.com/m3db/m3x/checked"
+	"github.com/m3db/m3x/instrument"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestMemoryBudgetSharedAcrossPools(t *testing.T) {
+	for _, typ := range []ObjectPoolType{ChannelObjectPoolType, ShardedObjectPoolType} {
+		budgetScope := tally.NewTestScope("", nil)
+		budget := NewMemoryBudget(250,
+			instrument.NewOptions().SetMetricsScope(budgetScope))
+
+		newPool := func(scope tally.Scope) ObjectPool {
+			pool := NewObjectPool(NewObjectPoolOptions().
+				SetType(typ).
+				SetSize(2).
+				SetMemoryBudget(budget).
+				SetInstrumentOptions(instrument.NewOptions().SetMetricsScope(scope)))
+			pool.Init(func() interface{} {
+				return make([]byte, 0, 100)
+			})
+			return pool
+		}
+
+		firstScope := tally.NewTestScope("", nil)
+		secondScope := tally.NewTestScope("", nil)
+		first, second := newPool(firstScope), newPool(secondScope)
+
+		// The second pool only fits what is left of the budget.
+		assert.Equal(t, int64(200), budget.Used(), typ.String())
+		assert.Equal(t, int64(200), first.(statsReporter).stats().BudgetUsed)
+		assert.Equal(t, 2, first.(statsReporter).stats().Free)
+		assert.Equal(t, 0, second.(statsReporter).stats().Free)
+
+		// Objects leaving a pool release their share of the budget.
+		v := first.Get()
+		assert.Equal(t, int64(100), budget.Used())
+
+		second.Put(v)
+		assert.Equal(t, int64(200), budget.Used())
+		assert.Equal(t, int64(100), second.(statsReporter).stats().BudgetUsed)
+
+		// Puts over budget are dropped as if the pool was full.
+		second.Put(make([]byte, 0, 100))
+		assert.Equal(t, int64(200), budget.Used())
+		assert.Equal(t, 1, second.(statsReporter).stats().Free)
+		assert.Equal(t, int64(1), second.(statsReporter).stats().PutOnFull)
+
+		counters := secondScope.Snapshot().Counters()
+		require.NotNil(t, counters["over-budget+"])
+		assert.True(t, counters["over-budget+"].Value() >= 1)
+
+		gauges := budgetScope.Snapshot().Gauges()
+		assert.Equal(t, 250.0, gauges["memory-budget-limit+"].Value())
+		assert.Equal(t, 200.0, gauges["memory-budget-used+"].Value())
+	}
+}
+
+func TestMemoryBudgetBucketizedPools(t *testing.T) {
+	budget := NewMemoryBudget(1024, nil)
+	opts := NewObjectPoolOptions().SetMemoryBudget(budget)
+	buckets := []Bucket{{Capacity: 64, Count: 4}, {Capacity: 256, Count: 4}}
+
+	bytesPool := NewBytesPool(buckets, opts)
+	bytesPool.Init()
+	assert.Equal(t, int64(4*64+3*256), budget.Used())
+
+	checkedPool := NewCheckedBytesPool(buckets, opts, func(s []Bucket) BytesPool {
+		return NewBytesPool(s, nil)
+	})
+	checkedPool.Init()
+
+	// Budget exhausted, nothing retained on init.
+	assert.Equal(t, int64(4*64+3*256), budget.Used())
+
+	b := bytesPool.Get(200)
+	assert.Equal(t, int64(4*64+2*256), budget.Used())
+
+	// Checked bytes are charged by capacity.
+	c := checkedPool.Get(200)
+	c.IncRef()
+	c.DecRef()
+	c.Finalize()
+	assert.Equal(t, int64(4*64+3*256), budget.Used())
+
+	bytesPool.Put(b)
+	assert.Equal(t, int64(4*64+3*256), budget.Used())
+}
+
+func TestDefaultObjectSize(t *testing.T) {
+	size := func(obj interface{}) int64 {
+		n, err := defaultObjectSize(obj)
+		require.NoError(t, err)
+		return n
+	}
+
+	assert.Equal(t, int64(80), size(make([]float64, 3, 10)))
+	assert.Equal(t, int64(8), size(int64(1)))
+	assert.Equal(t, int64(0), size(nil))
+
+	type obj struct {
+		a, b int64
+	}
+	for _, v := range []interface{}{&obj{}, map[int]int{}, make(chan int)} {
+		_, err := defaultObjectSize(v)
+		assert.Equal(t, errObjectSizeFnRequired, err)
+	}
+}
+
+func TestMemoryBudgetPointerObjectsRequireSizeFn(t *testing.T) {
+	type obj struct {
+		values []int64
+	}
+
+	var errs []error
+	budget := NewMemoryBudget(1024, nil)
+	opts := NewObjectPoolOptions().
+		SetSize(2).
+		SetMemoryBudget(budget).
+		SetOnPoolAccessErrorFn(func(err error) {
+			errs = append(errs, err)
+		})
+
+	// Without a size fn the error is reported once on init and nothing is
+	// retained.
+	pool := NewObjectPool(opts)
+	pool.Init(func() interface{} {
+		return &obj{values: make([]int64, 8)}
+	})
+	assert.Equal(t, []error{errObjectSizeFnRequired}, errs)
+	assert.Equal(t, int64(0), budget.Used())
+	assert.Equal(t, 0, pool.(statsReporter).stats().Free)
+
+	pool.Put(pool.Get())
+	assert.Equal(t, 1, len(errs))
+	assert.Equal(t, 0, pool.(statsReporter).stats().Free)
+
+	pool = NewObjectPool(opts.SetObjectSizeFn(func(v interface{}) int64 {
+		return 24 + int64(cap(v.(*obj).values))*8
+	}))
+	pool.Init(func() interface{} {
+		return &obj{values: make([]int64, 8)}
+	})
+	assert.Equal(t, int64(2*88), budget.Used())
+}
+
+func TestMemoryBudgetConfiguration(t *testing.T) {
+	cfg := MemoryBudgetConfiguration{Limit: 1 << 20}
+	budget := cfg.NewMemoryBudget(instrument.NewOptions())
+	assert.Equal(t, int64(1<<20), budget.Limit())
+	assert.Equal(t, int64(0), budget.Used())
+}
+
+func TestCheckedCapObjectSizeTakesNoRef(t *testing.T) {
+	b := checked.NewBytes(make([]byte, 0, 16), nil)
+	assert.Equal(t, int64(16), checkedCapObjectSize(1)(b))
+	assert.Equal(t, 0, b.NumRef())
+}
@@ -0,0 +1,277 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	"io"
+
+	"github.com/m3db/m3x/checked"
+)
+
+const (
+	defaultBufferSegmentSize = 4096
+)
+
+type buffer struct {
+	bytesPool   BytesPool
+	checkedPool CheckedBytesPool
+	segmentSize int
+	segments    []bufferSegment
+	// Offset of the first unread byte in the first segment.
+	off    int
+	length int
+}
+
+// bufferSegment is either a plain or a checked byte slice, checked byte
+// slices are only accessed through their checked methods.
+type bufferSegment struct {
+	bytes    []byte
+	checked  checked.Bytes
+	capacity int
+}
+
+// NewBuffer creates a new buffer with segments of at least segmentSize
+// bytes taken from a bytes pool, if segmentSize is zero or less then a
+// default segment size is used.
+func NewBuffer(pool BytesPool, segmentSize int) Buffer {
+	return newBuffer(pool, nil, segmentSize)
+}
+
+// NewCheckedBuffer creates a new buffer with segments of at least
+// segmentSize bytes taken from a checked bytes pool, if segmentSize is
+// zero or less then a default segment size is used. The buffer holds a
+// ref to each of its segments until they are returned to the pool.
+func NewCheckedBuffer(pool CheckedBytesPool, segmentSize int) Buffer {
+	return newBuffer(nil, pool, segmentSize)
+}
+
+func newBuffer(
+	bytesPool BytesPool,
+	checkedPool CheckedBytesPool,
+	segmentSize int,
+) *buffer {
+	if segmentSize <= 0 {
+		segmentSize = defaultBufferSegmentSize
+	}
+	return &buffer{
+		bytesPool:   bytesPool,
+		checkedPool: checkedPool,
+		segmentSize: segmentSize,
+	}
+}
+
+func (b *buffer) Len() int {
+	return b.length
+}
+
+func (b *buffer) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		seg := b.tail()
+		k := seg.capacity - seg.len()
+		if k > len(p) {
+			k = len(p)
+		}
+		seg.append(p[:k])
+		b.length += k
+		p = p[k:]
+	}
+	return n, nil
+}
+
+func (b *buffer) WriteByte(c byte) error {
+	seg := b.tail()
+	if seg.checked != nil {
+		seg.checked.Append(c)
+	} else {
+		seg.bytes = append(seg.bytes, c)
+	}
+	b.length++
+	return nil
+}
+
+func (b *buffer) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if b.length == 0 {
+		return 0, io.EOF
+	}
+
+	n := 0
+	for n < len(p) && b.length > 0 {
+		k := copy(p[n:], b.segments[0].value()[b.off:])
+		n += k
+		b.advance(k)
+	}
+	return n, nil
+}
+
+func (b *buffer) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	for b.length > 0 {
+		data := b.segments[0].value()[b.off:]
+		k, err := w.Write(data)
+		n += int64(k)
+		b.advance(k)
+		if err != nil {
+			return n, err
+		}
+		if k < len(data) {
+			return n, io.ErrShortWrite
+		}
+	}
+	return n, nil
+}
+
+func (b *buffer) Bytes() []byte {
+	if b.length == 0 {
+		return nil
+	}
+	if len(b.segments) > 1 {
+		b.coalesce()
+	}
+	return b.segments[0].value()[b.off:]
+}
+
+// coalesce moves the unread bytes into a single segment so that they are
+// only copied once however many times they are asked for.
+func (b *buffer) coalesce() {
+	size := b.length
+	if size < b.segmentSize {
+		size = b.segmentSize
+	}
+
+	seg := b.newSegment(size)
+	seg.append(b.segments[0].value()[b.off:])
+	for i := 1; i < len(b.segments); i++ {
+		seg.append(b.segments[i].value())
+	}
+
+	for len(b.segments) > 0 {
+		b.releaseFirst()
+	}
+	b.segments = append(b.segments, seg)
+	b.off = 0
+}
+
+func (b *buffer) Reset() {
+	for len(b.segments) > 1 {
+		b.releaseFirst()
+	}
+	if len(b.segments) == 1 {
+		b.segments[0].truncate()
+	}
+	b.off = 0
+	b.length = 0
+}
+
+func (b *buffer) Close() error {
+	for len(b.segments) > 0 {
+		b.releaseFirst()
+	}
+	b.off = 0
+	b.length = 0
+	return nil
+}
+
+// tail returns the last segment growing the buffer by a new segment if
+// the last segment is full.
+func (b *buffer) tail() *bufferSegment {
+	if n := len(b.segments); n > 0 && b.segments[n-1].len() < b.segments[n-1].capacity {
+		return &b.segments[n-1]
+	}
+
+	b.segments = append(b.segments, b.newSegment(b.segmentSize))
+	return &b.segments[len(b.segments)-1]
+}
+
+func (b *buffer) newSegment(size int) bufferSegment {
+	if b.checkedPool != nil {
+		bytes := b.checkedPool.Get(size)
+		bytes.IncRef()
+		return bufferSegment{checked: bytes, capacity: bytes.Cap()}
+	}
+	bytes := b.bytesPool.Get(size)
+	return bufferSegment{bytes: bytes[:0], capacity: cap(bytes)}
+}
+
+// advance consumes n unread bytes returning segments which have been
+// read in full to the pool.
+func (b *buffer) advance(n int) {
+	b.off += n
+	b.length -= n
+
+	for len(b.segments) > 1 && b.off == b.segments[0].len() {
+		b.releaseFirst()
+		b.off = 0
+	}
+
+	// Reuse the last segment from the start once everything has been read.
+	if b.length == 0 && len(b.segments) == 1 {
+		b.segments[0].truncate()
+		b.off = 0
+	}
+}
+
+func (b *buffer) releaseFirst() {
+	seg := b.segments[0]
+	if seg.checked != nil {
+		seg.checked.DecRef()
+		seg.checked.Finalize()
+	} else {
+		b.bytesPool.Put(seg.bytes)
+	}
+
+	n := copy(b.segments, b.segments[1:])
+	b.segments[n] = bufferSegment{}
+	b.segments = b.segments[:n]
+}
+
+func (s *bufferSegment) value() []byte {
+	if s.checked != nil {
+		return s.checked.Get()
+	}
+	return s.bytes
+}
+
+func (s *bufferSegment) len() int {
+	if s.checked != nil {
+		return s.checked.Len()
+	}
+	return len(s.bytes)
+}
+
+func (s *bufferSegment) append(p []byte) {
+	if s.checked != nil {
+		s.checked.AppendAll(p)
+		return
+	}
+	s.bytes = append(s.bytes, p...)
+}
+
+func (s *bufferSegment) truncate() {
+	if s.checked != nil {
+		s.checked.Resize(0)
+		return
+	}
+	s.bytes = s.bytes[:0]
+}
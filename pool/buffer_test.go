@@ -0,0 +1,214 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/m3db/m3x/checked"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testBufferPayload(n int) []byte {
+	payload := make([]byte, n)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+	return payload
+}
+
+func TestBufferWriteRead(t *testing.T) {
+	pool := newCountingBytesPool()
+	buf := NewBuffer(pool, 4)
+	payload := testBufferPayload(25)
+
+	n, err := buf.Write(payload[:10])
+	require.NoError(t, err)
+	require.Equal(t, 10, n)
+	for _, c := range payload[10:] {
+		require.NoError(t, buf.WriteByte(c))
+	}
+
+	require.Equal(t, 25, buf.Len())
+	require.Equal(t, 7, pool.outstanding)
+
+	// Segments read in full go back to the pool straight away.
+	p := make([]byte, 9)
+	n, err = buf.Read(p)
+	require.NoError(t, err)
+	require.Equal(t, 9, n)
+	require.Equal(t, payload[:9], p)
+	require.Equal(t, 16, buf.Len())
+	require.Equal(t, 5, pool.outstanding)
+
+	rest, err := ioutil.ReadAll(buf)
+	require.NoError(t, err)
+	require.Equal(t, payload[9:], rest)
+	require.Equal(t, 0, buf.Len())
+	require.Equal(t, 1, pool.outstanding)
+
+	n, err = buf.Read(p)
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, 0, n)
+
+	require.NoError(t, buf.Close())
+	require.Equal(t, 0, pool.outstanding)
+}
+
+func TestBufferBytesCoalesces(t *testing.T) {
+	pool := newCountingBytesPool()
+	buf := NewBuffer(pool, 4)
+	payload := testBufferPayload(10)
+
+	_, err := buf.Write(payload)
+	require.NoError(t, err)
+	_, err = buf.Read(make([]byte, 2))
+	require.NoError(t, err)
+	require.Equal(t, 3, pool.outstanding)
+
+	// The unread bytes move into one segment and are not copied again.
+	first := buf.Bytes()
+	require.Equal(t, payload[2:], first)
+	require.Equal(t, 1, pool.outstanding)
+	second := buf.Bytes()
+	require.True(t, &first[0] == &second[0])
+
+	// Writes keep appending after the coalesced bytes.
+	require.NoError(t, buf.WriteByte('x'))
+	require.Equal(t, append(payload[2:], 'x'), buf.Bytes())
+
+	require.NoError(t, buf.Close())
+	require.Equal(t, 0, pool.outstanding)
+}
+
+func TestBufferWriteTo(t *testing.T) {
+	pool := newCountingBytesPool()
+	buf := NewBuffer(pool, 8)
+	payload := testBufferPayload(30)
+
+	_, err := buf.Write(payload)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	n, err := buf.WriteTo(&out)
+	require.NoError(t, err)
+	require.Equal(t, int64(30), n)
+	require.Equal(t, payload, out.Bytes())
+	require.Equal(t, 0, buf.Len())
+	require.Equal(t, 1, pool.outstanding)
+
+	// The remaining segment is reused from the start.
+	_, err = buf.Write(payload[:3])
+	require.NoError(t, err)
+	require.Equal(t, payload[:3], buf.Bytes())
+	require.Equal(t, 1, pool.outstanding)
+
+	require.NoError(t, buf.Close())
+	require.Equal(t, 0, pool.outstanding)
+}
+
+type shortWriter struct {
+	limit int
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		return w.limit, errors.New("short write")
+	}
+	return len(p), nil
+}
+
+func TestBufferWriteToError(t *testing.T) {
+	pool := newCountingBytesPool()
+	buf := NewBuffer(pool, 4)
+	payload := testBufferPayload(10)
+
+	_, err := buf.Write(payload)
+	require.NoError(t, err)
+
+	n, err := buf.WriteTo(&shortWriter{limit: 2})
+	require.Error(t, err)
+	require.Equal(t, int64(2), n)
+	require.Equal(t, payload[2:], buf.Bytes())
+}
+
+func TestBufferReset(t *testing.T) {
+	pool := newCountingBytesPool()
+	buf := NewBuffer(pool, 4)
+
+	_, err := buf.Write(testBufferPayload(10))
+	require.NoError(t, err)
+	require.Equal(t, 3, pool.outstanding)
+
+	buf.Reset()
+	require.Equal(t, 0, buf.Len())
+	require.Nil(t, buf.Bytes())
+	require.Equal(t, 1, pool.outstanding)
+
+	require.NoError(t, buf.WriteByte('x'))
+	assert.Equal(t, []byte("x"), buf.Bytes())
+}
+
+type recordingCheckedBytesPool struct {
+	CheckedBytesPool
+	segments []checked.Bytes
+}
+
+func (p *recordingCheckedBytesPool) Get(capacity int) checked.Bytes {
+	b := p.CheckedBytesPool.Get(capacity)
+	p.segments = append(p.segments, b)
+	return b
+}
+
+func TestCheckedBuffer(t *testing.T) {
+	sizes := []Bucket{{Capacity: 4, Count: 2}, {Capacity: 8, Count: 2}}
+	checkedPool := NewCheckedBytesPool(sizes, nil, func(s []Bucket) BytesPool {
+		return NewBytesPool(s, nil)
+	})
+	checkedPool.Init()
+
+	pool := &recordingCheckedBytesPool{CheckedBytesPool: checkedPool}
+	buf := NewCheckedBuffer(pool, 4)
+	payload := testBufferPayload(10)
+
+	_, err := buf.Write(payload)
+	require.NoError(t, err)
+	require.Len(t, pool.segments, 3)
+	for _, segment := range pool.segments {
+		require.Equal(t, 1, segment.NumRef())
+	}
+
+	var out bytes.Buffer
+	_, err = buf.WriteTo(&out)
+	require.NoError(t, err)
+	require.Equal(t, payload, out.Bytes())
+
+	require.NoError(t, buf.Close())
+	for _, segment := range pool.segments {
+		require.Equal(t, 0, segment.NumRef())
+	}
+}
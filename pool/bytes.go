@@ -20,6 +20,8 @@
 
 package pool
 
+import "context"
+
 type bytesPool struct {
 	pool BucketizedObjectPool
 }
@@ -35,6 +37,14 @@ func (p *bytesPool) Init() {
 	})
 }
 
+func (p *bytesPool) UpdateBuckets(sizes []Bucket) {
+	p.pool.UpdateBuckets(sizes)
+}
+
+func (p *bytesPool) WaitReady(ctx context.Context) error {
+	return p.pool.WaitReady(ctx)
+}
+
 func (p *bytesPool) Get(capacity int) []byte {
 	if capacity < 1 {
 		return nil
@@ -61,8 +61,8 @@ func TestBytesPoolGetLargerThanLargestBucket(t *testing.T) {
 
 	// Assert not from pool
 	bucketed := p.pool.(*bucketizedObjectPool)
-	assert.Equal(t, 1, len(bucketed.buckets))
-	assert.Equal(t, 2, len(bucketed.buckets[0].pool.(*objectPool).values))
+	assert.Equal(t, 1, len(bucketed.buckets()))
+	assert.Equal(t, 2, len(bucketed.buckets()[0].pool.(*objectPool).values))
 }
 
 func TestAppendByte(t *testing.T) {
@@ -96,3 +96,25 @@ func getBytesPool(bucketSizes int, bucketCaps []int) *bytesPool {
 
 	return NewBytesPool(buckets, nil).(*bytesPool)
 }
+
+// countingBytesPool counts the buffers held outside of the pool.
+type countingBytesPool struct {
+	BytesPool
+	outstanding int
+}
+
+func newCountingBytesPool() *countingBytesPool {
+	p := getBytesPool(2, []int{4, 8})
+	p.Init()
+	return &countingBytesPool{BytesPool: p}
+}
+
+func (p *countingBytesPool) Get(capacity int) []byte {
+	p.outstanding++
+	return p.BytesPool.Get(capacity)
+}
+
+func (p *countingBytesPool) Put(buffer []byte) {
+	p.outstanding--
+	p.BytesPool.Put(buffer)
+}
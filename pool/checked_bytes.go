@@ -20,7 +20,11 @@
 
 package pool
 
-import "github.com/m3db/m3x/checked"
+import (
+	"context"
+
+	"github.com/m3db/m3x/checked"
+)
 
 type checkedBytesPool struct {
 	bytesPool BytesPool
@@ -38,7 +42,7 @@ func NewCheckedBytesPool(
 ) CheckedBytesPool {
 	return &checkedBytesPool{
 		bytesPool: newBackingBytesPool(sizes),
-		pool:      NewBucketizedObjectPool(sizes, opts),
+		pool:      NewBucketizedObjectPool(sizes, withCheckedCapObjectSize(opts, 1)),
 	}
 }
 
@@ -53,6 +57,24 @@ func (p *checkedBytesPool) Init() {
 	})
 }
 
+func (p *checkedBytesPool) UpdateBuckets(sizes []Bucket) {
+	// Update the backing pool first so that checked bytes allocated for
+	// new buckets are backed by buffers from the matching buckets.
+	if updater, ok := p.bytesPool.(BucketsUpdater); ok {
+		updater.UpdateBuckets(sizes)
+	}
+	p.pool.UpdateBuckets(sizes)
+}
+
+func (p *checkedBytesPool) WaitReady(ctx context.Context) error {
+	if waiter, ok := p.bytesPool.(ReadyWaiter); ok {
+		if err := waiter.WaitReady(ctx); err != nil {
+			return err
+		}
+	}
+	return p.pool.WaitReady(ctx)
+}
+
 func (p *checkedBytesPool) Get(capacity int) checked.Bytes {
 	return p.pool.Get(capacity).(checked.Bytes)
 }
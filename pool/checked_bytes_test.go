@@ -69,6 +69,43 @@ func TestCheckedBytesPool(t *testing.T) {
 	assert.Equal(t, copiedB1, b3.Get()[:1])
 }
 
+func TestCheckedBytesPoolUpdateBuckets(t *testing.T) {
+	p := getCheckedBytesPool(2, []int{5, 10})
+	p.Init()
+
+	b1 := p.Get(10)
+	b1.IncRef()
+	b1.Append('a')
+
+	p.UpdateBuckets([]Bucket{
+		{Capacity: 5, Count: 2},
+		{Capacity: 20, Count: 1},
+	})
+
+	b2 := p.Get(20)
+	b2.IncRef()
+	assert.Equal(t, 20, b2.Cap())
+	b2.DecRef()
+	b2.Finalize()
+
+	b3 := p.Get(5)
+	b3.IncRef()
+	assert.Equal(t, 1, checkedBytesPoolBucketLen(p, 0))
+
+	// Bytes checked out before the update still work and are returned to
+	// the largest bucket they can serve.
+	assert.Equal(t, []byte("a"), b1.Get())
+	b1.DecRef()
+	b1.Finalize()
+	assert.Equal(t, 2, checkedBytesPoolBucketLen(p, 0))
+	assert.Equal(t, 1, checkedBytesPoolBucketLen(p, 1))
+	assert.Equal(t, 5, b3.Cap())
+
+	bytesPool := p.bytesPool.(*bytesPool)
+	buckets := bytesPool.pool.(*bucketizedObjectPool).buckets()
+	assert.Equal(t, 20, buckets[len(buckets)-1].capacity)
+}
+
 func TestAppendByteChecked(t *testing.T) {
 	p := getCheckedBytesPool(1, []int{3, 10})
 	p.Init()
@@ -124,6 +161,6 @@ func checkedBytesPoolBucketLen(
 	bucket int,
 ) int {
 	bucketizedPool := p.pool.(*bucketizedObjectPool)
-	objectPool := bucketizedPool.buckets[bucket].pool.(*objectPool)
+	objectPool := bucketizedPool.buckets()[bucket].pool.(*objectPool)
 	return len(objectPool.values)
 }
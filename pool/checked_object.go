@@ -20,7 +20,11 @@
 
 package pool
 
-import "github.com/m3db/m3x/checked"
+import (
+	"context"
+
+	"github.com/m3db/m3x/checked"
+)
 
 type checkedObjectPool struct {
 	pool          ObjectPool
@@ -49,7 +53,8 @@ func NewCheckedObjectPool(opts ObjectPoolOptions) CheckedObjectPool {
 	}
 	return &checkedObjectPool{
 		pool: NewObjectPool(opts),
-		finalizerPool: NewObjectPool(opts.SetInstrumentOptions(opts.InstrumentOptions().
+		// Only the pool of values is registered under the pool name.
+		finalizerPool: NewObjectPool(opts.SetName("").SetInstrumentOptions(opts.InstrumentOptions().
 			SetMetricsScope(opts.InstrumentOptions().
 				MetricsScope().
 				SubScope("finalizer-pool")))),
@@ -67,6 +72,13 @@ func (p *checkedObjectPool) Init(alloc CheckedAllocator) {
 	})
 }
 
+func (p *checkedObjectPool) WaitReady(ctx context.Context) error {
+	if err := p.pool.WaitReady(ctx); err != nil {
+		return err
+	}
+	return p.finalizerPool.WaitReady(ctx)
+}
+
 func (p *checkedObjectPool) Get() checked.ReadWriteRef {
 	value := p.pool.Get().(checked.ReadWriteRef)
 	finalizer := p.finalizerPool.Get().(*checkedObjectFinalizer)
@@ -20,15 +20,154 @@
 
 package pool
 
-import "github.com/m3db/m3x/instrument"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/m3db/m3x/instrument"
+)
+
+var (
+	errNativePoolTypeBytesOnly = errors.New("native pool type is only supported for bytes pools")
+	errAdaptiveChannelOnly     = errors.New("adaptive sizing is only supported for channel pools")
+	errInvalidInitFraction     = errors.New("init fraction must be between 0 and 1")
+	errNativeInitFraction      = errors.New("init fraction is not supported for native pools")
+	errNativeOverflowCache     = errors.New("overflow cache is not supported for native pools")
+)
+
+// PoolType is a type of pool implementation selectable from configuration.
+type PoolType int
+
+const (
+	// ChannelPoolType is a pool of channel object pools, see
+	// ChannelObjectPoolType.
+	ChannelPoolType PoolType = iota
+
+	// ShardedPoolType is a pool of sharded object pools, see
+	// ShardedObjectPoolType.
+	ShardedPoolType
+
+	// SyncPoolType is a pool of sync.Pool backed object pools, see
+	// SyncObjectPoolType.
+	SyncPoolType
+
+	// NativePoolType is a bytes pool backed by a native heap which is opaque
+	// to the Go GC, see NewNativeHeap. It is only valid for bytes pools.
+	NativePoolType
+
+	// DefaultPoolType is the default pool type.
+	DefaultPoolType = ChannelPoolType
+)
+
+var validPoolTypes = []PoolType{
+	ChannelPoolType,
+	ShardedPoolType,
+	SyncPoolType,
+	NativePoolType,
+}
+
+func (t PoolType) String() string {
+	switch t {
+	case ChannelPoolType:
+		return "channel"
+	case ShardedPoolType:
+		return "sharded"
+	case SyncPoolType:
+		return "syncpool"
+	case NativePoolType:
+		return "native"
+	}
+	return "unknown"
+}
+
+// UnmarshalYAML unmarshals a PoolType into a valid type from string.
+func (t *PoolType) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var str string
+	if err := unmarshal(&str); err != nil {
+		return err
+	}
+	if str == "" {
+		*t = DefaultPoolType
+		return nil
+	}
+	strs := make([]string, 0, len(validPoolTypes))
+	for _, valid := range validPoolTypes {
+		if str == valid.String() {
+			*t = valid
+			return nil
+		}
+		strs = append(strs, "'"+valid.String()+"'")
+	}
+	return fmt.Errorf("invalid PoolType '%s' valid types are: %s",
+		str, strings.Join(strs, ", "))
+}
+
+// MarshalYAML marshals a PoolType as its string.
+func (t PoolType) MarshalYAML() (interface{}, error) {
+	return t.String(), nil
+}
+
+// ObjectPoolType returns the object pool implementation for the pool type,
+// native pools are built from channel object pools where they are not
+// backed by a native heap.
+func (t PoolType) ObjectPoolType() ObjectPoolType {
+	switch t {
+	case ShardedPoolType:
+		return ShardedObjectPoolType
+	case SyncPoolType:
+		return SyncObjectPoolType
+	}
+	return ChannelObjectPoolType
+}
+
+func validatePoolConfiguration(
+	t PoolType,
+	adaptive *AdaptiveSizeConfiguration,
+	initFraction *float64,
+) error {
+	if adaptive != nil && t != ChannelPoolType {
+		return errAdaptiveChannelOnly
+	}
+	if initFraction != nil && (*initFraction < 0 || *initFraction > 1) {
+		return errInvalidInitFraction
+	}
+	return nil
+}
+
+// poolTypeInstrumentOptions tags the metrics of a pool with its type so
+// that pools of every type report the same metrics under the same names.
+func poolTypeInstrumentOptions(
+	t PoolType,
+	instrumentOpts instrument.Options,
+) instrument.Options {
+	if instrumentOpts == nil {
+		instrumentOpts = instrument.NewOptions()
+	}
+	scope := instrumentOpts.MetricsScope().Tagged(map[string]string{
+		"pool-type": t.String(),
+	})
+	return instrumentOpts.SetMetricsScope(scope)
+}
 
 // ObjectPoolConfiguration contains configuration for object pools.
 type ObjectPoolConfiguration struct {
+	// The type of the pool, native pools are not supported.
+	Type PoolType `yaml:"type"`
+
 	// The size of the pool.
 	Size int `yaml:"size"`
 
 	// The watermark configuration.
 	Watermark WatermarkConfiguration `yaml:"watermark"`
+
+	// The adaptive size configuration, if nil the size is fixed.
+	Adaptive *AdaptiveSizeConfiguration `yaml:"adaptive,omitempty"`
+
+	// The fraction of the pool allocated on init with the rest allocated in
+	// the background, if nil the whole pool is allocated on init.
+	InitFraction *float64 `yaml:"initFraction,omitempty"`
 }
 
 // NewObjectPoolOptions creates a new set of object pool options.
@@ -39,30 +178,84 @@ func (c *ObjectPoolConfiguration) NewObjectPoolOptions(
 	if c.Size != 0 {
 		size = c.Size
 	}
-	return NewObjectPoolOptions().
+	opts := NewObjectPoolOptions().
 		SetInstrumentOptions(instrumentOpts).
+		SetType(c.Type.ObjectPoolType()).
 		SetSize(size).
 		SetRefillLowWatermark(c.Watermark.RefillLowWatermark).
 		SetRefillHighWatermark(c.Watermark.RefillHighWatermark)
+	if c.Adaptive != nil {
+		opts = opts.SetAdaptiveSizeOptions(c.Adaptive.NewAdaptiveSizeOptions())
+	}
+	if c.InitFraction != nil {
+		opts = opts.SetInitFraction(*c.InitFraction)
+	}
+	return opts
+}
+
+// Validate validates the object pool configuration.
+func (c *ObjectPoolConfiguration) Validate() error {
+	if c.Type == NativePoolType {
+		return errNativePoolTypeBytesOnly
+	}
+	return validatePoolConfiguration(c.Type, c.Adaptive, c.InitFraction)
+}
+
+// NewObjectPool validates the configuration and creates a new object pool
+// of the configured type, the pool still needs to be initialized.
+func (c *ObjectPoolConfiguration) NewObjectPool(
+	instrumentOpts instrument.Options,
+) (ObjectPool, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	instrumentOpts = poolTypeInstrumentOptions(c.Type, instrumentOpts)
+	return NewObjectPool(c.NewObjectPoolOptions(instrumentOpts)), nil
 }
 
 // BucketizedPoolConfiguration contains configuration for bucketized pools.
 type BucketizedPoolConfiguration struct {
+	// The type of the pool, native pools are only supported for bytes pools.
+	Type PoolType `yaml:"type"`
+
 	// The pool bucket configuration.
 	Buckets []BucketConfiguration `yaml:"buckets"`
 
 	// The watermark configuration.
 	Watermark WatermarkConfiguration `yaml:"watermark"`
+
+	// The adaptive size configuration, if nil the bucket sizes are fixed.
+	Adaptive *AdaptiveSizeConfiguration `yaml:"adaptive,omitempty"`
+
+	// The fraction of each bucket allocated on init with the rest allocated
+	// in the background, if nil the whole pool is allocated on init. Native
+	// pools do not support it.
+	InitFraction *float64 `yaml:"initFraction,omitempty"`
+
+	// The max bytes of objects larger than the largest bucket retained by the
+	// pool, if zero they are dropped. Native pools do not support it.
+	OverflowCacheBytes int64 `yaml:"overflowCacheBytes,omitempty" validate:"min=0"`
 }
 
 // NewObjectPoolOptions creates a new set of object pool options.
 func (c *BucketizedPoolConfiguration) NewObjectPoolOptions(
 	instrumentOpts instrument.Options,
 ) ObjectPoolOptions {
-	return NewObjectPoolOptions().
+	opts := NewObjectPoolOptions().
 		SetInstrumentOptions(instrumentOpts).
+		SetType(c.Type.ObjectPoolType()).
 		SetRefillLowWatermark(c.Watermark.RefillLowWatermark).
 		SetRefillHighWatermark(c.Watermark.RefillHighWatermark)
+	if c.Adaptive != nil {
+		opts = opts.SetAdaptiveSizeOptions(c.Adaptive.NewAdaptiveSizeOptions())
+	}
+	if c.InitFraction != nil {
+		opts = opts.SetInitFraction(*c.InitFraction)
+	}
+	if c.OverflowCacheBytes > 0 {
+		opts = opts.SetOverflowCacheBytes(c.OverflowCacheBytes)
+	}
+	return opts
 }
 
 // NewBuckets create a new list of buckets.
@@ -75,6 +268,82 @@ func (c *BucketizedPoolConfiguration) NewBuckets() []Bucket {
 	return buckets
 }
 
+// Validate validates the bucketized pool configuration.
+func (c *BucketizedPoolConfiguration) Validate() error {
+	if c.Type == NativePoolType {
+		if c.InitFraction != nil {
+			return errNativeInitFraction
+		}
+		if c.OverflowCacheBytes != 0 {
+			return errNativeOverflowCache
+		}
+	}
+	return validatePoolConfiguration(c.Type, c.Adaptive, c.InitFraction)
+}
+
+// NewBytesPool validates the configuration and creates a new bytes pool
+// of the configured type, the pool still needs to be initialized.
+func (c *BucketizedPoolConfiguration) NewBytesPool(
+	instrumentOpts instrument.Options,
+) (BytesPool, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	instrumentOpts = poolTypeInstrumentOptions(c.Type, instrumentOpts)
+	opts := c.NewObjectPoolOptions(instrumentOpts)
+	if c.Type == NativePoolType {
+		return NewNativeHeap(c.NewBuckets(), opts), nil
+	}
+	return NewBytesPool(c.NewBuckets(), opts), nil
+}
+
+// NewFloatsPool validates the configuration and creates a new floats pool
+// of the configured type, the pool still needs to be initialized.
+func (c *BucketizedPoolConfiguration) NewFloatsPool(
+	instrumentOpts instrument.Options,
+) (FloatsPool, error) {
+	opts, err := c.newNonNativeObjectPoolOptions(instrumentOpts)
+	if err != nil {
+		return nil, err
+	}
+	return NewFloatsPool(c.NewBuckets(), opts), nil
+}
+
+// NewBucketizedObjectPool validates the configuration and creates a new
+// bucketized object pool of the configured type, the pool still needs to
+// be initialized.
+func (c *BucketizedPoolConfiguration) NewBucketizedObjectPool(
+	instrumentOpts instrument.Options,
+) (BucketizedObjectPool, error) {
+	opts, err := c.newNonNativeObjectPoolOptions(instrumentOpts)
+	if err != nil {
+		return nil, err
+	}
+	return NewBucketizedObjectPool(c.NewBuckets(), opts), nil
+}
+
+// NewSlicesPoolOptions validates the configuration and returns the object
+// pool options for the typed slice pools, e.g. NewInt64sPool or
+// NewCheckedStringsPool with the buckets from NewBuckets.
+func (c *BucketizedPoolConfiguration) NewSlicesPoolOptions(
+	instrumentOpts instrument.Options,
+) (ObjectPoolOptions, error) {
+	return c.newNonNativeObjectPoolOptions(instrumentOpts)
+}
+
+func (c *BucketizedPoolConfiguration) newNonNativeObjectPoolOptions(
+	instrumentOpts instrument.Options,
+) (ObjectPoolOptions, error) {
+	if c.Type == NativePoolType {
+		return nil, errNativePoolTypeBytesOnly
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	instrumentOpts = poolTypeInstrumentOptions(c.Type, instrumentOpts)
+	return c.NewObjectPoolOptions(instrumentOpts), nil
+}
+
 // BucketConfiguration contains configuration for a pool bucket.
 type BucketConfiguration struct {
 	// The count of the items in the bucket.
@@ -82,6 +351,12 @@ type BucketConfiguration struct {
 
 	// The capacity of each item in the bucket.
 	Capacity int `yaml:"capacity"`
+
+	// The min count of the items in the bucket when adaptively sized.
+	MinCount int `yaml:"minCount,omitempty"`
+
+	// The max count of the items in the bucket when adaptively sized.
+	MaxCount int `yaml:"maxCount,omitempty"`
 }
 
 // NewBucket creates a new bucket.
@@ -89,6 +364,8 @@ func (c *BucketConfiguration) NewBucket() Bucket {
 	return Bucket{
 		Capacity: c.Capacity,
 		Count:    c.Count,
+		MinCount: c.MinCount,
+		MaxCount: c.MaxCount,
 	}
 }
 
@@ -100,3 +377,52 @@ type WatermarkConfiguration struct {
 	// The high watermark to stop refilling the pool, if zero none.
 	RefillHighWatermark float64 `yaml:"high" validate:"min=0.0,max=1.0"`
 }
+
+// AdaptiveSizeConfiguration contains adaptive size configuration for pools.
+type AdaptiveSizeConfiguration struct {
+	// The min size the pool can shrink to, if zero the initial size.
+	MinSize int `yaml:"minSize" validate:"min=0"`
+
+	// The max size the pool can grow to, if zero the initial size.
+	MaxSize int `yaml:"maxSize" validate:"min=0"`
+
+	// The sliding window over which rates are observed.
+	Window time.Duration `yaml:"window"`
+
+	// The get on empty or put on full rate above which the pool grows.
+	GrowThreshold float64 `yaml:"growThreshold" validate:"min=0.0,max=1.0"`
+
+	// The max fraction of the current size to grow or shrink by.
+	StepFactor float64 `yaml:"stepFactor" validate:"min=0.0,max=1.0"`
+}
+
+// NewAdaptiveSizeOptions creates a new set of adaptive size options.
+func (c *AdaptiveSizeConfiguration) NewAdaptiveSizeOptions() AdaptiveSizeOptions {
+	opts := NewAdaptiveSizeOptions().
+		SetMinSize(c.MinSize).
+		SetMaxSize(c.MaxSize)
+	if c.Window != 0 {
+		opts = opts.SetWindow(c.Window)
+	}
+	if c.GrowThreshold != 0 {
+		opts = opts.SetGrowThreshold(c.GrowThreshold)
+	}
+	if c.StepFactor != 0 {
+		opts = opts.SetStepFactor(c.StepFactor)
+	}
+	return opts
+}
+
+// MemoryBudgetConfiguration contains configuration for a memory budget
+// shared across pools.
+type MemoryBudgetConfiguration struct {
+	// The max bytes retained across all the pools sharing the budget.
+	Limit int64 `yaml:"limit" validate:"min=0"`
+}
+
+// NewMemoryBudget creates a new memory budget.
+func (c *MemoryBudgetConfiguration) NewMemoryBudget(
+	instrumentOpts instrument.Options,
+) MemoryBudget {
+	return NewMemoryBudget(c.Limit, instrumentOpts)
+}
@@ -22,10 +22,13 @@ package pool
 
 import (
 	"testing"
+	"time"
 
 	"github.com/m3db/m3x/instrument"
 
 	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+	yaml "gopkg.in/yaml.v2"
 )
 
 func TestObjectPoolConfiguration(t *testing.T) {
@@ -40,6 +43,25 @@ func TestObjectPoolConfiguration(t *testing.T) {
 	require.Equal(t, 1, opts.size)
 	require.Equal(t, 0.1, opts.refillLowWatermark)
 	require.Equal(t, 0.5, opts.refillHighWatermark)
+	require.Nil(t, opts.adaptiveSizeOpts)
+}
+
+func TestObjectPoolConfigurationAdaptive(t *testing.T) {
+	cfg := ObjectPoolConfiguration{
+		Size: 10,
+		Adaptive: &AdaptiveSizeConfiguration{
+			MinSize: 5,
+			MaxSize: 20,
+			Window:  time.Second,
+		},
+	}
+	opts := cfg.NewObjectPoolOptions(instrument.NewOptions()).(*objectPoolOptions)
+	aopts := opts.adaptiveSizeOpts.(*adaptiveSizeOptions)
+	require.Equal(t, 5, aopts.minSize)
+	require.Equal(t, 20, aopts.maxSize)
+	require.Equal(t, time.Second, aopts.window)
+	require.Equal(t, defaultAdaptiveGrowThreshold, aopts.growThreshold)
+	require.Equal(t, defaultAdaptiveStepFactor, aopts.stepFactor)
 }
 
 func TestBucketizedPoolConfiguration(t *testing.T) {
@@ -62,3 +84,139 @@ func TestBucketizedPoolConfiguration(t *testing.T) {
 	require.Equal(t, 0.1, opts.refillLowWatermark)
 	require.Equal(t, 0.5, opts.refillHighWatermark)
 }
+
+func TestBucketizedPoolConfigurationAdaptive(t *testing.T) {
+	cfg := BucketizedPoolConfiguration{
+		Buckets: []BucketConfiguration{
+			{Count: 1, Capacity: 10},
+			{Count: 2, Capacity: 20, MinCount: 1, MaxCount: 4},
+		},
+		Adaptive: &AdaptiveSizeConfiguration{
+			MaxSize:    8,
+			StepFactor: 0.25,
+		},
+	}
+	expectedBuckets := []Bucket{
+		{Count: 1, Capacity: 10},
+		{Count: 2, Capacity: 20, MinCount: 1, MaxCount: 4},
+	}
+	require.Equal(t, expectedBuckets, cfg.NewBuckets())
+	opts := cfg.NewObjectPoolOptions(instrument.NewOptions()).(*objectPoolOptions)
+	aopts := opts.adaptiveSizeOpts.(*adaptiveSizeOptions)
+	require.Equal(t, 0, aopts.minSize)
+	require.Equal(t, 8, aopts.maxSize)
+	require.Equal(t, 0.25, aopts.stepFactor)
+}
+
+func TestPoolTypeUnmarshalYAML(t *testing.T) {
+	for _, valid := range validPoolTypes {
+		var cfg BucketizedPoolConfiguration
+		str := "type: " + valid.String() + "\n"
+		require.NoError(t, yaml.Unmarshal([]byte(str), &cfg))
+		require.Equal(t, valid, cfg.Type)
+	}
+
+	var cfg ObjectPoolConfiguration
+	require.NoError(t, yaml.Unmarshal([]byte("size: 4\n"), &cfg))
+	require.Equal(t, DefaultPoolType, cfg.Type)
+
+	err := yaml.Unmarshal([]byte("type: unknown\n"), &cfg)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "'channel', 'sharded', 'syncpool', 'native'")
+}
+
+func TestObjectPoolConfigurationTypes(t *testing.T) {
+	for _, typ := range []PoolType{ChannelPoolType, ShardedPoolType, SyncPoolType} {
+		scope := tally.NewTestScope("", nil)
+		cfg := ObjectPoolConfiguration{Type: typ, Size: 1}
+
+		pool, err := cfg.NewObjectPool(
+			instrument.NewOptions().SetMetricsScope(scope))
+		require.NoError(t, err)
+
+		pool.Init(func() interface{} { return new(int) })
+
+		// The second get has to allocate with every type.
+		a, b := pool.Get(), pool.Get()
+		pool.Put(a)
+		pool.Put(b)
+
+		counter, ok := scope.Snapshot().Counters()["get-on-empty+pool-type="+typ.String()]
+		require.True(t, ok, typ.String())
+		require.True(t, counter.Value() >= 1, typ.String())
+	}
+}
+
+func TestObjectPoolConfigurationInvalidType(t *testing.T) {
+	cfg := ObjectPoolConfiguration{Type: NativePoolType, Size: 1}
+	_, err := cfg.NewObjectPool(instrument.NewOptions())
+	require.Equal(t, errNativePoolTypeBytesOnly, err)
+
+	cfg = ObjectPoolConfiguration{
+		Type:     ShardedPoolType,
+		Size:     1,
+		Adaptive: &AdaptiveSizeConfiguration{},
+	}
+	_, err = cfg.NewObjectPool(instrument.NewOptions())
+	require.Equal(t, errAdaptiveChannelOnly, err)
+}
+
+func TestBucketizedPoolConfigurationNativeUnsupported(t *testing.T) {
+	initFraction := 0.5
+	cfg := BucketizedPoolConfiguration{
+		Type:         NativePoolType,
+		Buckets:      []BucketConfiguration{{Count: 2, Capacity: 16}},
+		InitFraction: &initFraction,
+	}
+	_, err := cfg.NewBytesPool(instrument.NewOptions())
+	require.Equal(t, errNativeInitFraction, err)
+
+	cfg.InitFraction = nil
+	cfg.OverflowCacheBytes = 1024
+	_, err = cfg.NewBytesPool(instrument.NewOptions())
+	require.Equal(t, errNativeOverflowCache, err)
+
+	cfg.Adaptive = &AdaptiveSizeConfiguration{}
+	cfg.OverflowCacheBytes = 0
+	_, err = cfg.NewBytesPool(instrument.NewOptions())
+	require.Equal(t, errAdaptiveChannelOnly, err)
+}
+
+func TestBucketizedPoolConfigurationTypes(t *testing.T) {
+	for _, typ := range validPoolTypes {
+		cfg := BucketizedPoolConfiguration{
+			Type:    typ,
+			Buckets: []BucketConfiguration{{Count: 2, Capacity: 16}},
+		}
+
+		bytesPool, err := cfg.NewBytesPool(instrument.NewOptions())
+		require.NoError(t, err)
+		bytesPool.Init()
+
+		b := bytesPool.Get(8)
+		require.Equal(t, 16, cap(b))
+		bytesPool.Put(b)
+
+		if typ == NativePoolType {
+			_, ok := bytesPool.(heap)
+			require.True(t, ok)
+
+			_, err = cfg.NewFloatsPool(instrument.NewOptions())
+			require.Equal(t, errNativePoolTypeBytesOnly, err)
+
+			_, err = cfg.NewBucketizedObjectPool(instrument.NewOptions())
+			require.Equal(t, errNativePoolTypeBytesOnly, err)
+			continue
+		}
+
+		floatsPool, err := cfg.NewFloatsPool(instrument.NewOptions())
+		require.NoError(t, err)
+		floatsPool.Init()
+		floatsPool.Put(floatsPool.Get(8))
+
+		objectPool, err := cfg.NewBucketizedObjectPool(instrument.NewOptions())
+		require.NoError(t, err)
+		objectPool.Init(func(capacity int) interface{} { return make([]int, 0, capacity) })
+		objectPool.Put(objectPool.Get(8), 16)
+	}
+}
@@ -20,6 +20,8 @@
 
 package pool
 
+import "context"
+
 type floatsPool struct {
 	pool BucketizedObjectPool
 }
@@ -35,6 +37,10 @@ func (p *floatsPool) Init() {
 	})
 }
 
+func (p *floatsPool) WaitReady(ctx context.Context) error {
+	return p.pool.WaitReady(ctx)
+}
+
 func (p *floatsPool) Get(capacity int) []float64 {
 	return p.pool.Get(capacity).([]float64)
 }
@@ -0,0 +1,200 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build ignore
+// +build ignore
+
+// gen_slices generates the typed slice pools in slices_gen.go, run it with
+// go generate after changing the element types below.
+package main
+
+import (
+	"bytes"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"text/template"
+)
+
+type slice struct {
+	Name   string
+	Lower  string
+	Single string
+	Elem   string
+	Zero   string
+	Clear  bool
+}
+
+// Slices whose elements hold references are cleared before they are pooled,
+// the checked slices of those types implement Clear.
+var slices = []slice{
+	{Name: "Int64s", Lower: "int64s", Single: "Int64", Elem: "int64", Zero: "int64(0)"},
+	{Name: "Uint64s", Lower: "uint64s", Single: "Uint64", Elem: "uint64", Zero: "uint64(0)"},
+	{Name: "Ints", Lower: "ints", Single: "Int", Elem: "int", Zero: "int(0)"},
+	{Name: "Strings", Lower: "strings", Single: "String", Elem: "string", Zero: `""`, Clear: true},
+	{Name: "Times", Lower: "times", Single: "Time", Elem: "time.Time", Zero: "time.Time{}", Clear: true},
+}
+
+func main() {
+	var buf bytes.Buffer
+	if err := slicesTemplate.Execute(&buf, slices); err != nil {
+		log.Fatal(err)
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile("slices_gen.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+var slicesTemplate = template.Must(template.New("slices").Parse(`// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Code generated by gen_slices.go. DO NOT EDIT.
+
+package pool
+
+import (
+	"time"
+	"unsafe"
+
+	"github.com/m3db/m3x/checked"
+)
+{{range .}}
+type {{.Lower}}Pool struct {
+	slicesPool
+}
+
+// New{{.Name}}Pool creates a new {{.Elem}} slices pool
+func New{{.Name}}Pool(sizes []Bucket, opts ObjectPoolOptions) {{.Name}}Pool {
+	return &{{.Lower}}Pool{slicesPool{pool: NewBucketizedObjectPool(sizes, opts)}}
+}
+
+func (p *{{.Lower}}Pool) Init() {
+	p.pool.Init(func(capacity int) interface{} {
+		return make([]{{.Elem}}, 0, capacity)
+	})
+}
+
+func (p *{{.Lower}}Pool) Get(capacity int) []{{.Elem}} {
+	return p.pool.Get(capacity).([]{{.Elem}})
+}
+
+func (p *{{.Lower}}Pool) Put(value []{{.Elem}}) {
+{{- if .Clear}}
+	// Clear the values so that pooled slices do not retain references.
+	value = value[:cap(value)]
+	for i := range value {
+		value[i] = {{.Zero}}
+	}
+{{- end}}
+	value = value[:0]
+	p.pool.Put(value, cap(value))
+}
+
+// Append{{.Single}} appends a value to a {{.Elem}} slice getting a new slice from
+// the {{.Name}}Pool if the slice is at capacity
+func Append{{.Single}}(values []{{.Elem}}, value {{.Elem}}, pool {{.Name}}Pool) []{{.Elem}} {
+	if len(values) == cap(values) {
+		newValues := pool.Get(cap(values) * 2)
+		n := copy(newValues[:len(values)], values)
+		pool.Put(values)
+		values = newValues[:n]
+	}
+
+	return append(values, value)
+}
+
+type checked{{.Name}}Pool struct {
+	slicesPool
+}
+
+// NewChecked{{.Name}}Pool creates a new checked {{.Elem}} slices pool
+func NewChecked{{.Name}}Pool(sizes []Bucket, opts ObjectPoolOptions) Checked{{.Name}}Pool {
+	opts = withCheckedCapObjectSize(opts, int64(unsafe.Sizeof({{.Zero}})))
+	return &checked{{.Name}}Pool{slicesPool{pool: NewBucketizedObjectPool(sizes, opts)}}
+}
+
+func (p *checked{{.Name}}Pool) Init() {
+	p.initChecked(func(capacity int) checkedSlice {
+		return checked.New{{.Name}}(make([]{{.Elem}}, 0, capacity))
+	})
+}
+
+func (p *checked{{.Name}}Pool) Get(capacity int) checked.{{.Name}} {
+	return p.pool.Get(capacity).(checked.{{.Name}})
+}
+
+// Append{{.Single}}Checked appends a value to a checked {{.Elem}} slice getting a
+// new slice from the Checked{{.Name}}Pool if the slice is at capacity, the
+// original slice is not finalized when swapped
+func Append{{.Single}}Checked(
+	values checked.{{.Name}},
+	value {{.Elem}},
+	pool Checked{{.Name}}Pool,
+) (
+	result checked.{{.Name}},
+	swapped bool,
+) {
+	orig := values
+
+	if values.Len() == values.Cap() {
+		newValues := pool.Get(values.Cap() * 2)
+
+		// Inc the ref to write to it
+		newValues.IncRef()
+		newValues.AppendAll(values.Get())
+
+		values = newValues
+	}
+
+	values.Append(value)
+
+	result = values
+	swapped = orig != values
+
+	if swapped {
+		// No longer holding reference from the inc
+		result.DecRef()
+	}
+
+	return
+}
+{{end -}}
+`))
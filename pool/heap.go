@@ -21,6 +21,7 @@
 package pool
 
 import (
+	"context"
 	"reflect"
 	"sort"
 	"strconv"
@@ -33,8 +34,34 @@ import (
 	"github.com/uber-go/tally"
 )
 
+// NativeHeapOptions specify options for the native heap.
+type NativeHeapOptions struct {
+	// ReclaimAfter is how long an arena has to be fully free before it is
+	// released back to the system, if zero arenas are never released. Idle
+	// arenas are looked for in the background until the heap is closed.
+	ReclaimAfter time.Duration
+
+	// ReclaimFloor is the number of arenas kept per bucket even when idle.
+	ReclaimFloor int
+
+	// GuardPages places every segment on pages of its own which are
+	// protected while the segment is in the heap, see the overhead notes
+	// on NativePoolOptions.GuardPages before enabling it.
+	GuardPages bool
+}
+
 // NewNativeHeap constructs a new BytesPool based on NativePool.
 func NewNativeHeap(b []Bucket, po ObjectPoolOptions) BytesPool {
+	return NewNativeHeapWithOptions(b, po, NativeHeapOptions{})
+}
+
+// NewNativeHeapWithOptions constructs a new NativeHeap based on NativePool
+// with the given native heap options.
+func NewNativeHeapWithOptions(
+	b []Bucket,
+	po ObjectPoolOptions,
+	ho NativeHeapOptions,
+) NativeHeap {
 	if po == nil {
 		po = NewObjectPoolOptions()
 	}
@@ -47,8 +74,11 @@ func NewNativeHeap(b []Bucket, po ObjectPoolOptions) BytesPool {
 	sort.Sort(BucketByCapacity(b))
 
 	h := heap{l: po.InstrumentOptions().Logger(), m: heapMetrics{
-		overflows: m.Counter("overflows"),
+		overflows: newStatCounter(m.Counter("overflows")),
 		misplaces: m.Counter("misplaces"),
+	}, reclaim: &heapReclaimer{
+		every:  ho.ReclaimAfter / 4,
+		closed: make(chan struct{}),
 	}}
 
 	for _, cfg := range b {
@@ -57,28 +87,52 @@ func NewNativeHeap(b []Bucket, po ObjectPoolOptions) BytesPool {
 		})
 
 		s := &slot{class: cfg.Capacity, opts: NativePoolOptions{
-			Size: uint(cfg.Count),
-			Type: reflect.ArrayOf(cfg.Capacity, ByteType),
+			GuardPages: ho.GuardPages,
+			Size:       uint(cfg.Count),
+			Type:       reflect.ArrayOf(cfg.Capacity, ByteType),
 		}, m: slotMetrics{
-			free: m.Gauge("free"),
-			size: m.Gauge("total"),
+			free:       m.Gauge("free"),
+			size:       m.Gauge("total"),
+			arenas:     m.Gauge("arenas"),
+			allocs:     m.Counter("arenas-allocated"),
+			releases:   m.Counter("arenas-released"),
+			getOnEmpty: newStatCounter(m.Counter("get-on-empty")),
 		}}
 
+		s.reclaimAfter = ho.ReclaimAfter
+		s.reclaimFloor = ho.ReclaimFloor
+		s.idle = make(map[NativePool]time.Time)
+		s.nowFn = time.Now
+
 		h.slots = append(h.slots, s)
 	}
 
+	h.registration = registerPool(po, h)
+
 	return h
 }
 
 type heap struct {
 	slots []*slot
 
-	l xlog.Logger
-	m heapMetrics
+	l            xlog.Logger
+	m            heapMetrics
+	reclaim      *heapReclaimer
+	registration *registration
+}
+
+// heapReclaimer releases idle arenas in the background, checking a few
+// times per reclaim period bounds how long past the period an idle arena
+// can be kept.
+type heapReclaimer struct {
+	sync.Once
+
+	every  time.Duration
+	closed chan struct{}
 }
 
 type heapMetrics struct {
-	overflows tally.Counter
+	overflows *statCounter
 	misplaces tally.Counter
 }
 
@@ -89,12 +143,22 @@ type slot struct {
 	opts  NativePoolOptions
 	pools []NativePool
 
+	// Fully free arenas and since when, used to release idle arenas.
+	reclaimAfter time.Duration
+	reclaimFloor int
+	idle         map[NativePool]time.Time
+	nowFn        func() time.Time
+
 	m slotMetrics
 }
 
 type slotMetrics struct {
-	free tally.Gauge
-	size tally.Gauge
+	free       tally.Gauge
+	size       tally.Gauge
+	arenas     tally.Gauge
+	allocs     tally.Counter
+	releases   tally.Counter
+	getOnEmpty *statCounter
 }
 
 func (s *slot) get() interface{} {
@@ -107,12 +171,20 @@ func (s *slot) get() interface{} {
 	// Slow path - double-check that there are no segments left,
 	// then grow while holding an exclusive lock.
 	return s.getOr(s, func() interface{} {
-		p := NewNativePool(s.opts)
+		s.m.getOnEmpty.Inc(1)
+		p := s.newPool()
 		s.pools = append([]NativePool{p}, s.pools...)
+		s.m.arenas.Update(float64(len(s.pools)))
 		return p.Get()
 	})
 }
 
+func (s *slot) newPool() NativePool {
+	p := NewNativePool(s.opts)
+	s.m.allocs.Inc(1)
+	return p
+}
+
 func (s *slot) getOr(l sync.Locker, fn OverflowFn) interface{} {
 	var segment interface{}
 
@@ -149,7 +221,50 @@ func (s *slot) put(segment interface{}) {
 
 func (s *slot) init() {
 	// Preallocate a pool for each sizeclass to save time later.
-	s.pools = []NativePool{NewNativePool(s.opts)}
+	s.pools = []NativePool{s.newPool()}
+	s.m.arenas.Update(1)
+}
+
+func (s *slot) reclaim() {
+	s.Lock()
+	s.reclaimWithLock(s.nowFn())
+	s.Unlock()
+}
+
+// reclaimWithLock releases arenas that have been fully free for at least
+// the reclaim period while keeping at least the reclaim floor of arenas,
+// newer arenas are released first.
+func (s *slot) reclaimWithLock(now time.Time) {
+	pools := make([]NativePool, 0, len(s.pools))
+	for i, pool := range s.pools {
+		if free, size := pool.Size(); free != size {
+			delete(s.idle, pool)
+			pools = append(pools, pool)
+			continue
+		}
+
+		since, ok := s.idle[pool]
+		if !ok {
+			s.idle[pool] = now
+			pools = append(pools, pool)
+			continue
+		}
+
+		remaining := len(s.pools) - i - 1
+		if now.Sub(since) < s.reclaimAfter || len(pools)+remaining < s.reclaimFloor {
+			pools = append(pools, pool)
+			continue
+		}
+
+		delete(s.idle, pool)
+		if err := pool.Close(); err != nil {
+			panic("munmap() error: " + err.Error())
+		}
+		s.m.releases.Inc(1)
+	}
+
+	s.pools = pools
+	s.m.arenas.Update(float64(len(s.pools)))
 }
 
 func (s *slot) updateMetrics() {
@@ -175,10 +290,76 @@ func (s *slot) updateMetrics() {
 	s.m.size.Update(float64(size))
 }
 
+// stats reports the number of segments in each bucket, gets which had to
+// allocate a new arena are reported as gets on empty, as are gets larger than
+// any bucket which are allocated directly from the system.
+func (p heap) stats() PoolStats {
+	result := PoolStats{
+		Type:       NativePoolType.String(),
+		GetOnEmpty: p.m.overflows.Value(),
+	}
+	for _, s := range p.slots {
+		bucket := BucketStats{
+			Capacity:   s.class,
+			GetOnEmpty: s.m.getOnEmpty.Value(),
+		}
+
+		s.RLock()
+		for _, pool := range s.pools {
+			free, size := pool.Size()
+			bucket.Size += int(s.opts.Size)
+			bucket.Free += int(free * uint64(s.opts.Size) / size)
+		}
+		s.RUnlock()
+
+		result.Buckets = append(result.Buckets, bucket)
+		result.Size += bucket.Size
+		result.Free += bucket.Free
+		result.GetOnEmpty += bucket.GetOnEmpty
+	}
+	return result
+}
+
+// WaitReady returns immediately since the native heap allocates its arenas
+// on Init.
+func (p heap) WaitReady(ctx context.Context) error {
+	return nil
+}
+
 func (p heap) Init() {
 	for _, s := range p.slots {
 		s.init()
 	}
+
+	if p.reclaim.every > 0 {
+		go p.reclaimLoop()
+	}
+}
+
+func (p heap) reclaimLoop() {
+	ticker := time.NewTicker(p.reclaim.every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, s := range p.slots {
+				s.reclaim()
+			}
+		case <-p.reclaim.closed:
+			return
+		}
+	}
+}
+
+// Close stops releasing idle arenas in the background and unregisters the
+// heap from the pool registry, the heap may still be used after closing.
+func (p heap) Close() error {
+	p.reclaim.Do(func() {
+		close(p.reclaim.closed)
+		p.registration.unregister()
+	})
+	return nil
 }
 
 func (p heap) pick(class int, action func(*slot)) bool {
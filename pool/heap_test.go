@@ -23,9 +23,14 @@ package pool
 import (
 	"runtime"
 	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/m3db/m3x/instrument"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
 )
 
 func TestNativeHeapBasics(t *testing.T) {
@@ -100,6 +105,156 @@ func TestNativeHeapLargePutMisplacedOk(t *testing.T) {
 	h.Put(make([]byte, 257))
 }
 
+func TestNativeHeapGuardPages(t *testing.T) {
+	h := NewNativeHeapWithOptions([]Bucket{
+		Bucket{Capacity: 128, Count: 2},
+		Bucket{Capacity: 256, Count: 2},
+	}, nil, NativeHeapOptions{GuardPages: true})
+
+	h.Init()
+
+	b := h.Get(100)[:100]
+	require.False(t, faults(func() { b[99] = 'x' }))
+
+	h.Put(b)
+	require.True(t, faults(func() { b[0] = 'x' }))
+
+	b = h.Get(100)[:100]
+	require.False(t, faults(func() { require.Equal(t, byte('x'), b[99]) }))
+	h.Put(b)
+}
+
+func TestNativeHeapReclaimIdleArenas(t *testing.T) {
+	scope := tally.NewTestScope("", nil)
+	h := NewNativeHeapWithOptions([]Bucket{
+		Bucket{Capacity: 128, Count: 2},
+	}, NewObjectPoolOptions().SetInstrumentOptions(
+		instrument.NewOptions().SetMetricsScope(scope),
+	), NativeHeapOptions{
+		ReclaimAfter: time.Minute,
+		ReclaimFloor: 1,
+	})
+
+	h.Init()
+	defer h.Close()
+
+	var segments [][]byte
+	for i := 0; i < 6; i++ {
+		segments = append(segments, h.Get(100))
+	}
+
+	s := h.(heap).slots[0]
+	require.Equal(t, 3, len(s.pools))
+
+	// Keep one segment of the newest arena busy.
+	busy := s.pools[0]
+	for _, segment := range segments {
+		if busy.Owns(unsafe.Pointer(&segment[:1][0])) {
+			continue
+		}
+		h.Put(segment)
+	}
+
+	now := time.Now()
+
+	s.Lock()
+	s.reclaimWithLock(now)
+	s.Unlock()
+	require.Equal(t, 3, len(s.pools))
+
+	s.Lock()
+	s.reclaimWithLock(now.Add(time.Minute))
+	s.Unlock()
+	require.Equal(t, 1, len(s.pools))
+	assert.True(t, busy == s.pools[0])
+
+	counters := scope.Snapshot().Counters()
+	assert.Equal(t, int64(3), counters["arenas-allocated+bucket-capacity=128"].Value())
+	assert.Equal(t, int64(2), counters["arenas-released+bucket-capacity=128"].Value())
+	gauges := scope.Snapshot().Gauges()
+	assert.Equal(t, 1.0, gauges["arenas+bucket-capacity=128"].Value())
+}
+
+func TestNativeHeapReclaimFloor(t *testing.T) {
+	h := NewNativeHeapWithOptions([]Bucket{
+		Bucket{Capacity: 128, Count: 1},
+	}, nil, NativeHeapOptions{
+		ReclaimAfter: time.Minute,
+		ReclaimFloor: 2,
+	})
+
+	h.Init()
+	defer h.Close()
+
+	var segments [][]byte
+	for i := 0; i < 4; i++ {
+		segments = append(segments, h.Get(100))
+	}
+	for _, segment := range segments {
+		h.Put(segment)
+	}
+
+	s := h.(heap).slots[0]
+	require.Equal(t, 4, len(s.pools))
+
+	now := time.Now()
+	for _, at := range []time.Time{now, now.Add(time.Minute)} {
+		s.Lock()
+		s.reclaimWithLock(at)
+		s.Unlock()
+	}
+	require.Equal(t, 2, len(s.pools))
+
+	// Released arenas are allocated again on demand.
+	for i := 0; i < 4; i++ {
+		require.NotNil(t, h.Get(100))
+	}
+	require.Equal(t, 4, len(s.pools))
+}
+
+func TestNativeHeapReclaimInBackground(t *testing.T) {
+	h := NewNativeHeapWithOptions([]Bucket{
+		Bucket{Capacity: 128, Count: 1},
+	}, nil, NativeHeapOptions{
+		ReclaimAfter: 20 * time.Millisecond,
+		ReclaimFloor: 1,
+	})
+
+	h.Init()
+
+	s := h.(heap).slots[0]
+	numPools := func() int {
+		s.RLock()
+		defer s.RUnlock()
+		return len(s.pools)
+	}
+
+	var segments [][]byte
+	for i := 0; i < 3; i++ {
+		segments = append(segments, h.Get(100))
+	}
+	for _, segment := range segments {
+		h.Put(segment)
+	}
+	require.Equal(t, 3, numPools())
+
+	// The heap goes quiet, idle arenas are released without gets or puts.
+	for start := time.Now(); numPools() > 1; time.Sleep(time.Millisecond) {
+		require.True(t, time.Since(start) < 5*time.Second, "arenas not released")
+	}
+
+	// No arenas are released once closed.
+	require.NoError(t, h.Close())
+	for i := 0; i < 3; i++ {
+		segments[i] = h.Get(100)
+	}
+	for _, segment := range segments {
+		h.Put(segment)
+	}
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 3, numPools())
+}
+
 func BenchmarkNativeHeap(b *testing.B) {
 	heap := NewNativeHeap([]Bucket{
 		Bucket{Capacity: 128, Count: 4},
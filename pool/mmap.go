@@ -25,8 +25,13 @@ import "syscall"
 const (
 	mmapReadWriteAccess = syscall.PROT_READ | syscall.PROT_WRITE
 	mmapMemory          = syscall.MAP_ANON | syscall.MAP_PRIVATE
+	mmapNoAccess        = syscall.PROT_NONE
 )
 
 func munmap(head []byte) error {
 	return syscall.Munmap(head)
 }
+
+func mprotect(b []byte, prot int) error {
+	return syscall.Mprotect(b, prot)
+}
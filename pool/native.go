@@ -21,19 +21,80 @@
 package pool
 
 import (
+	"math"
+	"os"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"unsafe"
 )
 
 // NativePoolOptions specify options for NativePool.
 type NativePoolOptions struct {
+	// Construct is called once for every object when the arena is created.
 	Construct func(ptr interface{})
-	Size      uint
-	Type      reflect.Type
+
+	// Reset is called for an object whenever it is put back to the pool.
+	Reset func(ptr interface{})
+
+	// Destroy is called once for every object before the arena is
+	// released back to the system on Close.
+	Destroy func(ptr interface{})
+
+	// ZeroOnPut zeroes the memory of an object after Reset whenever it is
+	// put back to the pool, so that no stale data leaks between users of a
+	// slot. Note that Construct is not called again, so objects relying on
+	// state set up by Construct should restore it in Reset instead.
+	ZeroOnPut bool
+
+	// Align is the alignment of every object in the arena in bytes, it must
+	// be a power of two no larger than the page size. Zero means the natural
+	// alignment of Type. Aligning to CacheLineAlign keeps neighbouring
+	// objects from sharing cache lines at the cost of padding every slot
+	// up to a multiple of the alignment.
+	Align uint
+
+	// GuardPages is a debug mode to catch objects used after being put back
+	// to the pool, which the race detector cannot see in native memory.
+	// Every object is placed on pages of its own which are protected from
+	// any access while the object is in the pool, so that stray reads and
+	// writes fault immediately. Align is ignored in this mode.
+	//
+	// Only use after put is caught, not overflows of objects in use: the
+	// header page of the next slot directly follows an object and is always
+	// accessible, so writes past the end of an object corrupt the header
+	// instead of faulting. An overflow is only caught if it reaches the
+	// object pages of a slot that is in the pool.
+	//
+	// The overhead is considerable and the mode is meant for staging only:
+	//  - every object takes one page for its header plus its size rounded
+	//    up to whole pages, e.g. a 128 byte object takes 8KiB with 4KiB
+	//    pages, 64 times as much memory as without guard pages;
+	//  - every Get and Put makes an mprotect system call which also flushes
+	//    the TLB, BenchmarkNativePool and BenchmarkNativePoolGuardPages
+	//    measured a Get and Put round trip at about 75ns without and 2800ns
+	//    with guard pages on a Linux amd64 Xeon, about 40 times slower;
+	//  - every protected object is a separate memory mapping, pools with
+	//    more objects than about half of vm.max_map_count (65530 by default
+	//    on Linux) fail with an mprotect error.
+	GuardPages bool
+
+	Size uint
+	Type reflect.Type
 }
 
+// CacheLineAlign is the alignment which gives every object of a NativePool
+// cache lines of its own.
+const CacheLineAlign uint = 64
+
+// PageAlign is the alignment which gives every object of a NativePool
+// pages of its own.
+var PageAlign = uint(os.Getpagesize())
+
 // NativePool represents an object pool which is opaque to the Go GC.
 type NativePool interface {
+	// Get provides an object from the pool, waiting for one to be put
+	// back if the pool is empty.
 	Get() interface{}
 	GetOr(OverflowFn) interface{}
 	Put(interface{})
@@ -43,6 +104,10 @@ type NativePool interface {
 
 	// Size returns the available and the total capacity of the pool.
 	Size() (uint64, uint64)
+
+	// Close releases the memory of the pool back to the system, objects
+	// from the pool must not be used once it is closed.
+	Close() error
 }
 
 // OverflowFn produces non-pooled objects.
@@ -50,22 +115,43 @@ type OverflowFn func() interface{}
 
 // NewNativePool constructs a new NativePool.
 func NewNativePool(opts NativePoolOptions) NativePool {
-	p := &nativePool{
-		free: make(chan uint64, opts.Size),
-		opts: opts,
-		// TODO(@kobolog): alignment & padding.
-		step: uint64(hsz + opts.Type.Size())}
+	if opts.Size == 0 {
+		panic("native-pool: pool size is zero")
+	}
 
-	p.size = uint64(p.opts.Size) * p.step
+	if uint64(opts.Size) > nativeFreeSlotMask {
+		panic("native-pool: pool size is too large")
+	}
 
-	if p.size == 0 {
-		panic("native-pool: pool size is zero")
+	align := uint64(opts.Align)
+	if opts.GuardPages {
+		align = uint64(PageAlign)
+	} else if align == 0 {
+		align = uint64(opts.Type.Align())
 	}
 
-	if p.step%uint64(p.opts.Type.Align()) != 0 {
+	if align&(align-1) != 0 || align > uint64(PageAlign) ||
+		align%uint64(opts.Type.Align()) != 0 {
 		panic("native-pool: invalid alignment")
 	}
 
+	// Headers are accessed atomically, so slots are never aligned to less
+	// than the header alignment.
+	if align < uint64(hal) {
+		align = uint64(hal)
+	}
+
+	// Every slot is laid out as struct { pad; hdr; T; pad } with the header
+	// immediately in front of the object, the object offset within the slot
+	// and the slot size are both multiples of the alignment, and the arena
+	// itself is page aligned, so every object ends up aligned. With guard
+	// pages this leaves the header on a page of its own in front of the
+	// object pages, so the free list can be used while objects are protected.
+	p := &nativePool{opts: opts, off: alignUp(uint64(hsz), align)}
+	p.cond = sync.NewCond(&p.mu)
+	p.step = alignUp(p.off+uint64(opts.Type.Size()), align)
+	p.size = uint64(p.opts.Size) * p.step
+
 	if p.opts.Construct == nil {
 		p.opts.Construct = func(interface{}) {}
 	}
@@ -80,21 +166,57 @@ type hdr struct {
 	// to use uint64 to address > 4GB and for the hdr structure to be
 	// aligned at the largest possible value.
 	idx uint64
+
+	// Link to the next free slot while this slot is on the free list,
+	// encoded the same way as the slot part of nativePool.head, or
+	// nativeSlotInUse while the object is handed out.
+	next uint64
 }
 
-// Header size with padding, as determined by the compiler.
-const hsz = unsafe.Sizeof(*(*hdr)(nil))
+const (
+	// Header size with padding, as determined by the compiler.
+	hsz = unsafe.Sizeof(*(*hdr)(nil))
+
+	// Header alignment, slots are padded so that every header stays
+	// aligned for atomic access.
+	hal = unsafe.Alignof(*(*hdr)(nil))
+)
+
+// The head of the free list packs the slot number plus one (zero meaning
+// an empty list) into the low bits and a generation counter into the high
+// bits, so that a head which was popped and pushed back in between a load
+// and a compare-and-swap is never mistaken for an unchanged one (ABA).
+const (
+	nativeFreeSlotBits = 32
+	nativeFreeSlotMask = math.MaxUint32
+
+	// Link of a slot that is not on the free list, used to catch an object
+	// put back twice which would otherwise make the free list a cycle.
+	nativeSlotInUse = math.MaxUint64
+)
 
 type nativePool struct {
-	pool       []byte
-	free       chan uint64
-	opts       NativePoolOptions
+	pool []byte
+	head uint64
+	free int64
+	opts NativePoolOptions
+
+	// Gets on an empty pool wait for a put.
+	mu      sync.Mutex
+	cond    *sync.Cond
+	waiters int32
+
+	// Offset of the object from the start of its slot.
+	off        uint64
 	step, size uint64
 }
 
+func alignUp(v, align uint64) uint64 {
+	return (v + align - 1) / align * align
+}
+
 func (p *nativePool) init() {
-	// Heap is a slice of bytes large enough to fit opts.Size objects
-	// of type struct { hdr; T }.
+	// Heap is a slice of bytes large enough to fit opts.Size slots.
 	if r, err := mmap(int(p.size)); err != nil {
 		panic("mmap() error: " + err.Error())
 	} else {
@@ -102,37 +224,130 @@ func (p *nativePool) init() {
 	}
 
 	for i := uint64(0); i < p.size; i += p.step {
-		hdr := (*hdr)(unsafe.Pointer(&p.pool[i]))
-		hdr.idx = i + uint64(hsz)
+		hdr := (*hdr)(unsafe.Pointer(&p.pool[i+p.off-uint64(hsz)]))
+		hdr.idx = i + p.off
 		ptr := unsafe.Pointer(&p.pool[hdr.idx])
 
 		p.opts.Construct(reflect.NewAt(p.opts.Type, ptr).Interface())
+	}
+
+	// The free list lives in the slot headers themselves, so it does not
+	// keep any GC-visible objects around. Slots are pushed in reverse for
+	// the first Get to return the lowest address.
+	for i := p.size; i > 0; i -= p.step {
+		p.push(i/p.step - 1)
+		p.protect(i/p.step-1, mmapNoAccess)
+	}
+}
+
+// protect changes the protection of the object pages of a slot when guard
+// pages are enabled.
+func (p *nativePool) protect(n uint64, prot int) {
+	if !p.opts.GuardPages {
+		return
+	}
+
+	b := p.pool[n*p.step+p.off : (n+1)*p.step]
+	if len(b) == 0 {
+		return
+	}
 
-		// Alternatively, we can use a channel of interfaces, but it
-		// would keep opts.Size objects rooted in the channel.
-		// We aim to avoid allocating unnecessary GC-visible objects.
-		p.free <- hdr.idx
+	if err := mprotect(b, prot); err != nil {
+		panic("mprotect() error: " + err.Error())
 	}
 }
 
+func (p *nativePool) slot(n uint64) *hdr {
+	return (*hdr)(unsafe.Pointer(&p.pool[n*p.step+p.off-uint64(hsz)]))
+}
+
+func (p *nativePool) push(n uint64) {
+	hdr := p.slot(n)
+
+	for {
+		head := atomic.LoadUint64(&p.head)
+		atomic.StoreUint64(&hdr.next, head&nativeFreeSlotMask)
+
+		next := (head>>nativeFreeSlotBits+1)<<nativeFreeSlotBits | (n + 1)
+		if atomic.CompareAndSwapUint64(&p.head, head, next) {
+			break
+		}
+	}
+
+	atomic.AddInt64(&p.free, 1)
+
+	if atomic.LoadInt32(&p.waiters) > 0 {
+		p.mu.Lock()
+		p.cond.Signal()
+		p.mu.Unlock()
+	}
+}
+
+func (p *nativePool) pop() (uint64, bool) {
+	for {
+		head := atomic.LoadUint64(&p.head)
+		top := head & nativeFreeSlotMask
+
+		if top == 0 {
+			return 0, false
+		}
+
+		// The slot may be concurrently popped and handed out, in which case
+		// its link is stale, but the generation in the head will have moved
+		// on and the swap below fails.
+		link := atomic.LoadUint64(&p.slot(top - 1).next)
+
+		next := (head>>nativeFreeSlotBits+1)<<nativeFreeSlotBits | link
+		if atomic.CompareAndSwapUint64(&p.head, head, next) {
+			atomic.StoreUint64(&p.slot(top-1).next, nativeSlotInUse)
+			atomic.AddInt64(&p.free, -1)
+			return top - 1, true
+		}
+	}
+}
+
+// take makes a slot popped from the free list accessible.
+func (p *nativePool) take(n uint64) interface{} {
+	p.protect(n, mmapReadWriteAccess)
+	return p.object(n)
+}
+
+func (p *nativePool) object(n uint64) interface{} {
+	return reflect.NewAt(
+		p.opts.Type, unsafe.Pointer(&p.pool[p.slot(n).idx])).Interface()
+}
+
 func (p *nativePool) Size() (uint64, uint64) {
-	return uint64(len(p.free)) * p.step, p.size
+	return uint64(atomic.LoadInt64(&p.free)) * p.step, p.size
 }
 
 // Get provides an object from the pool.
 func (p *nativePool) Get() interface{} {
-	return reflect.NewAt(
-		p.opts.Type, unsafe.Pointer(&p.pool[<-p.free])).Interface()
+	if n, ok := p.pop(); ok {
+		return p.take(n)
+	}
+
+	// Waiters are counted before popping again so that a put either sees
+	// the waiter and signals it or pushes before the pop below.
+	p.mu.Lock()
+	atomic.AddInt32(&p.waiters, 1)
+	for {
+		if n, ok := p.pop(); ok {
+			atomic.AddInt32(&p.waiters, -1)
+			p.mu.Unlock()
+			return p.take(n)
+		}
+
+		p.cond.Wait()
+	}
 }
 
 func (p *nativePool) GetOr(fn OverflowFn) interface{} {
-	select {
-	case next := <-p.free:
-		return reflect.NewAt(
-			p.opts.Type, unsafe.Pointer(&p.pool[next])).Interface()
-	default:
-		return fn()
+	if n, ok := p.pop(); ok {
+		return p.take(n)
 	}
+
+	return fn()
 }
 
 // Put returns an object to the pool.
@@ -145,18 +360,62 @@ func (p *nativePool) Put(object interface{}) {
 
 	// We know that this object is in our arena, so it's okay
 	// to read memory directly in front of it.
-	p.free <- (*hdr)(unsafe.Pointer(uintptr(ptr) - hsz)).idx
+	hdr := (*hdr)(unsafe.Pointer(uintptr(ptr) - hsz))
+	if !atomic.CompareAndSwapUint64(&hdr.next, nativeSlotInUse, 0) {
+		panic("native-pool: object put back twice")
+	}
+
+	if p.opts.Reset != nil {
+		p.opts.Reset(object)
+	}
+
+	idx := hdr.idx
+
+	if p.opts.ZeroOnPut {
+		b := p.pool[idx : idx+uint64(p.opts.Type.Size())]
+		for i := range b {
+			b[i] = 0
+		}
+	}
+
+	n := (idx - p.off) / p.step
+	p.protect(n, mmapNoAccess)
+	p.push(n)
 }
 
 func (p *nativePool) owns(addr unsafe.Pointer) bool {
-	if (uintptr(addr) >= uintptr(unsafe.Pointer(&p.pool[0]))) &&
-		uintptr(addr) <= uintptr(unsafe.Pointer(&p.pool[p.size-1])) {
-		return true
+	if len(p.pool) == 0 {
+		return false
+	}
+
+	base := uintptr(unsafe.Pointer(&p.pool[0]))
+	if uintptr(addr) < base || uintptr(addr) >= base+uintptr(p.size) {
+		return false
 	}
 
-	return false
+	// Only pointers to the objects themselves are owned, not pointers
+	// into their interior or into the slot padding.
+	return uint64(uintptr(addr)-base)%p.step == p.off
 }
 
 func (p *nativePool) Owns(object interface{}) bool {
 	return p.owns(unsafe.Pointer(reflect.ValueOf(object).Pointer()))
 }
+
+func (p *nativePool) Close() error {
+	if p.pool == nil {
+		return nil
+	}
+
+	if p.opts.Destroy != nil {
+		for i := uint64(0); i < p.size; i += p.step {
+			p.protect(i/p.step, mmapReadWriteAccess)
+			p.opts.Destroy(p.object(i / p.step))
+		}
+	}
+
+	err := munmap(p.pool)
+	p.pool = nil
+
+	return err
+}
@@ -23,8 +23,12 @@ package pool
 import (
 	"reflect"
 	"runtime"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+	"unsafe"
 
 	"github.com/stretchr/testify/require"
 )
@@ -122,6 +126,306 @@ func TestNativePoolErrors(t *testing.T) {
 	})
 }
 
+func TestNativePoolLifecycleHooks(t *testing.T) {
+	var constructed, reset, destroyed int
+
+	ts := NewNativePool(NativePoolOptions{
+		Construct: func(ptr interface{}) {
+			constructed++
+			ptr.(*U).v = -1
+		},
+		Reset: func(ptr interface{}) {
+			reset++
+			require.Equal(t, 42, ptr.(*U).v)
+		},
+		Destroy: func(ptr interface{}) {
+			destroyed++
+		},
+		Size: 4,
+		Type: reflect.TypeOf(U{})})
+
+	require.Equal(t, 4, constructed)
+
+	v := ts.Get().(*U)
+	require.Equal(t, -1, v.v)
+
+	v.v = 42
+	ts.Put(v)
+	require.Equal(t, 1, reset)
+
+	// Without ZeroOnPut the state is retained.
+	require.Equal(t, 42, ts.Get().(*U).v)
+
+	require.NoError(t, ts.Close())
+	require.Equal(t, 4, destroyed)
+}
+
+func TestNativePoolZeroOnPut(t *testing.T) {
+	ts := NewNativePool(NativePoolOptions{
+		Construct: func(ptr interface{}) {
+			ptr.(*T).z = -1
+		},
+		ZeroOnPut: true,
+		Size:      1,
+		Type:      reflect.TypeOf(T{})})
+
+	v := ts.Get().(*T)
+	require.Equal(t, -1, v.z)
+
+	v.z = 42
+	v.y[len(v.y)-1] = 0xff
+	ts.Put(v)
+
+	v = ts.Get().(*T)
+	require.Equal(t, 0, v.z)
+	require.Equal(t, byte(0), v.y[len(v.y)-1])
+}
+
+func TestNativePoolFreeList(t *testing.T) {
+	ts := NewNativePool(NativePoolOptions{
+		Size: 3,
+		Type: reflect.TypeOf([5]byte{})})
+
+	free, total := ts.Size()
+	require.Equal(t, free, total)
+
+	a := ts.Get().(*[5]byte)
+	b := ts.Get().(*[5]byte)
+	c := ts.Get().(*[5]byte)
+
+	// Slots are padded to keep the headers aligned.
+	require.Equal(t, uintptr(24), uintptr(unsafe.Pointer(b))-uintptr(unsafe.Pointer(a)))
+	require.Equal(t, uintptr(24), uintptr(unsafe.Pointer(c))-uintptr(unsafe.Pointer(b)))
+
+	free, _ = ts.Size()
+	require.Equal(t, uint64(0), free)
+	require.Nil(t, ts.GetOr(func() interface{} { return nil }))
+
+	// Pointers into the interior of an object are not owned.
+	require.True(t, ts.Owns(b))
+	require.False(t, ts.Owns(&b[1]))
+
+	// Last in, first out.
+	ts.Put(a)
+	ts.Put(c)
+	require.True(t, ts.Get().(*[5]byte) == c)
+	require.True(t, ts.Get().(*[5]byte) == a)
+}
+
+func TestNativePoolDoublePut(t *testing.T) {
+	ts := NewNativePool(NativePoolOptions{
+		Size: 2,
+		Type: reflect.TypeOf([5]byte{})})
+
+	a := ts.Get()
+	ts.Put(a)
+	require.Panics(t, func() {
+		ts.Put(a)
+	})
+
+	// The free list is intact, every slot is handed out once.
+	first, second := ts.Get(), ts.Get()
+	require.False(t, first == second)
+	require.Nil(t, ts.GetOr(func() interface{} { return nil }))
+}
+
+func TestNativePoolGetWaitsForPut(t *testing.T) {
+	ts := NewNativePool(NativePoolOptions{
+		Size: 1,
+		Type: reflect.TypeOf([5]byte{})})
+
+	a := ts.Get()
+
+	got := make(chan interface{})
+	go func() {
+		got <- ts.Get()
+	}()
+
+	// The get waits parked until the object is put back.
+	for atomic.LoadInt32(&ts.(*nativePool).waiters) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-got:
+		require.FailNow(t, "get returned from an empty pool")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	ts.Put(a)
+	require.True(t, a == <-got)
+	require.Equal(t, int32(0), atomic.LoadInt32(&ts.(*nativePool).waiters))
+}
+
+func TestNativePoolConcurrentGetPut(t *testing.T) {
+	const (
+		size       = 16
+		goroutines = 8
+		iterations = 10000
+	)
+
+	ts := NewNativePool(NativePoolOptions{
+		Size: size,
+		Type: reflect.TypeOf(U{})})
+
+	var wg sync.WaitGroup
+
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+
+		go func(id int) {
+			defer wg.Done()
+
+			for i := 0; i < iterations; i++ {
+				v := ts.Get().(*U)
+
+				// No other goroutine can hold the same slot.
+				v.Set(id)
+				runtime.Gosched()
+				require.Equal(t, id, v.Get())
+
+				ts.Put(v)
+			}
+		}(g)
+	}
+
+	wg.Wait()
+
+	free, total := ts.Size()
+	require.Equal(t, total, free)
+
+	seen := make(map[*U]struct{}, size)
+	for i := 0; i < size; i++ {
+		seen[ts.Get().(*U)] = struct{}{}
+	}
+
+	require.Len(t, seen, size)
+}
+
+func TestNativePoolAlignment(t *testing.T) {
+	types := []reflect.Type{
+		reflect.TypeOf([5]byte{}),
+		reflect.TypeOf(U{}),
+		reflect.TypeOf(T{}),
+	}
+
+	aligns := []uint{0, 8, 16, CacheLineAlign, PageAlign}
+
+	for _, typ := range types {
+		for _, align := range aligns {
+			const size = 8
+
+			ts := NewNativePool(NativePoolOptions{
+				Align: align,
+				Size:  size,
+				Type:  typ})
+
+			want := uintptr(align)
+			if want == 0 {
+				want = uintptr(typ.Align())
+			}
+
+			objects := make([]interface{}, 0, size)
+			for i := 0; i < size; i++ {
+				v := ts.GetOr(func() interface{} { return nil })
+				require.NotNil(t, v)
+
+				addr := reflect.ValueOf(v).Pointer()
+				require.Equal(t, uintptr(0), addr%want,
+					"type %v, align %d, slot %d", typ, align, i)
+
+				// Objects never share the aligned block of another object.
+				for _, o := range objects {
+					other := reflect.ValueOf(o).Pointer()
+					require.True(t, addr/want != other/want)
+				}
+
+				require.True(t, ts.Owns(v))
+
+				objects = append(objects, v)
+			}
+
+			for _, v := range objects {
+				ts.Put(v)
+			}
+
+			free, total := ts.Size()
+			require.Equal(t, total, free)
+			require.NoError(t, ts.Close())
+		}
+	}
+}
+
+func TestNativePoolAlignmentErrors(t *testing.T) {
+	for _, align := range []uint{3, 12, 2 * PageAlign} {
+		require.Panics(t, func() {
+			NewNativePool(NativePoolOptions{
+				Align: align,
+				Size:  1,
+				Type:  reflect.TypeOf(U{})})
+		})
+	}
+
+	// Alignment below the natural alignment of the type.
+	require.Panics(t, func() {
+		NewNativePool(NativePoolOptions{
+			Align: 1,
+			Size:  1,
+			Type:  reflect.TypeOf(U{})})
+	})
+}
+
+// faults reports whether fn faults on a memory access.
+func faults(fn func()) (faulted bool) {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		faulted = recover() != nil
+	}()
+
+	fn()
+
+	return false
+}
+
+func TestNativePoolGuardPages(t *testing.T) {
+	destroyed := 0
+
+	ts := NewNativePool(NativePoolOptions{
+		Construct: func(ptr interface{}) {
+			ptr.(*U).v = -1
+		},
+		Destroy: func(ptr interface{}) {
+			require.Equal(t, -1, ptr.(*U).v)
+			destroyed++
+		},
+		GuardPages: true,
+		Size:       2,
+		Type:       reflect.TypeOf(U{})})
+
+	v := ts.Get().(*U)
+	require.Equal(t, uintptr(0), uintptr(unsafe.Pointer(v))%uintptr(PageAlign))
+	require.False(t, faults(func() { v.v = -1 }))
+
+	// Objects in the pool fault on any access.
+	w := ts.Get().(*U)
+	ts.Put(w)
+	require.True(t, faults(func() { _ = w.v }))
+	require.True(t, faults(func() { w.v = 42 }))
+
+	ts.Put(v)
+	require.True(t, faults(func() { v.v = 42 }))
+
+	// And become accessible once handed out again.
+	v = ts.Get().(*U)
+	require.False(t, faults(func() { require.Equal(t, -1, v.v) }))
+	ts.Put(v)
+
+	free, total := ts.Size()
+	require.Equal(t, total, free)
+
+	require.NoError(t, ts.Close())
+	require.Equal(t, 2, destroyed)
+}
+
 func BenchmarkNativePool(b *testing.B) {
 	ts := NewNativePool(NativePoolOptions{
 		Size: 5,
@@ -131,3 +435,14 @@ func BenchmarkNativePool(b *testing.B) {
 		ts.Put(ts.Get())
 	}
 }
+
+func BenchmarkNativePoolGuardPages(b *testing.B) {
+	ts := NewNativePool(NativePoolOptions{
+		GuardPages: true,
+		Size:       5,
+		Type:       reflect.TypeOf(T{})})
+
+	for n := 0; n <= b.N; n++ {
+		ts.Put(ts.Get())
+	}
+}
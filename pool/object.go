@@ -21,8 +21,10 @@
 package pool
 
 import (
+	"context"
 	"errors"
 	"math"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -33,6 +35,14 @@ var (
 	errPoolAlreadyInitialized   = errors.New("object pool already initialized")
 	errPoolGetBeforeInitialized = errors.New("object pool get before initialized")
 	errPoolPutBeforeInitialized = errors.New("object pool put before initialized")
+	errPoolDoublePut            = errors.New("object pool double put")
+	errPoolPutForeignObject     = errors.New("object pool put of foreign object")
+)
+
+var (
+	// ErrPoolGetTimeout is returned when a bounded object pool get times out
+	// waiting for an object to be returned to the pool.
+	ErrPoolGetTimeout = errors.New("object pool get timed out")
 )
 
 const (
@@ -47,44 +57,95 @@ type objectPool struct {
 	size                int
 	refillLowWatermark  int
 	refillHighWatermark int
+	limit               *outstandingLimit
+	adaptive            *adaptiveSizer
+	tracker             *poolTracker
+	warmer              *warmer
+	budget              *budgetAccount
 	filling             int32
 	initialized         int32
 	metrics             objectPoolMetrics
 }
 
 type objectPoolMetrics struct {
-	free       tally.Gauge
-	total      tally.Gauge
-	getOnEmpty tally.Counter
-	putOnFull  tally.Counter
+	free           tally.Gauge
+	total          tally.Gauge
+	waiters        tally.Gauge
+	getOnEmpty     *statCounter
+	getOnLimit     tally.Counter
+	getTimeout     tally.Counter
+	getWaitLatency tally.Timer
+	putOnFull      *statCounter
+}
+
+func newObjectPoolMetrics(m tally.Scope) objectPoolMetrics {
+	return objectPoolMetrics{
+		free:           m.Gauge("free"),
+		total:          m.Gauge("total"),
+		waiters:        m.Gauge("waiters"),
+		getOnEmpty:     newStatCounter(m.Counter("get-on-empty")),
+		getOnLimit:     m.Counter("get-on-limit"),
+		getTimeout:     m.Counter("get-timeout"),
+		getWaitLatency: m.Timer("get-wait-latency"),
+		putOnFull:      newStatCounter(m.Counter("put-on-full")),
+	}
 }
 
-// NewObjectPool creates a new pool
+// NewObjectPool creates a new pool, options the pool type does not support
+// are reported to the on pool access error callback and a channel pool is
+// created instead.
 func NewObjectPool(opts ObjectPoolOptions) ObjectPool {
 	if opts == nil {
 		opts = NewObjectPoolOptions()
 	}
 
+	switch opts.Type() {
+	case ShardedObjectPoolType:
+		p, err := newShardedObjectPool(opts)
+		if err == nil {
+			return p
+		}
+		fn := opts.OnPoolAccessErrorFn()
+		fn(err)
+	case SyncObjectPoolType:
+		p, err := newSyncObjectPool(opts)
+		if err == nil {
+			return p
+		}
+		fn := opts.OnPoolAccessErrorFn()
+		fn(err)
+	}
+
 	m := opts.InstrumentOptions().MetricsScope()
 
 	p := &objectPool{
-		opts:   opts,
-		values: make(chan interface{}, opts.Size()),
-		size:   opts.Size(),
+		opts: opts,
+		size: opts.Size(),
 		refillLowWatermark: int(math.Ceil(
 			opts.RefillLowWatermark() * float64(opts.Size()))),
 		refillHighWatermark: int(math.Ceil(
 			opts.RefillHighWatermark() * float64(opts.Size()))),
-		metrics: objectPoolMetrics{
-			free:       m.Gauge("free"),
-			total:      m.Gauge("total"),
-			getOnEmpty: m.Counter("get-on-empty"),
-			putOnFull:  m.Counter("put-on-full"),
-		},
+		metrics: newObjectPoolMetrics(m),
 	}
 
+	capacity := p.size
+	if opts.AdaptiveSizeOptions() != nil {
+		p.adaptive = newAdaptiveSizer(p.size, opts, p.resize, p.numFree)
+		// Allocate enough room to grow up to the max size.
+		capacity = p.adaptive.maxSize
+	}
+	p.values = make(chan interface{}, capacity)
+
+	p.limit = newOutstandingLimit(opts.MaxOutstanding(), &p.metrics)
+	p.warmer = newWarmer(opts)
+	p.budget = newBudgetAccount(opts, m)
+
+	p.tracker = newPoolTrackerFromOptions(opts)
+
 	p.setGauges()
 
+	registerPool(opts, p)
+
 	return p
 }
 
@@ -96,14 +157,61 @@ func (p *objectPool) Init(alloc Allocator) {
 	}
 
 	p.alloc = alloc
+	if p.tracker != nil {
+		p.alloc = func() interface{} {
+			v := alloc()
+			p.tracker.own(v)
+			return v
+		}
+	}
 
-	for i := 0; i < cap(p.values); i++ {
-		p.values <- p.alloc()
+	if p.budget != nil {
+		// Size the first object on init so that objects which cannot be
+		// sized are reported once on init rather than on their first put.
+		v := p.alloc()
+		if err := p.budget.sizer.check(v); err != nil {
+			fn := p.opts.OnPoolAccessErrorFn()
+			fn(err)
+		}
+		if !p.retain(v) && p.tracker != nil {
+			p.tracker.forget(v)
+		}
+	}
+
+	p.warmer.warm(p.size, func() bool {
+		// Stop once the pool is full at its current size so that warming
+		// does not undo an adaptive shrink that happened in the meantime.
+		if len(p.values) >= p.currentSize() {
+			return false
+		}
+		v := p.alloc()
+		if !p.retain(v) {
+			if p.tracker != nil {
+				p.tracker.forget(v)
+			}
+			return false
+		}
+		return true
+	})
+
+	if p.adaptive != nil {
+		p.adaptive.start()
 	}
 
 	p.setGauges()
 }
 
+func (p *objectPool) WaitReady(ctx context.Context) error {
+	return p.warmer.WaitReady(ctx)
+}
+
+func (p *objectPool) stopBackground() {
+	p.warmer.stop()
+	if p.adaptive != nil {
+		p.adaptive.stop()
+	}
+}
+
 func (p *objectPool) Get() interface{} {
 	if atomic.LoadInt32(&p.initialized) != 1 {
 		fn := p.opts.OnPoolAccessErrorFn()
@@ -111,17 +219,77 @@ func (p *objectPool) Get() interface{} {
 		return p.alloc()
 	}
 
-	var v interface{}
+	if p.limit != nil {
+		// Without a deadline or cancellation the wait cannot fail.
+		p.limit.acquire(context.Background(), nil)
+	}
+
+	return p.get()
+}
+
+func (p *objectPool) GetContext(ctx context.Context) (interface{}, error) {
+	if atomic.LoadInt32(&p.initialized) != 1 {
+		fn := p.opts.OnPoolAccessErrorFn()
+		fn(errPoolGetBeforeInitialized)
+		return nil, errPoolGetBeforeInitialized
+	}
+
+	if p.limit != nil {
+		if err := p.limit.acquire(ctx, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return p.get(), nil
+}
+
+func (p *objectPool) GetWithTimeout(timeout time.Duration) (interface{}, error) {
+	if atomic.LoadInt32(&p.initialized) != 1 {
+		fn := p.opts.OnPoolAccessErrorFn()
+		fn(errPoolGetBeforeInitialized)
+		return nil, errPoolGetBeforeInitialized
+	}
+
+	if p.limit != nil {
+		if err := p.limit.acquireWithTimeout(timeout); err != nil {
+			return nil, err
+		}
+	}
+
+	return p.get(), nil
+}
+
+func (p *objectPool) get() interface{} {
+	var (
+		v    interface{}
+		miss bool
+	)
 	select {
 	case v = <-p.values:
+		if p.budget != nil {
+			p.budget.release(v)
+		}
 	default:
 		v = p.alloc()
+		miss = true
 		p.metrics.getOnEmpty.Inc(1)
 	}
 
+	if p.adaptive != nil {
+		p.adaptive.recordGet(miss, len(p.values))
+	}
+
+	if p.tracker != nil {
+		p.tracker.checkout(v)
+	}
+
+	if p.limit != nil {
+		p.limit.hold(v)
+	}
+
 	p.trySetGauges()
 
-	if p.refillLowWatermark > 0 && len(p.values) <= p.refillLowWatermark {
+	if low := p.lowWatermark(); low > 0 && len(p.values) <= low {
 		p.tryFill()
 	}
 
@@ -135,15 +303,57 @@ func (p *objectPool) Put(obj interface{}) {
 		return
 	}
 
-	select {
-	case p.values <- obj:
-	default:
+	if p.tracker != nil {
+		if err := p.tracker.checkin(obj); err != nil {
+			fn := p.opts.OnPoolAccessErrorFn()
+			fn(err)
+			return
+		}
+	}
+
+	var overflow bool
+	if p.adaptive != nil && len(p.values) >= p.adaptive.currentSize() {
+		overflow = true
+	} else {
+		overflow = !p.retain(obj)
+	}
+
+	if overflow {
 		p.metrics.putOnFull.Inc(1)
+		if p.tracker != nil {
+			p.tracker.forget(obj)
+		}
+	}
+
+	if p.adaptive != nil {
+		p.adaptive.recordPut(overflow)
+	}
+
+	if p.limit != nil {
+		p.limit.release(obj)
 	}
 
 	p.trySetGauges()
 }
 
+// retain adds an object to the free objects if the pool is not full and
+// the memory budget, if any, is not exhausted.
+func (p *objectPool) retain(obj interface{}) bool {
+	if p.budget != nil && !p.budget.charge(obj) {
+		return false
+	}
+
+	select {
+	case p.values <- obj:
+		return true
+	default:
+		if p.budget != nil {
+			p.budget.release(obj)
+		}
+		return false
+	}
+}
+
 func (p *objectPool) trySetGauges() {
 	if time.Now().UnixNano()%sampleObjectPoolLengthEvery == 0 {
 		p.setGauges()
@@ -152,7 +362,65 @@ func (p *objectPool) trySetGauges() {
 
 func (p *objectPool) setGauges() {
 	p.metrics.free.Update(float64(len(p.values)))
-	p.metrics.total.Update(float64(p.size))
+	p.metrics.total.Update(float64(p.currentSize()))
+}
+
+func (p *objectPool) stats() PoolStats {
+	return PoolStats{
+		Type:       ChannelObjectPoolType.String(),
+		Size:       p.currentSize(),
+		Free:       len(p.values),
+		GetOnEmpty: p.metrics.getOnEmpty.Value(),
+		PutOnFull:  p.metrics.putOnFull.Value(),
+		BudgetUsed: p.budget.value(),
+	}
+}
+
+func (p *objectPool) numFree() int {
+	return len(p.values)
+}
+
+func (p *objectPool) currentSize() int {
+	if p.adaptive != nil {
+		return p.adaptive.currentSize()
+	}
+	return p.size
+}
+
+func (p *objectPool) lowWatermark() int {
+	if p.adaptive != nil {
+		return int(math.Ceil(
+			p.opts.RefillLowWatermark() * float64(p.adaptive.currentSize())))
+	}
+	return p.refillLowWatermark
+}
+
+func (p *objectPool) highWatermark() int {
+	if p.adaptive != nil {
+		return int(math.Ceil(
+			p.opts.RefillHighWatermark() * float64(p.adaptive.currentSize())))
+	}
+	return p.refillHighWatermark
+}
+
+func (p *objectPool) resize(size int) {
+	// Release objects above the new size, growing is left to gets on
+	// empty and refills since the retained objects are only a cache.
+	for len(p.values) > size {
+		select {
+		case v := <-p.values:
+			if p.budget != nil {
+				p.budget.release(v)
+			}
+			if p.tracker != nil {
+				p.tracker.forget(v)
+			}
+		default:
+			return
+		}
+	}
+
+	p.setGauges()
 }
 
 func (p *objectPool) tryFill() {
@@ -163,12 +431,131 @@ func (p *objectPool) tryFill() {
 	go func() {
 		defer atomic.StoreInt32(&p.filling, 0)
 
-		for len(p.values) < p.refillHighWatermark {
-			select {
-			case p.values <- p.alloc():
-			default:
+		for len(p.values) < p.highWatermark() {
+			v := p.alloc()
+			if !p.retain(v) {
+				if p.tracker != nil {
+					p.tracker.forget(v)
+				}
 				return
 			}
 		}
 	}()
 }
+
+// outstandingLimit bounds the number of objects held outside of a pool,
+// each outstanding object holds a slot in the channel and acquiring a slot
+// blocks once the limit is reached. The objects holding slots are recorded
+// so that puts of objects which did not acquire a slot from this pool, such
+// as objects of a bucket dropped by UpdateBuckets, do not release one.
+// Objects which are not references cannot be told apart and release any of
+// the slots held by such objects.
+type outstandingLimit struct {
+	sync.Mutex
+
+	slots     chan struct{}
+	held      map[trackedKey]int
+	heldOther int
+	waiters   int64
+	metrics   *objectPoolMetrics
+}
+
+func newOutstandingLimit(max int, metrics *objectPoolMetrics) *outstandingLimit {
+	if max <= 0 {
+		return nil
+	}
+	return &outstandingLimit{
+		slots:   make(chan struct{}, max),
+		held:    make(map[trackedKey]int),
+		metrics: metrics,
+	}
+}
+
+func (l *outstandingLimit) tryAcquire() bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *outstandingLimit) acquireWithTimeout(timeout time.Duration) error {
+	if l.tryAcquire() {
+		return nil
+	}
+
+	timer := time.NewTimer(timeout)
+	err := l.acquire(context.Background(), timer.C)
+	timer.Stop()
+
+	return err
+}
+
+func (l *outstandingLimit) acquire(ctx context.Context, timeout <-chan time.Time) error {
+	if l.tryAcquire() {
+		return nil
+	}
+
+	l.metrics.getOnLimit.Inc(1)
+	l.metrics.waiters.Update(float64(atomic.AddInt64(&l.waiters, 1)))
+
+	var (
+		start = time.Now()
+		err   error
+	)
+	select {
+	case l.slots <- struct{}{}:
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timeout:
+		err = ErrPoolGetTimeout
+	}
+
+	l.metrics.getWaitLatency.Record(time.Since(start))
+	l.metrics.waiters.Update(float64(atomic.AddInt64(&l.waiters, -1)))
+	if err != nil {
+		l.metrics.getTimeout.Inc(1)
+	}
+
+	return err
+}
+
+// hold records the object an acquired slot was used for.
+func (l *outstandingLimit) hold(obj interface{}) {
+	key, ok := newTrackedKey(obj)
+
+	l.Lock()
+	if ok {
+		l.held[key]++
+	} else {
+		l.heldOther++
+	}
+	l.Unlock()
+}
+
+// release releases the slot held by the object, if any.
+func (l *outstandingLimit) release(obj interface{}) {
+	key, ok := newTrackedKey(obj)
+
+	l.Lock()
+	held := false
+	switch {
+	case ok && l.held[key] > 0:
+		held = true
+		if l.held[key]--; l.held[key] == 0 {
+			delete(l.held, key)
+		}
+	case !ok && l.heldOther > 0:
+		held = true
+		l.heldOther--
+	}
+	l.Unlock()
+
+	if !held {
+		// Object did not acquire a slot from this pool, nothing to release.
+		return
+	}
+
+	<-l.slots
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	"testing"
+)
+
+func benchmarkObjectPoolGetPut(b *testing.B, opts ObjectPoolOptions) {
+	pool := NewObjectPool(opts.SetSize(1024))
+	pool.Init(func() interface{} {
+		return new([64]byte)
+	})
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			pool.Put(pool.Get())
+		}
+	})
+}
+
+func BenchmarkObjectPoolChannelGetPut(b *testing.B) {
+	benchmarkObjectPoolGetPut(b, NewObjectPoolOptions().
+		SetType(ChannelObjectPoolType))
+}
+
+func BenchmarkObjectPoolShardedGetPut(b *testing.B) {
+	benchmarkObjectPoolGetPut(b, NewObjectPoolOptions().
+		SetType(ShardedObjectPoolType))
+}
+
+func benchmarkObjectPoolGetBatchPutBatch(b *testing.B, opts ObjectPoolOptions) {
+	pool := NewObjectPool(opts.SetSize(1024))
+	pool.Init(func() interface{} {
+		return new([64]byte)
+	})
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		batch := make([]interface{}, 16)
+		for pb.Next() {
+			for i := range batch {
+				batch[i] = pool.Get()
+			}
+			for i := range batch {
+				pool.Put(batch[i])
+			}
+		}
+	})
+}
+
+func BenchmarkObjectPoolChannelGetBatchPutBatch(b *testing.B) {
+	benchmarkObjectPoolGetBatchPutBatch(b, NewObjectPoolOptions().
+		SetType(ChannelObjectPoolType))
+}
+
+func BenchmarkObjectPoolShardedGetBatchPutBatch(b *testing.B) {
+	benchmarkObjectPoolGetBatchPutBatch(b, NewObjectPoolOptions().
+		SetType(ShardedObjectPoolType))
+}
@@ -0,0 +1,386 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	"context"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Pad each shard to its own cache line so that shards locked by
+	// different cores do not contend on the same line.
+	shardCacheLinePad = 64
+)
+
+type shardedObjectPool struct {
+	opts                ObjectPoolOptions
+	shards              []objectPoolShard
+	alloc               Allocator
+	size                int
+	free                int64
+	refillLowWatermark  int
+	refillHighWatermark int
+	limit               *outstandingLimit
+	tracker             *poolTracker
+	warmer              *warmer
+	budget              *budgetAccount
+	hints               sync.Pool
+	nextHint            int64
+	filling             int32
+	initialized         int32
+	metrics             objectPoolMetrics
+}
+
+type objectPoolShard struct {
+	sync.Mutex
+	values   []interface{}
+	capacity int
+	_        [shardCacheLinePad]byte
+}
+
+func newShardedObjectPool(opts ObjectPoolOptions) (*shardedObjectPool, error) {
+	if opts.AdaptiveSizeOptions() != nil {
+		return nil, errAdaptiveChannelOnly
+	}
+
+	numShards := opts.Shards()
+	if numShards <= 0 {
+		numShards = runtime.GOMAXPROCS(0)
+	}
+
+	size := opts.Size()
+	m := opts.InstrumentOptions().MetricsScope()
+
+	p := &shardedObjectPool{
+		opts:   opts,
+		shards: make([]objectPoolShard, numShards),
+		size:   size,
+		refillLowWatermark: int(math.Ceil(
+			opts.RefillLowWatermark() * float64(size))),
+		refillHighWatermark: int(math.Ceil(
+			opts.RefillHighWatermark() * float64(size))),
+		metrics: newObjectPoolMetrics(m),
+	}
+
+	// Spread the capacity evenly with the remainder going to the first shards.
+	for i := range p.shards {
+		capacity := size / numShards
+		if i < size%numShards {
+			capacity++
+		}
+		p.shards[i].capacity = capacity
+		p.shards[i].values = make([]interface{}, 0, capacity)
+	}
+
+	p.hints.New = p.newShardHint
+	p.limit = newOutstandingLimit(opts.MaxOutstanding(), &p.metrics)
+	p.warmer = newWarmer(opts)
+	p.budget = newBudgetAccount(opts, m)
+
+	p.tracker = newPoolTrackerFromOptions(opts)
+
+	p.setGauges()
+
+	registerPool(opts, p)
+
+	return p, nil
+}
+
+func (p *shardedObjectPool) Init(alloc Allocator) {
+	if !atomic.CompareAndSwapInt32(&p.initialized, 0, 1) {
+		fn := p.opts.OnPoolAccessErrorFn()
+		fn(errPoolAlreadyInitialized)
+		return
+	}
+
+	p.alloc = alloc
+	if p.tracker != nil {
+		p.alloc = func() interface{} {
+			v := alloc()
+			p.tracker.own(v)
+			return v
+		}
+	}
+
+	if p.budget != nil {
+		// Size the first object on init so that objects which cannot be
+		// sized are reported once on init rather than on their first put.
+		v := p.alloc()
+		if err := p.budget.sizer.check(v); err != nil {
+			fn := p.opts.OnPoolAccessErrorFn()
+			fn(err)
+		}
+		if !p.give(0, v) && p.tracker != nil {
+			p.tracker.forget(v)
+		}
+	}
+
+	// Spread the objects across the shards as they are allocated so that
+	// the shards are evenly warm while warming in the background.
+	var shard int
+	p.warmer.warm(p.size, func() bool {
+		v := p.alloc()
+		shard = (shard + 1) % len(p.shards)
+		if !p.give(shard, v) {
+			if p.tracker != nil {
+				p.tracker.forget(v)
+			}
+			return false
+		}
+		return true
+	})
+
+	p.setGauges()
+}
+
+func (p *shardedObjectPool) WaitReady(ctx context.Context) error {
+	return p.warmer.WaitReady(ctx)
+}
+
+func (p *shardedObjectPool) stopBackground() {
+	p.warmer.stop()
+}
+
+func (p *shardedObjectPool) Get() interface{} {
+	if atomic.LoadInt32(&p.initialized) != 1 {
+		fn := p.opts.OnPoolAccessErrorFn()
+		fn(errPoolGetBeforeInitialized)
+		return p.alloc()
+	}
+
+	if p.limit != nil {
+		// Without a deadline or cancellation the wait cannot fail.
+		p.limit.acquire(context.Background(), nil)
+	}
+
+	return p.get()
+}
+
+func (p *shardedObjectPool) GetContext(ctx context.Context) (interface{}, error) {
+	if atomic.LoadInt32(&p.initialized) != 1 {
+		fn := p.opts.OnPoolAccessErrorFn()
+		fn(errPoolGetBeforeInitialized)
+		return nil, errPoolGetBeforeInitialized
+	}
+
+	if p.limit != nil {
+		if err := p.limit.acquire(ctx, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return p.get(), nil
+}
+
+func (p *shardedObjectPool) GetWithTimeout(timeout time.Duration) (interface{}, error) {
+	if atomic.LoadInt32(&p.initialized) != 1 {
+		fn := p.opts.OnPoolAccessErrorFn()
+		fn(errPoolGetBeforeInitialized)
+		return nil, errPoolGetBeforeInitialized
+	}
+
+	if p.limit != nil {
+		if err := p.limit.acquireWithTimeout(timeout); err != nil {
+			return nil, err
+		}
+	}
+
+	return p.get(), nil
+}
+
+func (p *shardedObjectPool) get() interface{} {
+	v, ok := p.take(p.shardHint())
+	if !ok {
+		v = p.alloc()
+		p.metrics.getOnEmpty.Inc(1)
+	}
+
+	if p.tracker != nil {
+		p.tracker.checkout(v)
+	}
+
+	if p.limit != nil {
+		p.limit.hold(v)
+	}
+
+	p.trySetGauges()
+
+	if p.refillLowWatermark > 0 && p.numFree() <= p.refillLowWatermark {
+		p.tryFill()
+	}
+
+	return v
+}
+
+func (p *shardedObjectPool) Put(obj interface{}) {
+	if atomic.LoadInt32(&p.initialized) != 1 {
+		fn := p.opts.OnPoolAccessErrorFn()
+		fn(errPoolPutBeforeInitialized)
+		return
+	}
+
+	if p.tracker != nil {
+		if err := p.tracker.checkin(obj); err != nil {
+			fn := p.opts.OnPoolAccessErrorFn()
+			fn(err)
+			return
+		}
+	}
+
+	if !p.give(p.shardHint(), obj) {
+		p.metrics.putOnFull.Inc(1)
+		if p.tracker != nil {
+			p.tracker.forget(obj)
+		}
+	}
+
+	if p.limit != nil {
+		p.limit.release(obj)
+	}
+
+	p.trySetGauges()
+}
+
+// shardHint returns the shard cached for the P the calling goroutine runs
+// on, hints are kept in a sync.Pool which caches them per P so goroutines on
+// the same P mostly use the same shard. The goroutine may be migrated and
+// hints may be dropped so the shard is only a hint and each shard is still
+// locked.
+func (p *shardedObjectPool) shardHint() int {
+	hint := p.hints.Get().(*int)
+	idx := *hint
+	p.hints.Put(hint)
+	return idx
+}
+
+// newShardHint assigns the shards to new hints in turn.
+func (p *shardedObjectPool) newShardHint() interface{} {
+	idx := int(atomic.AddInt64(&p.nextHint, 1)-1) % len(p.shards)
+	return &idx
+}
+
+// take pops an object from the local shard, stealing from the neighbouring
+// shards in order if the local shard is empty.
+func (p *shardedObjectPool) take(idx int) (interface{}, bool) {
+	if atomic.LoadInt64(&p.free) <= 0 {
+		return nil, false
+	}
+
+	for i := 0; i < len(p.shards); i++ {
+		s := &p.shards[(idx+i)%len(p.shards)]
+		s.Lock()
+		if n := len(s.values); n > 0 {
+			v := s.values[n-1]
+			s.values[n-1] = nil
+			s.values = s.values[:n-1]
+			s.Unlock()
+			atomic.AddInt64(&p.free, -1)
+			if p.budget != nil {
+				p.budget.release(v)
+			}
+			return v, true
+		}
+		s.Unlock()
+	}
+
+	return nil, false
+}
+
+// give pushes an object to the local shard, spilling over to the
+// neighbouring shards in order if the local shard is full.
+func (p *shardedObjectPool) give(idx int, obj interface{}) bool {
+	if p.numFree() >= p.size {
+		return false
+	}
+
+	if p.budget != nil && !p.budget.charge(obj) {
+		return false
+	}
+
+	for i := 0; i < len(p.shards); i++ {
+		s := &p.shards[(idx+i)%len(p.shards)]
+		s.Lock()
+		if len(s.values) < s.capacity {
+			s.values = append(s.values, obj)
+			s.Unlock()
+			atomic.AddInt64(&p.free, 1)
+			return true
+		}
+		s.Unlock()
+	}
+
+	if p.budget != nil {
+		p.budget.release(obj)
+	}
+
+	return false
+}
+
+func (p *shardedObjectPool) stats() PoolStats {
+	return PoolStats{
+		Type:       ShardedObjectPoolType.String(),
+		Size:       p.size,
+		Free:       p.numFree(),
+		GetOnEmpty: p.metrics.getOnEmpty.Value(),
+		PutOnFull:  p.metrics.putOnFull.Value(),
+		BudgetUsed: p.budget.value(),
+	}
+}
+
+func (p *shardedObjectPool) numFree() int {
+	return int(atomic.LoadInt64(&p.free))
+}
+
+func (p *shardedObjectPool) trySetGauges() {
+	if time.Now().UnixNano()%sampleObjectPoolLengthEvery == 0 {
+		p.setGauges()
+	}
+}
+
+func (p *shardedObjectPool) setGauges() {
+	p.metrics.free.Update(float64(p.numFree()))
+	p.metrics.total.Update(float64(p.size))
+}
+
+func (p *shardedObjectPool) tryFill() {
+	if !atomic.CompareAndSwapInt32(&p.filling, 0, 1) {
+		return
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&p.filling, 0)
+
+		for i := 0; p.numFree() < p.refillHighWatermark; i++ {
+			v := p.alloc()
+			if !p.give(i%len(p.shards), v) {
+				if p.tracker != nil {
+					p.tracker.forget(v)
+				}
+				return
+			}
+		}
+	}()
+}
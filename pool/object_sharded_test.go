@@ -0,0 +1,175 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardedObjectPoolGetPut(t *testing.T) {
+	opts := NewObjectPoolOptions().
+		SetType(ShardedObjectPoolType).
+		SetShards(4).
+		SetSize(10)
+
+	pool := NewObjectPool(opts).(*shardedObjectPool)
+	pool.Init(func() interface{} {
+		return new(int)
+	})
+
+	assert.Equal(t, 10, pool.numFree())
+
+	var capacity int
+	for i := range pool.shards {
+		capacity += pool.shards[i].capacity
+		assert.True(t, pool.shards[i].capacity >= 2)
+	}
+	assert.Equal(t, 10, capacity)
+
+	// Drain all shards to exercise stealing from neighbours.
+	values := make([]interface{}, 0, 10)
+	for i := 0; i < 10; i++ {
+		values = append(values, pool.Get())
+	}
+	assert.Equal(t, 0, pool.numFree())
+
+	for _, v := range values {
+		pool.Put(v)
+	}
+	assert.Equal(t, 10, pool.numFree())
+
+	// Pool is full, this should be dropped.
+	pool.Put(new(int))
+	assert.Equal(t, 10, pool.numFree())
+}
+
+func TestShardedObjectPoolShardHints(t *testing.T) {
+	opts := NewObjectPoolOptions().
+		SetType(ShardedObjectPoolType).
+		SetShards(4).
+		SetSize(8)
+
+	pool := NewObjectPool(opts).(*shardedObjectPool)
+	pool.Init(func() interface{} {
+		return new(int)
+	})
+
+	// New hints are assigned the shards in turn.
+	for i := 0; i < 8; i++ {
+		assert.Equal(t, i%4, *pool.newShardHint().(*int))
+	}
+
+	for i := 0; i < 10; i++ {
+		hint := pool.shardHint()
+		require.True(t, hint >= 0 && hint < 4)
+	}
+
+	v := pool.Get()
+	assert.Equal(t, 7, pool.numFree())
+	pool.Put(v)
+	assert.Equal(t, 8, pool.numFree())
+}
+
+func TestShardedObjectPoolRefillOnLowWaterMark(t *testing.T) {
+	opts := NewObjectPoolOptions().
+		SetType(ShardedObjectPoolType).
+		SetShards(4).
+		SetSize(100).
+		SetRefillLowWatermark(0.25).
+		SetRefillHighWatermark(0.75)
+
+	pool := NewObjectPool(opts).(*shardedObjectPool)
+	pool.Init(func() interface{} {
+		return 1
+	})
+
+	for i := 0; i < 74; i++ {
+		pool.Get()
+	}
+
+	// This should trigger a refill
+	pool.Get()
+
+	start := time.Now()
+	for time.Since(start) < 10*time.Second {
+		if pool.numFree() == 75 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Assert refilled
+	assert.Equal(t, 75, pool.numFree())
+}
+
+func TestShardedObjectPoolBoundedGetWithTimeout(t *testing.T) {
+	opts := NewObjectPoolOptions().
+		SetType(ShardedObjectPoolType).
+		SetSize(1).
+		SetMaxOutstanding(1)
+
+	pool := NewObjectPool(opts)
+	pool.Init(func() interface{} {
+		return 1
+	})
+
+	v, err := pool.GetWithTimeout(time.Millisecond)
+	require.NoError(t, err)
+
+	_, err = pool.GetWithTimeout(time.Millisecond)
+	assert.Equal(t, ErrPoolGetTimeout, err)
+
+	pool.Put(v)
+
+	_, err = pool.GetWithTimeout(time.Millisecond)
+	require.NoError(t, err)
+}
+
+func TestShardedObjectPoolConcurrentGetPut(t *testing.T) {
+	opts := NewObjectPoolOptions().
+		SetType(ShardedObjectPoolType).
+		SetShards(8).
+		SetSize(64)
+
+	pool := NewObjectPool(opts).(*shardedObjectPool)
+	pool.Init(func() interface{} {
+		return new(int)
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				pool.Put(pool.Get())
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 64, pool.numFree())
+}
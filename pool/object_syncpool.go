@@ -0,0 +1,153 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// syncObjectPool is an object pool backed by a sync.Pool, see
+// SyncObjectPoolType for the options and metrics it does not support.
+type syncObjectPool struct {
+	opts        ObjectPoolOptions
+	values      sync.Pool
+	alloc       Allocator
+	limit       *outstandingLimit
+	initialized int32
+	metrics     objectPoolMetrics
+}
+
+func newSyncObjectPool(opts ObjectPoolOptions) (*syncObjectPool, error) {
+	if opts.AdaptiveSizeOptions() != nil {
+		return nil, errAdaptiveChannelOnly
+	}
+
+	p := &syncObjectPool{
+		opts:    opts,
+		metrics: newObjectPoolMetrics(opts.InstrumentOptions().MetricsScope()),
+	}
+
+	p.limit = newOutstandingLimit(opts.MaxOutstanding(), &p.metrics)
+
+	registerPool(opts, p)
+
+	return p, nil
+}
+
+func (p *syncObjectPool) Init(alloc Allocator) {
+	if !atomic.CompareAndSwapInt32(&p.initialized, 0, 1) {
+		fn := p.opts.OnPoolAccessErrorFn()
+		fn(errPoolAlreadyInitialized)
+		return
+	}
+
+	p.alloc = alloc
+	p.values.New = func() interface{} {
+		p.metrics.getOnEmpty.Inc(1)
+		return alloc()
+	}
+}
+
+// WaitReady returns immediately since nothing is allocated on Init.
+func (p *syncObjectPool) WaitReady(ctx context.Context) error {
+	return nil
+}
+
+func (p *syncObjectPool) Get() interface{} {
+	if atomic.LoadInt32(&p.initialized) != 1 {
+		fn := p.opts.OnPoolAccessErrorFn()
+		fn(errPoolGetBeforeInitialized)
+		return p.alloc()
+	}
+
+	if p.limit != nil {
+		// Without a deadline or cancellation the wait cannot fail.
+		p.limit.acquire(context.Background(), nil)
+	}
+
+	return p.get()
+}
+
+func (p *syncObjectPool) GetContext(ctx context.Context) (interface{}, error) {
+	if atomic.LoadInt32(&p.initialized) != 1 {
+		fn := p.opts.OnPoolAccessErrorFn()
+		fn(errPoolGetBeforeInitialized)
+		return nil, errPoolGetBeforeInitialized
+	}
+
+	if p.limit != nil {
+		if err := p.limit.acquire(ctx, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return p.get(), nil
+}
+
+func (p *syncObjectPool) GetWithTimeout(timeout time.Duration) (interface{}, error) {
+	if atomic.LoadInt32(&p.initialized) != 1 {
+		fn := p.opts.OnPoolAccessErrorFn()
+		fn(errPoolGetBeforeInitialized)
+		return nil, errPoolGetBeforeInitialized
+	}
+
+	if p.limit != nil {
+		if err := p.limit.acquireWithTimeout(timeout); err != nil {
+			return nil, err
+		}
+	}
+
+	return p.get(), nil
+}
+
+func (p *syncObjectPool) get() interface{} {
+	v := p.values.Get()
+	if p.limit != nil {
+		p.limit.hold(v)
+	}
+	return v
+}
+
+func (p *syncObjectPool) Put(obj interface{}) {
+	if atomic.LoadInt32(&p.initialized) != 1 {
+		fn := p.opts.OnPoolAccessErrorFn()
+		fn(errPoolPutBeforeInitialized)
+		return
+	}
+
+	p.values.Put(obj)
+
+	if p.limit != nil {
+		p.limit.release(obj)
+	}
+}
+
+func (p *syncObjectPool) stats() PoolStats {
+	return PoolStats{
+		Type:       SyncObjectPoolType.String(),
+		Free:       unknownFree,
+		GetOnEmpty: p.metrics.getOnEmpty.Value(),
+		PutOnFull:  p.metrics.putOnFull.Value(),
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/m3db/m3x/instrument"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestSyncObjectPoolGetPut(t *testing.T) {
+	scope := tally.NewTestScope("", nil)
+	opts := NewObjectPoolOptions().
+		SetType(SyncObjectPoolType).
+		SetSize(2).
+		SetInstrumentOptions(instrument.NewOptions().SetMetricsScope(scope))
+
+	allocs := 0
+	pool := NewObjectPool(opts)
+	pool.Init(func() interface{} {
+		allocs++
+		return allocs
+	})
+
+	// Nothing is allocated up front since a GC would release it.
+	require.Equal(t, 0, allocs)
+
+	values := make(map[interface{}]struct{})
+	for i := 0; i < 3; i++ {
+		values[pool.Get()] = struct{}{}
+	}
+	require.Len(t, values, 3)
+
+	for v := range values {
+		pool.Put(v)
+	}
+
+	getOnEmpty := scope.Snapshot().Counters()["get-on-empty+"]
+	require.NotNil(t, getOnEmpty)
+	require.Equal(t, int64(3), getOnEmpty.Value())
+	require.Equal(t, int64(allocs), getOnEmpty.Value())
+}
+
+func TestSyncObjectPoolMaxOutstanding(t *testing.T) {
+	opts := NewObjectPoolOptions().
+		SetType(SyncObjectPoolType).
+		SetSize(1).
+		SetMaxOutstanding(1)
+
+	pool := NewObjectPool(opts)
+	pool.Init(func() interface{} { return new(int) })
+
+	v := pool.Get()
+
+	_, err := pool.GetWithTimeout(time.Millisecond)
+	require.Equal(t, ErrPoolGetTimeout, err)
+
+	pool.Put(v)
+
+	v, err = pool.GetWithTimeout(time.Millisecond)
+	require.NoError(t, err)
+	require.NotNil(t, v)
+}
+
+func TestSyncObjectPoolGetBeforeInit(t *testing.T) {
+	var accessErr error
+	opts := NewObjectPoolOptions().
+		SetType(SyncObjectPoolType).
+		SetOnPoolAccessErrorFn(func(err error) { accessErr = err })
+
+	pool := NewObjectPool(opts)
+
+	_, err := pool.GetWithTimeout(time.Millisecond)
+	require.Equal(t, errPoolGetBeforeInitialized, err)
+	require.Equal(t, errPoolGetBeforeInitialized, accessErr)
+
+	pool.Put(new(int))
+	require.Equal(t, errPoolPutBeforeInitialized, accessErr)
+}
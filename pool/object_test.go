@@ -21,11 +21,15 @@
 package pool
 
 import (
+	"context"
 	"testing"
 	"time"
 
+	"github.com/m3db/m3x/instrument"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
 )
 
 func TestObjectPoolRefillOnLowWaterMark(t *testing.T) {
@@ -116,3 +120,102 @@ func TestObjectPoolPutBeforeInitError(t *testing.T) {
 	assert.Error(t, accessErr)
 	assert.Equal(t, errPoolPutBeforeInitialized, accessErr)
 }
+
+func TestObjectPoolBoundedGetWithTimeout(t *testing.T) {
+	opts := NewObjectPoolOptions().
+		SetSize(1).
+		SetMaxOutstanding(2)
+
+	pool := NewObjectPool(opts)
+	pool.Init(func() interface{} {
+		return 1
+	})
+
+	for i := 0; i < 2; i++ {
+		v, err := pool.GetWithTimeout(time.Millisecond)
+		require.NoError(t, err)
+		require.Equal(t, 1, v)
+	}
+
+	_, err := pool.GetWithTimeout(time.Millisecond)
+	assert.Equal(t, ErrPoolGetTimeout, err)
+
+	pool.Put(1)
+
+	v, err := pool.GetWithTimeout(time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+}
+
+func TestObjectPoolBoundedGetContextWaitsForPut(t *testing.T) {
+	opts := NewObjectPoolOptions().
+		SetSize(1).
+		SetMaxOutstanding(1)
+
+	pool := NewObjectPool(opts)
+	pool.Init(func() interface{} {
+		return new(int)
+	})
+
+	held := pool.Get()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	_, err := pool.GetContext(ctx)
+	cancel()
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	result := make(chan interface{})
+	go func() {
+		v, err := pool.GetContext(context.Background())
+		assert.NoError(t, err)
+		result <- v
+	}()
+
+	pool.Put(held)
+	assert.True(t, held == <-result)
+}
+
+func TestObjectPoolBoundedPutOfForeignObject(t *testing.T) {
+	opts := NewObjectPoolOptions().
+		SetSize(1).
+		SetMaxOutstanding(1)
+
+	pool := NewObjectPool(opts)
+	pool.Init(func() interface{} {
+		return new(int)
+	})
+
+	held := pool.Get()
+
+	// Objects which did not acquire a slot do not release one.
+	pool.Put(new(int))
+	_, err := pool.GetWithTimeout(time.Millisecond)
+	assert.Equal(t, ErrPoolGetTimeout, err)
+
+	pool.Put(held)
+	_, err = pool.GetWithTimeout(time.Millisecond)
+	assert.NoError(t, err)
+}
+
+func TestObjectPoolBoundedMetrics(t *testing.T) {
+	scope := tally.NewTestScope("", nil)
+	opts := NewObjectPoolOptions().
+		SetSize(1).
+		SetMaxOutstanding(1).
+		SetInstrumentOptions(instrument.NewOptions().SetMetricsScope(scope))
+
+	pool := NewObjectPool(opts)
+	pool.Init(func() interface{} {
+		return 1
+	})
+
+	pool.Get()
+	_, err := pool.GetWithTimeout(time.Millisecond)
+	require.Error(t, err)
+
+	snapshot := scope.Snapshot()
+	assert.Equal(t, int64(1), snapshot.Counters()["get-on-limit+"].Value())
+	assert.Equal(t, int64(1), snapshot.Counters()["get-timeout+"].Value())
+	assert.Equal(t, 0.0, snapshot.Gauges()["waiters+"].Value())
+	assert.Equal(t, 1, len(snapshot.Timers()["get-wait-latency+"].Values()))
+}
@@ -20,33 +20,99 @@
 
 package pool
 
-import "github.com/m3db/m3x/instrument"
+import (
+	"time"
+
+	"github.com/m3db/m3x/clock"
+	"github.com/m3db/m3x/instrument"
+)
 
 const (
 	defaultSize                = 4096
+	defaultInitFraction        = 1.0
 	defaultRefillLowWatermark  = 0.0
 	defaultRefillHighWatermark = 0.0
+	defaultMaxOutstanding      = 0
+
+	defaultAdaptiveWindow        = time.Minute
+	defaultAdaptiveGrowThreshold = 0.05
+	defaultAdaptiveStepFactor    = 0.25
 )
 
 type objectPoolOptions struct {
+	name                string
+	replaceRegistered   bool
+	poolType            ObjectPoolType
+	shards              int
 	size                int
 	refillLowWatermark  float64
 	refillHighWatermark float64
+	maxOutstanding      int
+	adaptiveSizeOpts    AdaptiveSizeOptions
+	objectTracker       ObjectTracker
 	instrumentOpts      instrument.Options
 	onPoolAccessErrorFn OnPoolAccessErrorFn
+	initFraction        float64
+	memoryBudget        MemoryBudget
+	objectSizeFn        ObjectSizeFn
+	overflowCacheBytes  int64
+	capacityProfiler    CapacityProfiler
 }
 
 // NewObjectPoolOptions creates a new set of object pool options
 func NewObjectPoolOptions() ObjectPoolOptions {
 	return &objectPoolOptions{
+		poolType:            DefaultObjectPoolType,
 		size:                defaultSize,
 		refillLowWatermark:  defaultRefillLowWatermark,
 		refillHighWatermark: defaultRefillHighWatermark,
+		maxOutstanding:      defaultMaxOutstanding,
 		instrumentOpts:      instrument.NewOptions(),
 		onPoolAccessErrorFn: func(err error) { panic(err) },
+		initFraction:        defaultInitFraction,
 	}
 }
 
+func (o *objectPoolOptions) SetName(value string) ObjectPoolOptions {
+	opts := *o
+	opts.name = value
+	return &opts
+}
+
+func (o *objectPoolOptions) Name() string {
+	return o.name
+}
+
+func (o *objectPoolOptions) SetReplaceRegistered(value bool) ObjectPoolOptions {
+	opts := *o
+	opts.replaceRegistered = value
+	return &opts
+}
+
+func (o *objectPoolOptions) ReplaceRegistered() bool {
+	return o.replaceRegistered
+}
+
+func (o *objectPoolOptions) SetType(value ObjectPoolType) ObjectPoolOptions {
+	opts := *o
+	opts.poolType = value
+	return &opts
+}
+
+func (o *objectPoolOptions) Type() ObjectPoolType {
+	return o.poolType
+}
+
+func (o *objectPoolOptions) SetShards(value int) ObjectPoolOptions {
+	opts := *o
+	opts.shards = value
+	return &opts
+}
+
+func (o *objectPoolOptions) Shards() int {
+	return o.shards
+}
+
 func (o *objectPoolOptions) SetSize(value int) ObjectPoolOptions {
 	opts := *o
 	opts.size = value
@@ -77,6 +143,36 @@ func (o *objectPoolOptions) RefillHighWatermark() float64 {
 	return o.refillHighWatermark
 }
 
+func (o *objectPoolOptions) SetMaxOutstanding(value int) ObjectPoolOptions {
+	opts := *o
+	opts.maxOutstanding = value
+	return &opts
+}
+
+func (o *objectPoolOptions) MaxOutstanding() int {
+	return o.maxOutstanding
+}
+
+func (o *objectPoolOptions) SetAdaptiveSizeOptions(value AdaptiveSizeOptions) ObjectPoolOptions {
+	opts := *o
+	opts.adaptiveSizeOpts = value
+	return &opts
+}
+
+func (o *objectPoolOptions) AdaptiveSizeOptions() AdaptiveSizeOptions {
+	return o.adaptiveSizeOpts
+}
+
+func (o *objectPoolOptions) SetObjectTracker(value ObjectTracker) ObjectPoolOptions {
+	opts := *o
+	opts.objectTracker = value
+	return &opts
+}
+
+func (o *objectPoolOptions) ObjectTracker() ObjectTracker {
+	return o.objectTracker
+}
+
 func (o *objectPoolOptions) SetInstrumentOptions(value instrument.Options) ObjectPoolOptions {
 	opts := *o
 	opts.instrumentOpts = value
@@ -96,3 +192,132 @@ func (o *objectPoolOptions) SetOnPoolAccessErrorFn(value OnPoolAccessErrorFn) Ob
 func (o *objectPoolOptions) OnPoolAccessErrorFn() OnPoolAccessErrorFn {
 	return o.onPoolAccessErrorFn
 }
+
+func (o *objectPoolOptions) SetInitFraction(value float64) ObjectPoolOptions {
+	opts := *o
+	opts.initFraction = value
+	return &opts
+}
+
+func (o *objectPoolOptions) InitFraction() float64 {
+	return o.initFraction
+}
+
+func (o *objectPoolOptions) SetMemoryBudget(value MemoryBudget) ObjectPoolOptions {
+	opts := *o
+	opts.memoryBudget = value
+	return &opts
+}
+
+func (o *objectPoolOptions) MemoryBudget() MemoryBudget {
+	return o.memoryBudget
+}
+
+func (o *objectPoolOptions) SetObjectSizeFn(value ObjectSizeFn) ObjectPoolOptions {
+	opts := *o
+	opts.objectSizeFn = value
+	return &opts
+}
+
+func (o *objectPoolOptions) ObjectSizeFn() ObjectSizeFn {
+	return o.objectSizeFn
+}
+
+func (o *objectPoolOptions) SetOverflowCacheBytes(value int64) ObjectPoolOptions {
+	opts := *o
+	opts.overflowCacheBytes = value
+	return &opts
+}
+
+func (o *objectPoolOptions) OverflowCacheBytes() int64 {
+	return o.overflowCacheBytes
+}
+
+func (o *objectPoolOptions) SetCapacityProfiler(value CapacityProfiler) ObjectPoolOptions {
+	opts := *o
+	opts.capacityProfiler = value
+	return &opts
+}
+
+func (o *objectPoolOptions) CapacityProfiler() CapacityProfiler {
+	return o.capacityProfiler
+}
+
+type adaptiveSizeOptions struct {
+	minSize       int
+	maxSize       int
+	window        time.Duration
+	growThreshold float64
+	stepFactor    float64
+	nowFn         clock.NowFn
+}
+
+// NewAdaptiveSizeOptions creates a new set of adaptive size options
+func NewAdaptiveSizeOptions() AdaptiveSizeOptions {
+	return &adaptiveSizeOptions{
+		window:        defaultAdaptiveWindow,
+		growThreshold: defaultAdaptiveGrowThreshold,
+		stepFactor:    defaultAdaptiveStepFactor,
+		nowFn:         time.Now,
+	}
+}
+
+func (o *adaptiveSizeOptions) SetMinSize(value int) AdaptiveSizeOptions {
+	opts := *o
+	opts.minSize = value
+	return &opts
+}
+
+func (o *adaptiveSizeOptions) MinSize() int {
+	return o.minSize
+}
+
+func (o *adaptiveSizeOptions) SetMaxSize(value int) AdaptiveSizeOptions {
+	opts := *o
+	opts.maxSize = value
+	return &opts
+}
+
+func (o *adaptiveSizeOptions) MaxSize() int {
+	return o.maxSize
+}
+
+func (o *adaptiveSizeOptions) SetWindow(value time.Duration) AdaptiveSizeOptions {
+	opts := *o
+	opts.window = value
+	return &opts
+}
+
+func (o *adaptiveSizeOptions) Window() time.Duration {
+	return o.window
+}
+
+func (o *adaptiveSizeOptions) SetGrowThreshold(value float64) AdaptiveSizeOptions {
+	opts := *o
+	opts.growThreshold = value
+	return &opts
+}
+
+func (o *adaptiveSizeOptions) GrowThreshold() float64 {
+	return o.growThreshold
+}
+
+func (o *adaptiveSizeOptions) SetStepFactor(value float64) AdaptiveSizeOptions {
+	opts := *o
+	opts.stepFactor = value
+	return &opts
+}
+
+func (o *adaptiveSizeOptions) StepFactor() float64 {
+	return o.stepFactor
+}
+
+func (o *adaptiveSizeOptions) SetNowFn(value clock.NowFn) AdaptiveSizeOptions {
+	opts := *o
+	opts.nowFn = value
+	return &opts
+}
+
+func (o *adaptiveSizeOptions) NowFn() clock.NowFn {
+	return o.nowFn
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/uber-go/tally"
+)
+
+// overflowCacheMaxRatio bounds the capacity of a cached object relative to
+// the capacity requested so that small gets do not take much larger objects.
+const overflowCacheMaxRatio = 2
+
+// overflowCache retains objects larger than the largest bucket of a
+// bucketized pool up to a bound on their total size, the objects of the
+// largest capacity are evicted first, least recently put first among them.
+// Gets take the smallest object large enough and at most overflowCacheMaxRatio
+// times the capacity requested, the cache is expected to hold few objects so
+// it is simply scanned.
+type overflowCache struct {
+	sync.Mutex
+
+	maxBytes int64
+	bytes    int64
+	sizer    objectSizer
+	entries  *list.List
+	budget   *budgetAccount
+	metrics  overflowCacheMetrics
+}
+
+type overflowEntry struct {
+	obj      interface{}
+	capacity int
+	size     int64
+}
+
+type overflowCacheMetrics struct {
+	hits      tally.Counter
+	misses    tally.Counter
+	evictions tally.Counter
+	rejected  tally.Counter
+	bytes     tally.Gauge
+	objects   tally.Gauge
+}
+
+// newOverflowCache returns nil if the options do not enable the cache.
+func newOverflowCache(opts ObjectPoolOptions, scope tally.Scope) *overflowCache {
+	maxBytes := opts.OverflowCacheBytes()
+	if maxBytes <= 0 {
+		return nil
+	}
+
+	scope = scope.SubScope("overflow")
+	return &overflowCache{
+		maxBytes: maxBytes,
+		sizer:    newObjectSizer(opts),
+		entries:  list.New(),
+		budget:   newBudgetAccount(opts, scope),
+		metrics: overflowCacheMetrics{
+			hits:      scope.Counter("hits"),
+			misses:    scope.Counter("misses"),
+			evictions: scope.Counter("evictions"),
+			rejected:  scope.Counter("rejected"),
+			bytes:     scope.Gauge("bytes"),
+			objects:   scope.Gauge("objects"),
+		},
+	}
+}
+
+// get returns the smallest retained object of at least the given capacity,
+// or nil if there is none not too large for it.
+func (c *overflowCache) get(capacity int) interface{} {
+	c.Lock()
+
+	var best *list.Element
+	for e := c.entries.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(overflowEntry)
+		if entry.capacity < capacity || entry.capacity > overflowCacheMaxRatio*capacity {
+			continue
+		}
+		if best == nil || entry.capacity < best.Value.(overflowEntry).capacity {
+			best = e
+		}
+	}
+
+	if best == nil {
+		c.Unlock()
+		c.metrics.misses.Inc(1)
+		return nil
+	}
+
+	entry := c.removeWithLock(best)
+	c.updateMetricsWithLock()
+	c.Unlock()
+
+	c.metrics.hits.Inc(1)
+	return entry.obj
+}
+
+func (c *overflowCache) put(obj interface{}, capacity int) {
+	size, ok := c.sizer.size(obj)
+	if !ok || size > c.maxBytes {
+		c.metrics.rejected.Inc(1)
+		return
+	}
+
+	if c.budget != nil && !c.budget.charge(obj) {
+		c.metrics.rejected.Inc(1)
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	for c.bytes+size > c.maxBytes {
+		c.removeWithLock(c.evictionWithLock())
+		c.metrics.evictions.Inc(1)
+	}
+
+	c.entries.PushFront(overflowEntry{obj: obj, capacity: capacity, size: size})
+	c.bytes += size
+	c.updateMetricsWithLock()
+}
+
+// evictionWithLock returns the least recently put object of the largest
+// capacity, objects are put to the front so the back is scanned first.
+func (c *overflowCache) evictionWithLock() *list.Element {
+	var largest *list.Element
+	for e := c.entries.Back(); e != nil; e = e.Prev() {
+		if largest == nil || e.Value.(overflowEntry).capacity > largest.Value.(overflowEntry).capacity {
+			largest = e
+		}
+	}
+	return largest
+}
+
+func (c *overflowCache) removeWithLock(e *list.Element) overflowEntry {
+	entry := c.entries.Remove(e).(overflowEntry)
+	c.bytes -= entry.size
+	if c.budget != nil {
+		c.budget.release(entry.obj)
+	}
+	return entry
+}
+
+func (c *overflowCache) updateMetricsWithLock() {
+	c.metrics.bytes.Update(float64(c.bytes))
+	c.metrics.objects.Update(float64(c.entries.Len()))
+}
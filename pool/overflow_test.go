@@ -0,0 +1,169 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	"testing"
+
+	"github.com/m3db/m3x/instrument"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestBytesPoolOverflowCache(t *testing.T) {
+	scope := tally.NewTestScope("", nil)
+	pool := NewBytesPool([]Bucket{{Capacity: 64, Count: 1}}, NewObjectPoolOptions().
+		SetOverflowCacheBytes(1024).
+		SetInstrumentOptions(instrument.NewOptions().SetMetricsScope(scope)))
+	pool.Init()
+
+	large := pool.Get(300)
+	larger := pool.Get(500)
+	pool.Put(large)
+	pool.Put(larger)
+
+	// The smallest retained object large enough is reused.
+	b := pool.Get(200)
+	assert.Equal(t, 300, cap(b))
+	assert.True(t, &large[:1][0] == &b[:1][0])
+
+	b = pool.Get(400)
+	assert.True(t, &larger[:1][0] == &b[:1][0])
+
+	assert.Equal(t, 300, cap(pool.Get(300)))
+
+	counters := scope.Snapshot().Counters()
+	assert.Equal(t, int64(2), counters["overflow.hits+"].Value())
+	assert.Equal(t, int64(3), counters["overflow.misses+"].Value())
+	assert.Equal(t, int64(3), counters["alloc-max+"].Value())
+}
+
+func TestBytesPoolOverflowCacheEvictsLargest(t *testing.T) {
+	scope := tally.NewTestScope("", nil)
+	pool := NewBytesPool([]Bucket{{Capacity: 64, Count: 1}}, NewObjectPoolOptions().
+		SetOverflowCacheBytes(1000).
+		SetInstrumentOptions(instrument.NewOptions().SetMetricsScope(scope)))
+	pool.Init()
+
+	first := make([]byte, 0, 400)
+	pool.Put(first)
+	pool.Put(make([]byte, 0, 500))
+	pool.Put(make([]byte, 0, 400))
+	pool.Put(make([]byte, 0, 200))
+
+	// Objects larger than the whole cache are never retained.
+	pool.Put(make([]byte, 0, 2000))
+
+	snapshot := scope.Snapshot()
+	assert.Equal(t, int64(1), snapshot.Counters()["overflow.evictions+"].Value())
+	assert.Equal(t, int64(1), snapshot.Counters()["overflow.rejected+"].Value())
+	assert.Equal(t, 1000.0, snapshot.Gauges()["overflow.bytes+"].Value())
+	assert.Equal(t, 3.0, snapshot.Gauges()["overflow.objects+"].Value())
+
+	// Among objects of the same capacity the least recently put is evicted.
+	pool.Put(make([]byte, 0, 100))
+	b := pool.Get(400)
+	assert.Equal(t, 400, cap(b))
+	assert.False(t, &first[:1][0] == &b[:1][0])
+
+	assert.Equal(t, 200, cap(pool.Get(150)))
+	assert.Equal(t, 100, cap(pool.Get(100)))
+	assert.Equal(t, 0.0, scope.Snapshot().Gauges()["overflow.bytes+"].Value())
+}
+
+func TestBytesPoolOverflowCacheMaxRatio(t *testing.T) {
+	pool := NewBytesPool([]Bucket{{Capacity: 64, Count: 1}}, NewObjectPoolOptions().
+		SetOverflowCacheBytes(1024))
+	pool.Init()
+
+	large := make([]byte, 0, 500)
+	pool.Put(large)
+
+	// Too large for the capacity requested.
+	assert.Equal(t, 200, cap(pool.Get(200)))
+
+	b := pool.Get(250)
+	assert.True(t, &large[:1][0] == &b[:1][0])
+}
+
+func TestBytesPoolOverflowCacheDisabled(t *testing.T) {
+	pool := NewBytesPool([]Bucket{{Capacity: 64, Count: 1}}, nil)
+	pool.Init()
+
+	large := pool.Get(300)
+	pool.Put(large)
+	b := pool.Get(300)
+	assert.False(t, &large[:1][0] == &b[:1][0])
+}
+
+func TestOverflowCacheMemoryBudget(t *testing.T) {
+	budget := NewMemoryBudget(400, nil)
+	pool := NewBytesPool([]Bucket{{Capacity: 64, Count: 1}}, NewObjectPoolOptions().
+		SetOverflowCacheBytes(1000).
+		SetMemoryBudget(budget))
+	pool.Init()
+	require.Equal(t, int64(64), budget.Used())
+
+	pool.Put(make([]byte, 0, 300))
+	assert.Equal(t, int64(364), budget.Used())
+
+	pool.Put(make([]byte, 0, 300))
+	assert.Equal(t, int64(364), budget.Used())
+
+	pool.Get(300)
+	assert.Equal(t, int64(64), budget.Used())
+}
+
+func TestCheckedBytesPoolOverflowCache(t *testing.T) {
+	pool := NewCheckedBytesPool([]Bucket{{Capacity: 64, Count: 1}},
+		NewObjectPoolOptions().SetOverflowCacheBytes(1024),
+		func(s []Bucket) BytesPool {
+			return NewBytesPool(s, nil)
+		})
+	pool.Init()
+
+	large := pool.Get(300)
+	large.IncRef()
+	large.DecRef()
+	large.Finalize()
+
+	b := pool.Get(300)
+	assert.True(t, large == b)
+}
+
+func TestCheckedBytesPoolOverflowCacheSizedByCapacity(t *testing.T) {
+	pool := NewCheckedBytesPool([]Bucket{{Capacity: 64, Count: 1}},
+		NewObjectPoolOptions().SetOverflowCacheBytes(200),
+		func(s []Bucket) BytesPool {
+			return NewBytesPool(s, nil)
+		})
+	pool.Init()
+
+	large := pool.Get(300)
+	large.IncRef()
+	large.DecRef()
+	large.Finalize()
+
+	b := pool.Get(300)
+	assert.False(t, large == b)
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// capacityBins is the number of power of two capacity bins, one for every
+// bit length of a capacity.
+const capacityBins = 65
+
+// CapacityProfile is a snapshot of the usage recorded by a capacity profiler.
+type CapacityProfile struct {
+	// Gets is the number of gets recorded.
+	Gets int64 `json:"gets"`
+
+	// InUse is the number of objects currently checked out.
+	InUse int64 `json:"inUse"`
+
+	// PeakInUse is the highest number of objects checked out at once.
+	PeakInUse int64 `json:"peakInUse"`
+
+	// Bins are the requested capacities rounded up to a power of two in
+	// ascending order, capacities never requested are omitted.
+	Bins []CapacityBin `json:"bins"`
+}
+
+// CapacityBin is the number of gets for capacities up to a power of two.
+type CapacityBin struct {
+	Capacity int   `json:"capacity"`
+	Gets     int64 `json:"gets"`
+}
+
+type capacityProfiler struct {
+	gets  [capacityBins]int64
+	inUse int64
+	peak  int64
+}
+
+// NewCapacityProfiler creates a new capacity profiler, it can be shared by
+// bucketized pools to profile their combined usage.
+func NewCapacityProfiler() CapacityProfiler {
+	return &capacityProfiler{}
+}
+
+func (p *capacityProfiler) recordGet(capacity int) {
+	if capacity < 1 {
+		capacity = 1
+	}
+	atomic.AddInt64(&p.gets[bitLen(uint64(capacity-1))], 1)
+
+	inUse := atomic.AddInt64(&p.inUse, 1)
+	for {
+		peak := atomic.LoadInt64(&p.peak)
+		if inUse <= peak || atomic.CompareAndSwapInt64(&p.peak, peak, inUse) {
+			return
+		}
+	}
+}
+
+// bitLen returns the number of bits required to represent x, the result is
+// 0 for x == 0.
+func bitLen(x uint64) int {
+	n := 0
+	for ; x >= 1<<8; x >>= 8 {
+		n += 8
+	}
+	return n + int(bitLenTable[x])
+}
+
+// bitLenTable is the bit length of every byte.
+var bitLenTable = func() (table [256]uint8) {
+	for i := 1; i < len(table); i++ {
+		table[i] = table[i/2] + 1
+	}
+	return table
+}()
+
+func (p *capacityProfiler) recordPut() {
+	// Objects not taken from the pool may be put to it too, in which case
+	// the count is not decremented below zero.
+	for {
+		inUse := atomic.LoadInt64(&p.inUse)
+		if inUse <= 0 || atomic.CompareAndSwapInt64(&p.inUse, inUse, inUse-1) {
+			return
+		}
+	}
+}
+
+func (p *capacityProfiler) Profile() CapacityProfile {
+	profile := CapacityProfile{
+		InUse:     atomic.LoadInt64(&p.inUse),
+		PeakInUse: atomic.LoadInt64(&p.peak),
+	}
+	for i := range p.gets {
+		gets := atomic.LoadInt64(&p.gets[i])
+		if gets == 0 {
+			continue
+		}
+		profile.Gets += gets
+		profile.Bins = append(profile.Bins, CapacityBin{
+			Capacity: 1 << uint(i),
+			Gets:     gets,
+		})
+	}
+	return profile
+}
+
+// Recommend sizes a bucket for every bin with the share of the peak usage
+// matching the share of gets of the bin, so the pool would have been large
+// enough at the peak had the capacities been requested in proportion.
+func (p *capacityProfiler) Recommend() BucketizedPoolConfiguration {
+	var (
+		profile = p.Profile()
+		cfg     BucketizedPoolConfiguration
+	)
+	for _, bin := range profile.Bins {
+		share := float64(bin.Gets) / float64(profile.Gets)
+		count := int(math.Ceil(share * float64(profile.PeakInUse)))
+		if count < 1 {
+			count = 1
+		}
+		cfg.Buckets = append(cfg.Buckets, BucketConfiguration{
+			Capacity: bin.Capacity,
+			Count:    count,
+		})
+	}
+	return cfg
+}
+
+func (p *capacityProfiler) Reset() {
+	for i := range p.gets {
+		atomic.StoreInt64(&p.gets[i], 0)
+	}
+	atomic.StoreInt64(&p.inUse, 0)
+	atomic.StoreInt64(&p.peak, 0)
+}
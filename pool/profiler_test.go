@@ -0,0 +1,146 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestCapacityProfilerProfile(t *testing.T) {
+	profiler := NewCapacityProfiler()
+	pool := NewBucketizedObjectPool([]Bucket{
+		{Capacity: 64, Count: 2},
+		{Capacity: 256, Count: 2},
+	}, NewObjectPoolOptions().SetCapacityProfiler(profiler))
+	pool.Init(func(capacity int) interface{} {
+		return make([]byte, 0, capacity)
+	})
+
+	var held [][]byte
+	for _, capacity := range []int{10, 64, 65, 200, 1000} {
+		held = append(held, pool.Get(capacity).([]byte))
+	}
+	for _, b := range held[:3] {
+		pool.Put(b, cap(b))
+	}
+	pool.Get(50)
+
+	assert.Equal(t, CapacityProfile{
+		Gets:      6,
+		InUse:     3,
+		PeakInUse: 5,
+		Bins: []CapacityBin{
+			{Capacity: 16, Gets: 1},
+			{Capacity: 64, Gets: 2},
+			{Capacity: 128, Gets: 1},
+			{Capacity: 256, Gets: 1},
+			{Capacity: 1024, Gets: 1},
+		},
+	}, profiler.Profile())
+
+	profiler.Reset()
+	assert.Equal(t, CapacityProfile{}, profiler.Profile())
+
+	// Puts of objects not taken from the pool never drive usage negative.
+	pool.Put(make([]byte, 0, 64), 64)
+	assert.Equal(t, int64(0), profiler.Profile().InUse)
+}
+
+func TestCapacityProfilerRecommend(t *testing.T) {
+	profiler := NewCapacityProfiler().(*capacityProfiler)
+	for i := 0; i < 6; i++ {
+		profiler.recordGet(100)
+	}
+	for i := 0; i < 2; i++ {
+		profiler.recordGet(4000)
+	}
+	profiler.recordGet(1)
+
+	assert.Equal(t, []BucketConfiguration{
+		{Capacity: 1, Count: 1},
+		{Capacity: 128, Count: 6},
+		{Capacity: 4096, Count: 2},
+	}, profiler.Recommend().Buckets)
+
+	var cfg BucketizedPoolConfiguration
+	data, err := yaml.Marshal(profiler.Recommend())
+	require.NoError(t, err)
+	require.NoError(t, yaml.Unmarshal(data, &cfg))
+	assert.Equal(t, profiler.Recommend(), cfg)
+}
+
+func TestCapacityProfilerRecommendHandler(t *testing.T) {
+	const name = "test-profiler-recommend"
+	defer UnregisterPool(name)
+
+	profiler := NewCapacityProfiler()
+	pool := NewBucketizedObjectPool([]Bucket{
+		{Capacity: 64, Count: 2},
+	}, NewObjectPoolOptions().SetName(name).SetCapacityProfiler(profiler))
+	pool.Init(func(capacity int) interface{} {
+		return make([]byte, 0, capacity)
+	})
+	pool.Get(64)
+	pool.Get(64)
+
+	mux := http.NewServeMux()
+	RegisterHandler(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", registryRecommendPath+"?name="+name, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var cfg BucketizedPoolConfiguration
+	require.NoError(t, yaml.Unmarshal(w.Body.Bytes(), &cfg))
+	assert.Equal(t, []BucketConfiguration{{Capacity: 64, Count: 2}}, cfg.Buckets)
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", registryRecommendPath+"?name=unknown", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestCapacityProfilerNotProfiled(t *testing.T) {
+	const name = "test-profiler-not-profiled"
+	defer UnregisterPool(name)
+
+	NewBucketizedObjectPool(nil, NewObjectPoolOptions().SetName(name))
+
+	_, err := RecommendedConfiguration(name)
+	assert.Error(t, err)
+}
+
+func TestBitLen(t *testing.T) {
+	for _, tt := range []struct {
+		x   uint64
+		len int
+	}{
+		{0, 0}, {1, 1}, {2, 2}, {3, 2}, {255, 8}, {256, 9},
+		{1<<32 - 1, 32}, {1 << 32, 33}, {1<<64 - 1, 64},
+	} {
+		assert.Equal(t, tt.len, bitLen(tt.x), "x=%d", tt.x)
+	}
+}
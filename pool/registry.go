@@ -0,0 +1,270 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/uber-go/tally"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	registryPath          = "/debug/pools"
+	registryRecommendPath = registryPath + "/recommend"
+
+	// unknownFree is the free count reported by pools which cannot tell how
+	// many objects they hold.
+	unknownFree = -1
+)
+
+// PoolStats is a snapshot of the state of a registered pool.
+type PoolStats struct {
+	// Name is the name the pool is registered under.
+	Name string `json:"name"`
+
+	// Type is the type of the pool, an object pool type for object pools,
+	// bucketized for bucketized pools or native for native heaps.
+	Type string `json:"type"`
+
+	// Size is the number of objects the pool holds when full.
+	Size int `json:"size"`
+
+	// Free is the number of objects in the pool, or -1 if unknown.
+	Free int `json:"free"`
+
+	// GetOnEmpty is the number of gets which allocated an object since the
+	// pool was empty.
+	GetOnEmpty int64 `json:"getOnEmpty"`
+
+	// PutOnFull is the number of puts which dropped an object since the
+	// pool was full.
+	PutOnFull int64 `json:"putOnFull"`
+
+	// BudgetUsed is the number of bytes retained by the pool charged against
+	// its memory budget, if any.
+	BudgetUsed int64 `json:"budgetUsed,omitempty"`
+
+	// Buckets is the bucket layout of bucketized pools and native heaps.
+	Buckets []BucketStats `json:"buckets,omitempty"`
+}
+
+// BucketStats is a snapshot of the state of a bucket of a registered pool.
+type BucketStats struct {
+	Capacity   int   `json:"capacity"`
+	Size       int   `json:"size"`
+	Free       int   `json:"free"`
+	GetOnEmpty int64 `json:"getOnEmpty"`
+	PutOnFull  int64 `json:"putOnFull"`
+	BudgetUsed int64 `json:"budgetUsed,omitempty"`
+}
+
+// statsReporter is implemented by pools which can join the registry.
+type statsReporter interface {
+	stats() PoolStats
+}
+
+// capacityProfiled is implemented by registered pools which may be profiled,
+// the profiler is nil unless profiling is enabled.
+type capacityProfiled interface {
+	capacityProfiler() CapacityProfiler
+}
+
+var registry = struct {
+	sync.RWMutex
+	pools map[string]*registration
+}{pools: make(map[string]*registration)}
+
+// registration is a pool registered in the registry.
+type registration struct {
+	name string
+	pool statsReporter
+}
+
+// registerPool registers a pool under the name set in its options, pools
+// without a name are not registered and a nil registration is returned. A
+// name already in use is suffixed with the lowest free number, e.g. name-2,
+// so that pools never replace each other unless the options opt in to
+// replacing the pool registered under the name. The registry keeps
+// registered pools reachable so pools are registered until unregistered,
+// replaced or closed.
+func registerPool(opts ObjectPoolOptions, pool statsReporter) *registration {
+	name := opts.Name()
+	if name == "" {
+		return nil
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	r := &registration{name: name, pool: pool}
+	if opts.ReplaceRegistered() {
+		registry.pools[name] = r
+		return r
+	}
+
+	for n := 2; registry.pools[r.name] != nil; n++ {
+		r.name = fmt.Sprintf("%s-%d", name, n)
+	}
+	if r.name != name {
+		opts.InstrumentOptions().Logger().Warnf(
+			"pool name %s already registered, registering as %s", name, r.name)
+	}
+	registry.pools[r.name] = r
+	return r
+}
+
+// unregister removes the pool from the registry unless it has already been
+// removed, a nil registration is ignored.
+func (r *registration) unregister() {
+	if r == nil {
+		return
+	}
+
+	registry.Lock()
+	if registry.pools[r.name] == r {
+		delete(registry.pools, r.name)
+	}
+	registry.Unlock()
+}
+
+// UnregisterPool removes the pool registered under a name from the registry,
+// pools without a Close method stay registered until removed this way or
+// replaced by a pool which replaces registered pools.
+func UnregisterPool(name string) {
+	registry.Lock()
+	delete(registry.pools, name)
+	registry.Unlock()
+}
+
+// RegisteredPools returns the stats of all registered pools sorted by name.
+func RegisteredPools() []PoolStats {
+	registry.RLock()
+	result := make([]PoolStats, 0, len(registry.pools))
+	for name, r := range registry.pools {
+		stats := r.pool.stats()
+		stats.Name = name
+		result = append(result, stats)
+	}
+	registry.RUnlock()
+
+	sort.Sort(poolStatsByName(result))
+	return result
+}
+
+// poolStatsByName sorts pool stats by name.
+type poolStatsByName []PoolStats
+
+func (x poolStatsByName) Len() int {
+	return len(x)
+}
+
+func (x poolStatsByName) Swap(i, j int) {
+	x[i], x[j] = x[j], x[i]
+}
+
+func (x poolStatsByName) Less(i, j int) bool {
+	return x[i].Name < x[j].Name
+}
+
+// RegisterHandler registers the pool registry handlers with the given http
+// mux, one returns the stats of all registered pools as JSON and the other
+// returns the bucketized pool configuration recommended by the capacity
+// profiler of the pool named by the name query parameter as YAML.
+func RegisterHandler(mux *http.ServeMux) {
+	mux.Handle(registryPath, registryHandler())
+	mux.Handle(registryRecommendPath, recommendHandler())
+}
+
+func registryHandler() http.Handler {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(RegisteredPools()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+	return http.HandlerFunc(h)
+}
+
+// RecommendedConfiguration returns the bucketized pool configuration
+// recommended by the capacity profiler of the pool registered under a name.
+func RecommendedConfiguration(name string) (BucketizedPoolConfiguration, error) {
+	registry.RLock()
+	r, ok := registry.pools[name]
+	registry.RUnlock()
+
+	if !ok {
+		return BucketizedPoolConfiguration{}, fmt.Errorf("no pool registered as '%s'", name)
+	}
+
+	var profiler CapacityProfiler
+	if profiled, ok := r.pool.(capacityProfiled); ok {
+		profiler = profiled.capacityProfiler()
+	}
+	if profiler == nil {
+		return BucketizedPoolConfiguration{}, fmt.Errorf("pool '%s' is not profiled", name)
+	}
+	return profiler.Recommend(), nil
+}
+
+func recommendHandler() http.Handler {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		cfg, err := RecommendedConfiguration(r.URL.Query().Get("name"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		data, err := yaml.Marshal(cfg)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-yaml")
+		w.Write(data)
+	}
+	return http.HandlerFunc(h)
+}
+
+// statCounter is a counter which also keeps its value so that it can be
+// reported by the registry.
+type statCounter struct {
+	tally.Counter
+
+	value int64
+}
+
+func newStatCounter(counter tally.Counter) *statCounter {
+	return &statCounter{Counter: counter}
+}
+
+func (c *statCounter) Inc(delta int64) {
+	atomic.AddInt64(&c.value, delta)
+	c.Counter.Inc(delta)
+}
+
+func (c *statCounter) Value() int64 {
+	return atomic.LoadInt64(&c.value)
+}
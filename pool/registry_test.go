@@ -0,0 +1,236 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/m3db/m3x/checked"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func findPoolStats(t *testing.T, stats []PoolStats, name string) PoolStats {
+	for _, s := range stats {
+		if s.Name == name {
+			return s
+		}
+	}
+	require.FailNow(t, "pool not registered", name)
+	return PoolStats{}
+}
+
+func TestRegistryObjectPools(t *testing.T) {
+	types := []ObjectPoolType{
+		ChannelObjectPoolType,
+		ShardedObjectPoolType,
+		SyncObjectPoolType,
+	}
+
+	for _, typ := range types {
+		name := "test-registry-" + typ.String()
+		defer UnregisterPool(name)
+
+		pool := NewObjectPool(NewObjectPoolOptions().
+			SetName(name).
+			SetType(typ).
+			SetSize(2))
+		pool.Init(func() interface{} { return new(int) })
+
+		values := []interface{}{pool.Get(), pool.Get(), pool.Get()}
+
+		stats := findPoolStats(t, RegisteredPools(), name)
+		assert.Equal(t, typ.String(), stats.Type)
+		assert.True(t, stats.GetOnEmpty >= 1)
+		if typ == SyncObjectPoolType {
+			assert.Equal(t, 0, stats.Size)
+			assert.Equal(t, unknownFree, stats.Free)
+			continue
+		}
+		assert.Equal(t, 2, stats.Size)
+		assert.Equal(t, int64(1), stats.GetOnEmpty)
+		assert.Equal(t, 0, stats.Free)
+
+		for _, v := range values {
+			pool.Put(v)
+		}
+
+		stats = findPoolStats(t, RegisteredPools(), name)
+		assert.Equal(t, 2, stats.Free)
+		assert.Equal(t, int64(1), stats.PutOnFull)
+	}
+}
+
+func TestRegistryBucketizedPools(t *testing.T) {
+	defer UnregisterPool("test-registry-bytes")
+	defer UnregisterPool("test-registry-heap")
+
+	buckets := []Bucket{{Capacity: 8, Count: 2}, {Capacity: 16, Count: 1}}
+	opts := NewObjectPoolOptions()
+
+	bytesPool := NewBytesPool(buckets, opts.SetName("test-registry-bytes"))
+	bytesPool.Init()
+	bytesPool.Get(10)
+	bytesPool.Get(10)
+
+	heap := NewNativeHeap(buckets, opts.SetName("test-registry-heap"))
+	heap.Init()
+	heap.Get(10)
+	heap.Get(10)
+	heap.Get(100)
+
+	pools := RegisteredPools()
+
+	stats := findPoolStats(t, pools, "test-registry-bytes")
+	assert.Equal(t, "bucketized", stats.Type)
+	assert.Equal(t, 3, stats.Size)
+	assert.Equal(t, 2, stats.Free)
+	assert.Equal(t, int64(1), stats.GetOnEmpty)
+	assert.Equal(t, []BucketStats{
+		{Capacity: 8, Size: 2, Free: 2},
+		{Capacity: 16, Size: 1, Free: 0, GetOnEmpty: 1},
+	}, stats.Buckets)
+
+	stats = findPoolStats(t, pools, "test-registry-heap")
+	assert.Equal(t, "native", stats.Type)
+	assert.Equal(t, 4, stats.Size)
+	assert.Equal(t, 2, stats.Free)
+	// One get grew the 16 byte bucket and one was too large for any bucket.
+	assert.Equal(t, int64(2), stats.GetOnEmpty)
+	assert.Equal(t, []BucketStats{
+		{Capacity: 8, Size: 2, Free: 2},
+		{Capacity: 16, Size: 2, Free: 0, GetOnEmpty: 1},
+	}, stats.Buckets)
+}
+
+func TestRegistryHandler(t *testing.T) {
+	defer UnregisterPool("test-registry-handler")
+
+	pool := NewObjectPool(NewObjectPoolOptions().
+		SetName("test-registry-handler").
+		SetSize(3))
+	pool.Init(func() interface{} { return new(int) })
+
+	mux := http.NewServeMux()
+	RegisterHandler(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", registryPath, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var pools []PoolStats
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &pools))
+
+	stats := findPoolStats(t, pools, "test-registry-handler")
+	assert.Equal(t, PoolStats{
+		Name: "test-registry-handler",
+		Type: "channel",
+		Size: 3,
+		Free: 3,
+	}, stats)
+
+	UnregisterPool("test-registry-handler")
+	for _, s := range RegisteredPools() {
+		require.NotEqual(t, "test-registry-handler", s.Name)
+	}
+}
+
+func TestRegistryCheckedObjectPool(t *testing.T) {
+	defer UnregisterPool("test-registry-checked")
+
+	p := NewCheckedObjectPool(NewObjectPoolOptions().
+		SetName("test-registry-checked").
+		SetSize(2))
+	p.Init(func() checked.ReadWriteRef {
+		return &checked.RefCount{}
+	})
+
+	p.Get()
+
+	stats := findPoolStats(t, RegisteredPools(), "test-registry-checked")
+	assert.Equal(t, 2, stats.Size)
+	assert.Equal(t, 1, stats.Free)
+
+	// The pool of finalizers is not registered.
+	for _, s := range RegisteredPools() {
+		require.NotEqual(t, "test-registry-checked-2", s.Name)
+	}
+}
+
+func TestRegistryDuplicateNames(t *testing.T) {
+	defer UnregisterPool("test-registry-dup")
+	defer UnregisterPool("test-registry-dup-2")
+
+	opts := NewObjectPoolOptions().SetName("test-registry-dup")
+	first := NewObjectPool(opts.SetSize(1))
+	first.Init(func() interface{} { return new(int) })
+	second := NewObjectPool(opts.SetSize(2))
+	second.Init(func() interface{} { return new(int) })
+
+	// The second pool does not replace the first.
+	pools := RegisteredPools()
+	assert.Equal(t, 1, findPoolStats(t, pools, "test-registry-dup").Size)
+	assert.Equal(t, 2, findPoolStats(t, pools, "test-registry-dup-2").Size)
+
+	// A freed name is reused.
+	UnregisterPool("test-registry-dup")
+	third := NewObjectPool(opts.SetSize(3))
+	third.Init(func() interface{} { return new(int) })
+	assert.Equal(t, 3, findPoolStats(t, RegisteredPools(), "test-registry-dup").Size)
+}
+
+func TestRegistryReplaceRegistered(t *testing.T) {
+	defer UnregisterPool("test-registry-replace")
+
+	opts := NewObjectPoolOptions().
+		SetName("test-registry-replace").
+		SetReplaceRegistered(true)
+	first := NewObjectPool(opts.SetSize(1))
+	first.Init(func() interface{} { return new(int) })
+	second := NewObjectPool(opts.SetSize(2))
+	second.Init(func() interface{} { return new(int) })
+
+	// The second pool replaces the first under the same name.
+	pools := RegisteredPools()
+	assert.Equal(t, 2, findPoolStats(t, pools, "test-registry-replace").Size)
+	for _, s := range pools {
+		require.NotEqual(t, "test-registry-replace-2", s.Name)
+	}
+}
+
+func TestRegistryHeapCloseUnregisters(t *testing.T) {
+	defer UnregisterPool("test-registry-closed")
+
+	heap := NewNativeHeapWithOptions([]Bucket{{Capacity: 8, Count: 1}},
+		NewObjectPoolOptions().SetName("test-registry-closed"), NativeHeapOptions{})
+	heap.Init()
+	findPoolStats(t, RegisteredPools(), "test-registry-closed")
+
+	require.NoError(t, heap.Close())
+	for _, s := range RegisteredPools() {
+		require.NotEqual(t, "test-registry-closed", s.Name)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	"context"
+
+	"github.com/m3db/m3x/checked"
+)
+
+//go:generate go run gen_slices.go
+
+// slicesPool is the bucketized pool shared by the typed slice pools in
+// slices_gen.go, the typed pools only add the typed allocation and accessors.
+type slicesPool struct {
+	pool BucketizedObjectPool
+}
+
+func (p *slicesPool) WaitReady(ctx context.Context) error {
+	return p.pool.WaitReady(ctx)
+}
+
+// checkedSlice is the part of a checked slice needed to return it to a pool.
+type checkedSlice interface {
+	checked.ReadWriteRef
+
+	Cap() int
+	Resize(size int)
+}
+
+// checkedSliceClearer is implemented by the checked slices whose values hold
+// references and need to be cleared before being pooled.
+type checkedSliceClearer interface {
+	Clear()
+}
+
+func (p *slicesPool) initChecked(newFn func(capacity int) checkedSlice) {
+	p.pool.Init(func(capacity int) interface{} {
+		values := newFn(capacity)
+		values.SetFinalizer(checked.FinalizerFn(func() {
+			p.finalizeChecked(values)
+		}))
+		return values
+	})
+}
+
+func (p *slicesPool) finalizeChecked(values checkedSlice) {
+	values.IncRef()
+	if clearer, ok := values.(checkedSliceClearer); ok {
+		// Clear through the write path so that the clear is checked as well.
+		clearer.Clear()
+	} else {
+		values.Resize(0)
+	}
+	capacity := values.Cap()
+	values.DecRef()
+	p.pool.Put(values, capacity)
+}
@@ -0,0 +1,505 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Code generated by gen_slices.go. DO NOT EDIT.
+
+package pool
+
+import (
+	"time"
+	"unsafe"
+
+	"github.com/m3db/m3x/checked"
+)
+
+type int64sPool struct {
+	slicesPool
+}
+
+// NewInt64sPool creates a new int64 slices pool
+func NewInt64sPool(sizes []Bucket, opts ObjectPoolOptions) Int64sPool {
+	return &int64sPool{slicesPool{pool: NewBucketizedObjectPool(sizes, opts)}}
+}
+
+func (p *int64sPool) Init() {
+	p.pool.Init(func(capacity int) interface{} {
+		return make([]int64, 0, capacity)
+	})
+}
+
+func (p *int64sPool) Get(capacity int) []int64 {
+	return p.pool.Get(capacity).([]int64)
+}
+
+func (p *int64sPool) Put(value []int64) {
+	value = value[:0]
+	p.pool.Put(value, cap(value))
+}
+
+// AppendInt64 appends a value to a int64 slice getting a new slice from
+// the Int64sPool if the slice is at capacity
+func AppendInt64(values []int64, value int64, pool Int64sPool) []int64 {
+	if len(values) == cap(values) {
+		newValues := pool.Get(cap(values) * 2)
+		n := copy(newValues[:len(values)], values)
+		pool.Put(values)
+		values = newValues[:n]
+	}
+
+	return append(values, value)
+}
+
+type checkedInt64sPool struct {
+	slicesPool
+}
+
+// NewCheckedInt64sPool creates a new checked int64 slices pool
+func NewCheckedInt64sPool(sizes []Bucket, opts ObjectPoolOptions) CheckedInt64sPool {
+	opts = withCheckedCapObjectSize(opts, int64(unsafe.Sizeof(int64(0))))
+	return &checkedInt64sPool{slicesPool{pool: NewBucketizedObjectPool(sizes, opts)}}
+}
+
+func (p *checkedInt64sPool) Init() {
+	p.initChecked(func(capacity int) checkedSlice {
+		return checked.NewInt64s(make([]int64, 0, capacity))
+	})
+}
+
+func (p *checkedInt64sPool) Get(capacity int) checked.Int64s {
+	return p.pool.Get(capacity).(checked.Int64s)
+}
+
+// AppendInt64Checked appends a value to a checked int64 slice getting a
+// new slice from the CheckedInt64sPool if the slice is at capacity, the
+// original slice is not finalized when swapped
+func AppendInt64Checked(
+	values checked.Int64s,
+	value int64,
+	pool CheckedInt64sPool,
+) (
+	result checked.Int64s,
+	swapped bool,
+) {
+	orig := values
+
+	if values.Len() == values.Cap() {
+		newValues := pool.Get(values.Cap() * 2)
+
+		// Inc the ref to write to it
+		newValues.IncRef()
+		newValues.AppendAll(values.Get())
+
+		values = newValues
+	}
+
+	values.Append(value)
+
+	result = values
+	swapped = orig != values
+
+	if swapped {
+		// No longer holding reference from the inc
+		result.DecRef()
+	}
+
+	return
+}
+
+type uint64sPool struct {
+	slicesPool
+}
+
+// NewUint64sPool creates a new uint64 slices pool
+func NewUint64sPool(sizes []Bucket, opts ObjectPoolOptions) Uint64sPool {
+	return &uint64sPool{slicesPool{pool: NewBucketizedObjectPool(sizes, opts)}}
+}
+
+func (p *uint64sPool) Init() {
+	p.pool.Init(func(capacity int) interface{} {
+		return make([]uint64, 0, capacity)
+	})
+}
+
+func (p *uint64sPool) Get(capacity int) []uint64 {
+	return p.pool.Get(capacity).([]uint64)
+}
+
+func (p *uint64sPool) Put(value []uint64) {
+	value = value[:0]
+	p.pool.Put(value, cap(value))
+}
+
+// AppendUint64 appends a value to a uint64 slice getting a new slice from
+// the Uint64sPool if the slice is at capacity
+func AppendUint64(values []uint64, value uint64, pool Uint64sPool) []uint64 {
+	if len(values) == cap(values) {
+		newValues := pool.Get(cap(values) * 2)
+		n := copy(newValues[:len(values)], values)
+		pool.Put(values)
+		values = newValues[:n]
+	}
+
+	return append(values, value)
+}
+
+type checkedUint64sPool struct {
+	slicesPool
+}
+
+// NewCheckedUint64sPool creates a new checked uint64 slices pool
+func NewCheckedUint64sPool(sizes []Bucket, opts ObjectPoolOptions) CheckedUint64sPool {
+	opts = withCheckedCapObjectSize(opts, int64(unsafe.Sizeof(uint64(0))))
+	return &checkedUint64sPool{slicesPool{pool: NewBucketizedObjectPool(sizes, opts)}}
+}
+
+func (p *checkedUint64sPool) Init() {
+	p.initChecked(func(capacity int) checkedSlice {
+		return checked.NewUint64s(make([]uint64, 0, capacity))
+	})
+}
+
+func (p *checkedUint64sPool) Get(capacity int) checked.Uint64s {
+	return p.pool.Get(capacity).(checked.Uint64s)
+}
+
+// AppendUint64Checked appends a value to a checked uint64 slice getting a
+// new slice from the CheckedUint64sPool if the slice is at capacity, the
+// original slice is not finalized when swapped
+func AppendUint64Checked(
+	values checked.Uint64s,
+	value uint64,
+	pool CheckedUint64sPool,
+) (
+	result checked.Uint64s,
+	swapped bool,
+) {
+	orig := values
+
+	if values.Len() == values.Cap() {
+		newValues := pool.Get(values.Cap() * 2)
+
+		// Inc the ref to write to it
+		newValues.IncRef()
+		newValues.AppendAll(values.Get())
+
+		values = newValues
+	}
+
+	values.Append(value)
+
+	result = values
+	swapped = orig != values
+
+	if swapped {
+		// No longer holding reference from the inc
+		result.DecRef()
+	}
+
+	return
+}
+
+type intsPool struct {
+	slicesPool
+}
+
+// NewIntsPool creates a new int slices pool
+func NewIntsPool(sizes []Bucket, opts ObjectPoolOptions) IntsPool {
+	return &intsPool{slicesPool{pool: NewBucketizedObjectPool(sizes, opts)}}
+}
+
+func (p *intsPool) Init() {
+	p.pool.Init(func(capacity int) interface{} {
+		return make([]int, 0, capacity)
+	})
+}
+
+func (p *intsPool) Get(capacity int) []int {
+	return p.pool.Get(capacity).([]int)
+}
+
+func (p *intsPool) Put(value []int) {
+	value = value[:0]
+	p.pool.Put(value, cap(value))
+}
+
+// AppendInt appends a value to a int slice getting a new slice from
+// the IntsPool if the slice is at capacity
+func AppendInt(values []int, value int, pool IntsPool) []int {
+	if len(values) == cap(values) {
+		newValues := pool.Get(cap(values) * 2)
+		n := copy(newValues[:len(values)], values)
+		pool.Put(values)
+		values = newValues[:n]
+	}
+
+	return append(values, value)
+}
+
+type checkedIntsPool struct {
+	slicesPool
+}
+
+// NewCheckedIntsPool creates a new checked int slices pool
+func NewCheckedIntsPool(sizes []Bucket, opts ObjectPoolOptions) CheckedIntsPool {
+	opts = withCheckedCapObjectSize(opts, int64(unsafe.Sizeof(int(0))))
+	return &checkedIntsPool{slicesPool{pool: NewBucketizedObjectPool(sizes, opts)}}
+}
+
+func (p *checkedIntsPool) Init() {
+	p.initChecked(func(capacity int) checkedSlice {
+		return checked.NewInts(make([]int, 0, capacity))
+	})
+}
+
+func (p *checkedIntsPool) Get(capacity int) checked.Ints {
+	return p.pool.Get(capacity).(checked.Ints)
+}
+
+// AppendIntChecked appends a value to a checked int slice getting a
+// new slice from the CheckedIntsPool if the slice is at capacity, the
+// original slice is not finalized when swapped
+func AppendIntChecked(
+	values checked.Ints,
+	value int,
+	pool CheckedIntsPool,
+) (
+	result checked.Ints,
+	swapped bool,
+) {
+	orig := values
+
+	if values.Len() == values.Cap() {
+		newValues := pool.Get(values.Cap() * 2)
+
+		// Inc the ref to write to it
+		newValues.IncRef()
+		newValues.AppendAll(values.Get())
+
+		values = newValues
+	}
+
+	values.Append(value)
+
+	result = values
+	swapped = orig != values
+
+	if swapped {
+		// No longer holding reference from the inc
+		result.DecRef()
+	}
+
+	return
+}
+
+type stringsPool struct {
+	slicesPool
+}
+
+// NewStringsPool creates a new string slices pool
+func NewStringsPool(sizes []Bucket, opts ObjectPoolOptions) StringsPool {
+	return &stringsPool{slicesPool{pool: NewBucketizedObjectPool(sizes, opts)}}
+}
+
+func (p *stringsPool) Init() {
+	p.pool.Init(func(capacity int) interface{} {
+		return make([]string, 0, capacity)
+	})
+}
+
+func (p *stringsPool) Get(capacity int) []string {
+	return p.pool.Get(capacity).([]string)
+}
+
+func (p *stringsPool) Put(value []string) {
+	// Clear the values so that pooled slices do not retain references.
+	value = value[:cap(value)]
+	for i := range value {
+		value[i] = ""
+	}
+	value = value[:0]
+	p.pool.Put(value, cap(value))
+}
+
+// AppendString appends a value to a string slice getting a new slice from
+// the StringsPool if the slice is at capacity
+func AppendString(values []string, value string, pool StringsPool) []string {
+	if len(values) == cap(values) {
+		newValues := pool.Get(cap(values) * 2)
+		n := copy(newValues[:len(values)], values)
+		pool.Put(values)
+		values = newValues[:n]
+	}
+
+	return append(values, value)
+}
+
+type checkedStringsPool struct {
+	slicesPool
+}
+
+// NewCheckedStringsPool creates a new checked string slices pool
+func NewCheckedStringsPool(sizes []Bucket, opts ObjectPoolOptions) CheckedStringsPool {
+	opts = withCheckedCapObjectSize(opts, int64(unsafe.Sizeof("")))
+	return &checkedStringsPool{slicesPool{pool: NewBucketizedObjectPool(sizes, opts)}}
+}
+
+func (p *checkedStringsPool) Init() {
+	p.initChecked(func(capacity int) checkedSlice {
+		return checked.NewStrings(make([]string, 0, capacity))
+	})
+}
+
+func (p *checkedStringsPool) Get(capacity int) checked.Strings {
+	return p.pool.Get(capacity).(checked.Strings)
+}
+
+// AppendStringChecked appends a value to a checked string slice getting a
+// new slice from the CheckedStringsPool if the slice is at capacity, the
+// original slice is not finalized when swapped
+func AppendStringChecked(
+	values checked.Strings,
+	value string,
+	pool CheckedStringsPool,
+) (
+	result checked.Strings,
+	swapped bool,
+) {
+	orig := values
+
+	if values.Len() == values.Cap() {
+		newValues := pool.Get(values.Cap() * 2)
+
+		// Inc the ref to write to it
+		newValues.IncRef()
+		newValues.AppendAll(values.Get())
+
+		values = newValues
+	}
+
+	values.Append(value)
+
+	result = values
+	swapped = orig != values
+
+	if swapped {
+		// No longer holding reference from the inc
+		result.DecRef()
+	}
+
+	return
+}
+
+type timesPool struct {
+	slicesPool
+}
+
+// NewTimesPool creates a new time.Time slices pool
+func NewTimesPool(sizes []Bucket, opts ObjectPoolOptions) TimesPool {
+	return &timesPool{slicesPool{pool: NewBucketizedObjectPool(sizes, opts)}}
+}
+
+func (p *timesPool) Init() {
+	p.pool.Init(func(capacity int) interface{} {
+		return make([]time.Time, 0, capacity)
+	})
+}
+
+func (p *timesPool) Get(capacity int) []time.Time {
+	return p.pool.Get(capacity).([]time.Time)
+}
+
+func (p *timesPool) Put(value []time.Time) {
+	// Clear the values so that pooled slices do not retain references.
+	value = value[:cap(value)]
+	for i := range value {
+		value[i] = time.Time{}
+	}
+	value = value[:0]
+	p.pool.Put(value, cap(value))
+}
+
+// AppendTime appends a value to a time.Time slice getting a new slice from
+// the TimesPool if the slice is at capacity
+func AppendTime(values []time.Time, value time.Time, pool TimesPool) []time.Time {
+	if len(values) == cap(values) {
+		newValues := pool.Get(cap(values) * 2)
+		n := copy(newValues[:len(values)], values)
+		pool.Put(values)
+		values = newValues[:n]
+	}
+
+	return append(values, value)
+}
+
+type checkedTimesPool struct {
+	slicesPool
+}
+
+// NewCheckedTimesPool creates a new checked time.Time slices pool
+func NewCheckedTimesPool(sizes []Bucket, opts ObjectPoolOptions) CheckedTimesPool {
+	opts = withCheckedCapObjectSize(opts, int64(unsafe.Sizeof(time.Time{})))
+	return &checkedTimesPool{slicesPool{pool: NewBucketizedObjectPool(sizes, opts)}}
+}
+
+func (p *checkedTimesPool) Init() {
+	p.initChecked(func(capacity int) checkedSlice {
+		return checked.NewTimes(make([]time.Time, 0, capacity))
+	})
+}
+
+func (p *checkedTimesPool) Get(capacity int) checked.Times {
+	return p.pool.Get(capacity).(checked.Times)
+}
+
+// AppendTimeChecked appends a value to a checked time.Time slice getting a
+// new slice from the CheckedTimesPool if the slice is at capacity, the
+// original slice is not finalized when swapped
+func AppendTimeChecked(
+	values checked.Times,
+	value time.Time,
+	pool CheckedTimesPool,
+) (
+	result checked.Times,
+	swapped bool,
+) {
+	orig := values
+
+	if values.Len() == values.Cap() {
+		newValues := pool.Get(values.Cap() * 2)
+
+		// Inc the ref to write to it
+		newValues.IncRef()
+		newValues.AppendAll(values.Get())
+
+		values = newValues
+	}
+
+	values.Append(value)
+
+	result = values
+	swapped = orig != values
+
+	if swapped {
+		// No longer holding reference from the inc
+		result.DecRef()
+	}
+
+	return
+}
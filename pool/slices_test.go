@@ -0,0 +1,224 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/m3db/m3x/instrument"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func testSliceBuckets() []Bucket {
+	return []Bucket{
+		{Count: 1, Capacity: 2},
+		{Count: 1, Capacity: 4},
+		{Count: 1, Capacity: 8},
+	}
+}
+
+func TestInt64sPool(t *testing.T) {
+	p := NewInt64sPool(testSliceBuckets(), nil)
+	p.Init()
+
+	v1 := p.Get(1)
+	assert.Equal(t, 0, len(v1))
+	assert.Equal(t, 2, cap(v1))
+	v1 = append(v1, 42)
+	p.Put(v1)
+
+	v2 := p.Get(2)
+	assert.Equal(t, 0, len(v2))
+	assert.Equal(t, v1, v2[:1])
+}
+
+func TestAppendSlices(t *testing.T) {
+	int64s := NewInt64sPool(testSliceBuckets(), nil)
+	int64s.Init()
+	uint64s := NewUint64sPool(testSliceBuckets(), nil)
+	uint64s.Init()
+	ints := NewIntsPool(testSliceBuckets(), nil)
+	ints.Init()
+	strs := NewStringsPool(testSliceBuckets(), nil)
+	strs.Init()
+	times := NewTimesPool(testSliceBuckets(), nil)
+	times.Init()
+
+	var (
+		i64s  = int64s.Get(2)
+		u64s  = uint64s.Get(2)
+		is    = ints.Get(2)
+		ss    = strs.Get(2)
+		ts    = times.Get(2)
+		start = time.Unix(0, 0)
+	)
+
+	for i := 0; i < 5; i++ {
+		i64s = AppendInt64(i64s, int64(i), int64s)
+		u64s = AppendUint64(u64s, uint64(i), uint64s)
+		is = AppendInt(is, i, ints)
+		ss = AppendString(ss, string(rune('a'+i)), strs)
+		ts = AppendTime(ts, start.Add(time.Duration(i)), times)
+	}
+
+	assert.Equal(t, []int64{0, 1, 2, 3, 4}, i64s)
+	assert.Equal(t, []uint64{0, 1, 2, 3, 4}, u64s)
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, is)
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, ss)
+	assert.Equal(t, 5, len(ts))
+	assert.Equal(t, start.Add(4), ts[4])
+
+	// Grown twice from the smallest bucket.
+	assert.Equal(t, 8, cap(i64s))
+	assert.Equal(t, 8, cap(ts))
+}
+
+func TestAppendSlicesChecked(t *testing.T) {
+	int64s := NewCheckedInt64sPool(testSliceBuckets(), nil)
+	int64s.Init()
+	strs := NewCheckedStringsPool(testSliceBuckets(), nil)
+	strs.Init()
+
+	i64s := int64s.Get(2)
+	i64s.IncRef()
+	ss := strs.Get(2)
+	ss.IncRef()
+
+	var swaps int
+	for i := 0; i < 5; i++ {
+		if v, swapped := AppendInt64Checked(i64s, int64(i), int64s); swapped {
+			i64s.DecRef()
+			i64s.Finalize()
+			i64s = v
+			i64s.IncRef()
+			swaps++
+		}
+		if v, swapped := AppendStringChecked(ss, string(rune('a'+i)), strs); swapped {
+			ss.DecRef()
+			ss.Finalize()
+			ss = v
+			ss.IncRef()
+		}
+	}
+
+	// Grown twice from the smallest bucket.
+	assert.Equal(t, 2, swaps)
+	assert.Equal(t, 8, i64s.Cap())
+	assert.Equal(t, []int64{0, 1, 2, 3, 4}, i64s.Get())
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, ss.Get())
+}
+
+func TestCheckedStringsPoolFinalizeClearsWithRef(t *testing.T) {
+	p := NewCheckedStringsPool([]Bucket{{Count: 1, Capacity: 2}}, nil)
+	p.Init()
+
+	v := p.Get(2)
+	v.IncRef()
+	v.Append("a")
+	v.DecRef()
+	v.Finalize()
+
+	v = p.Get(2)
+	v.IncRef()
+	assert.Equal(t, "", v.Get()[:1][0])
+	v.DecRef()
+}
+
+func TestStringsPoolPutClears(t *testing.T) {
+	p := NewStringsPool([]Bucket{{Count: 1, Capacity: 2}}, nil)
+	p.Init()
+
+	v := p.Get(2)
+	v = append(v, "a", "b")
+	p.Put(v[:1])
+
+	v = p.Get(2)
+	assert.Equal(t, []string{"", ""}, v[:2])
+}
+
+func TestCheckedInt64sPool(t *testing.T) {
+	p := NewCheckedInt64sPool(testSliceBuckets(), nil)
+	p.Init()
+
+	v := p.Get(3)
+	v.IncRef()
+	assert.Equal(t, 4, v.Cap())
+	v.AppendAll([]int64{1, 2, 3})
+	assert.Equal(t, []int64{1, 2, 3}, v.Get())
+	v.DecRef()
+	v.Finalize()
+
+	// Returned to the pool with its length reset.
+	v2 := p.Get(3)
+	assert.True(t, v == v2)
+	v2.IncRef()
+	assert.Equal(t, 0, v2.Len())
+	v2.DecRef()
+}
+
+func TestCheckedTimesPoolFinalizeClears(t *testing.T) {
+	p := NewCheckedTimesPool([]Bucket{{Count: 1, Capacity: 2}}, nil)
+	p.Init()
+
+	v := p.Get(2)
+	v.IncRef()
+	v.Append(time.Now())
+	v.DecRef()
+	v.Finalize()
+
+	v = p.Get(2)
+	v.IncRef()
+	assert.Equal(t, time.Time{}, v.Get()[:1][0])
+	v.DecRef()
+}
+
+func TestBucketizedPoolConfigurationSlicePools(t *testing.T) {
+	scope := tally.NewTestScope("", nil)
+	iopts := instrument.NewOptions().SetMetricsScope(scope)
+	cfg := BucketizedPoolConfiguration{
+		Buckets: []BucketConfiguration{{Count: 1, Capacity: 4}},
+	}
+
+	opts, err := cfg.NewSlicesPoolOptions(iopts)
+	require.NoError(t, err)
+	int64s := NewInt64sPool(cfg.NewBuckets(), opts)
+	int64s.Init()
+
+	// Allocates since the single pooled slice is taken.
+	int64s.Get(4)
+	int64s.Get(4)
+
+	counter, ok := scope.Snapshot().Counters()["get-on-empty+bucket-capacity=4,pool-type=channel"]
+	require.True(t, ok)
+	require.Equal(t, int64(1), counter.Value())
+
+	checkedStrings := NewCheckedStringsPool(cfg.NewBuckets(), opts)
+	checkedStrings.Init()
+	require.NotNil(t, checkedStrings.Get(4))
+
+	cfg.Type = NativePoolType
+	_, err = cfg.NewSlicesPoolOptions(iopts)
+	require.Equal(t, errNativePoolTypeBytesOnly, err)
+}
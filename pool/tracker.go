@@ -0,0 +1,299 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	trackerStackMaxDepth = 32
+)
+
+// OutstandingObjects describes objects held outside of their pools that
+// were acquired from the same call site.
+type OutstandingObjects struct {
+	// CallSite is the stack that acquired the objects.
+	CallSite string
+
+	// Count is the number of objects held.
+	Count int
+
+	// OldestSince is when the longest held object was acquired.
+	OldestSince time.Time
+}
+
+// ObjectTracker tracks objects acquired from pools to find misuse such as
+// double puts, puts of objects from a different pool and objects that are
+// never put back. Tracking is expensive and meant for debugging only.
+type ObjectTracker interface {
+	// Outstanding returns objects held outside of their pools for at least
+	// the given duration grouped by call site, most objects first.
+	Outstanding(minAge time.Duration) []OutstandingObjects
+}
+
+type objectTracker struct {
+	sync.Mutex
+
+	nextOwner int64
+	objects   map[trackedKey]*trackedObject
+	nowFn     func() time.Time
+}
+
+// trackedKey identifies an object by its type and the address of the
+// memory it references, values that are not references cannot be tracked.
+// Slices are identified by the end of their backing array which is the
+// same for slices of the array such as b[1:] or b[:n].
+type trackedKey struct {
+	typ reflect.Type
+	ptr uintptr
+}
+
+// trackedObject holds no reference to the object, objects held by a pool
+// are kept alive by the pool which forgets them when it drops them.
+type trackedObject struct {
+	owner       int64
+	outstanding bool
+	since       time.Time
+	// Acquisition stack when outstanding, otherwise the last put stack.
+	stack []uintptr
+}
+
+// NewObjectTracker creates a new object tracker.
+func NewObjectTracker() ObjectTracker {
+	return newObjectTracker()
+}
+
+func newObjectTracker() *objectTracker {
+	return &objectTracker{
+		objects: make(map[trackedKey]*trackedObject),
+		nowFn:   time.Now,
+	}
+}
+
+func (t *objectTracker) newPoolTracker() *poolTracker {
+	return &poolTracker{
+		tracker: t,
+		owner:   atomic.AddInt64(&t.nextOwner, 1),
+	}
+}
+
+func (t *objectTracker) Outstanding(minAge time.Duration) []OutstandingObjects {
+	now := t.nowFn()
+
+	t.Lock()
+	byStack := make(map[string]*OutstandingObjects)
+	for _, obj := range t.objects {
+		if !obj.outstanding || now.Sub(obj.since) < minAge {
+			continue
+		}
+		stack := formatTrackerStack(obj.stack)
+		entry, ok := byStack[stack]
+		if !ok {
+			entry = &OutstandingObjects{CallSite: stack, OldestSince: obj.since}
+			byStack[stack] = entry
+		}
+		entry.Count++
+		if obj.since.Before(entry.OldestSince) {
+			entry.OldestSince = obj.since
+		}
+	}
+	t.Unlock()
+
+	result := make([]OutstandingObjects, 0, len(byStack))
+	for _, entry := range byStack {
+		result = append(result, *entry)
+	}
+	sort.Sort(outstandingByCount(result))
+
+	return result
+}
+
+// outstandingByCount sorts outstanding objects by count descending then by
+// the oldest acquisition.
+type outstandingByCount []OutstandingObjects
+
+func (x outstandingByCount) Len() int {
+	return len(x)
+}
+
+func (x outstandingByCount) Swap(i, j int) {
+	x[i], x[j] = x[j], x[i]
+}
+
+func (x outstandingByCount) Less(i, j int) bool {
+	if x[i].Count != x[j].Count {
+		return x[i].Count > x[j].Count
+	}
+	return x[i].OldestSince.Before(x[j].OldestSince)
+}
+
+// poolTracker tracks the objects of a single pool in a shared tracker, it
+// is itself an ObjectTracker so that pools made of several pools, such as
+// the buckets of a bucketized pool, can share it and own objects together.
+type poolTracker struct {
+	tracker *objectTracker
+	owner   int64
+}
+
+// newPoolTrackerFromOptions returns the pool tracker for a new pool, or nil
+// if objects are not tracked.
+func newPoolTrackerFromOptions(opts ObjectPoolOptions) *poolTracker {
+	switch tracker := opts.ObjectTracker().(type) {
+	case *objectTracker:
+		return tracker.newPoolTracker()
+	case *poolTracker:
+		return tracker
+	}
+	return nil
+}
+
+func (p *poolTracker) Outstanding(minAge time.Duration) []OutstandingObjects {
+	return p.tracker.Outstanding(minAge)
+}
+
+// own records that an object was allocated by the pool.
+func (p *poolTracker) own(v interface{}) {
+	key, ok := newTrackedKey(v)
+	if !ok {
+		return
+	}
+
+	p.tracker.Lock()
+	p.tracker.objects[key] = &trackedObject{owner: p.owner}
+	p.tracker.Unlock()
+}
+
+// checkout records that an object was acquired from the pool.
+func (p *poolTracker) checkout(v interface{}) {
+	key, ok := newTrackedKey(v)
+	if !ok {
+		return
+	}
+
+	stack := trackerStack()
+	now := p.tracker.nowFn()
+
+	p.tracker.Lock()
+	obj, ok := p.tracker.objects[key]
+	if !ok {
+		obj = &trackedObject{owner: p.owner}
+		p.tracker.objects[key] = obj
+	}
+	obj.outstanding = true
+	obj.since = now
+	obj.stack = stack
+	p.tracker.Unlock()
+}
+
+// checkin records that an object was returned to the pool, returning an
+// error if it was not outstanding from this pool.
+func (p *poolTracker) checkin(v interface{}) error {
+	key, ok := newTrackedKey(v)
+	if !ok {
+		return nil
+	}
+
+	stack := trackerStack()
+
+	p.tracker.Lock()
+	defer p.tracker.Unlock()
+
+	obj, ok := p.tracker.objects[key]
+	if !ok || obj.owner != p.owner {
+		return fmt.Errorf("%v: type=%T", errPoolPutForeignObject, v)
+	}
+	if !obj.outstanding {
+		return fmt.Errorf("%v: type=%T, previously put at:\n%s",
+			errPoolDoublePut, v, formatTrackerStack(obj.stack))
+	}
+
+	obj.outstanding = false
+	obj.since = time.Time{}
+	obj.stack = stack
+
+	return nil
+}
+
+// forget stops tracking an object the pool dropped.
+func (p *poolTracker) forget(v interface{}) {
+	key, ok := newTrackedKey(v)
+	if !ok {
+		return
+	}
+
+	p.tracker.Lock()
+	if obj, ok := p.tracker.objects[key]; ok && obj.owner == p.owner {
+		delete(p.tracker.objects, key)
+	}
+	p.tracker.Unlock()
+}
+
+func newTrackedKey(v interface{}) (trackedKey, bool) {
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Chan,
+		reflect.UnsafePointer:
+		ptr := value.Pointer()
+		if ptr == 0 {
+			return trackedKey{}, false
+		}
+		if value.Kind() == reflect.Slice {
+			ptr += uintptr(value.Cap()) * value.Type().Elem().Size()
+		}
+		return trackedKey{typ: value.Type(), ptr: ptr}, true
+	}
+	return trackedKey{}, false
+}
+
+func trackerStack() []uintptr {
+	pc := make([]uintptr, trackerStackMaxDepth)
+	// Skip runtime.Callers, trackerStack and the calling tracker method.
+	n := runtime.Callers(3, pc)
+	return pc[:n]
+}
+
+func formatTrackerStack(pc []uintptr) string {
+	if len(pc) == 0 {
+		return ""
+	}
+
+	buf := bytes.NewBuffer(nil)
+	frames := runtime.CallersFrames(pc)
+	for {
+		frame, more := frames.Next()
+		buf.WriteString(frame.Function)
+		buf.WriteString("(...)\n\t")
+		buf.WriteString(frame.File)
+		buf.WriteString(fmt.Sprintf(":%d\n", frame.Line))
+		if !more {
+			break
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,230 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTrackedPoolOptions(
+	tracker ObjectTracker,
+	errs *[]error,
+) ObjectPoolOptions {
+	return NewObjectPoolOptions().
+		SetSize(2).
+		SetObjectTracker(tracker).
+		SetOnPoolAccessErrorFn(func(err error) {
+			*errs = append(*errs, err)
+		})
+}
+
+func TestObjectTrackerDoublePut(t *testing.T) {
+	for _, poolType := range []ObjectPoolType{
+		ChannelObjectPoolType,
+		ShardedObjectPoolType,
+	} {
+		var errs []error
+		opts := newTestTrackedPoolOptions(NewObjectTracker(), &errs).
+			SetType(poolType)
+
+		pool := NewObjectPool(opts)
+		pool.Init(func() interface{} {
+			return new(int)
+		})
+
+		v := pool.Get()
+		pool.Put(v)
+		require.Empty(t, errs)
+
+		pool.Put(v)
+		require.Equal(t, 1, len(errs))
+		assert.True(t, strings.HasPrefix(errs[0].Error(), errPoolDoublePut.Error()))
+		assert.True(t, strings.Contains(errs[0].Error(), "TestObjectTrackerDoublePut"))
+	}
+}
+
+func TestObjectTrackerForeignPut(t *testing.T) {
+	var (
+		errs    []error
+		tracker = NewObjectTracker()
+		opts    = newTestTrackedPoolOptions(tracker, &errs)
+		alloc   = func() interface{} {
+			return new(int)
+		}
+	)
+
+	a := NewObjectPool(opts)
+	a.Init(alloc)
+	b := NewObjectPool(opts)
+	b.Init(alloc)
+
+	// Object from a different pool sharing the tracker.
+	b.Put(a.Get())
+	require.Equal(t, 1, len(errs))
+	assert.True(t, strings.HasPrefix(errs[0].Error(), errPoolPutForeignObject.Error()))
+
+	// Object that never came from a pool.
+	a.Put(new(int))
+	require.Equal(t, 2, len(errs))
+	assert.True(t, strings.HasPrefix(errs[1].Error(), errPoolPutForeignObject.Error()))
+
+	// Values that are not references cannot be tracked.
+	a.Put(1)
+	require.Equal(t, 2, len(errs))
+}
+
+func TestObjectTrackerOutstanding(t *testing.T) {
+	var (
+		errs    []error
+		now     = time.Now()
+		tracker = newObjectTracker()
+	)
+	tracker.nowFn = func() time.Time {
+		return now
+	}
+
+	pool := NewBucketizedObjectPool([]Bucket{
+		{Capacity: 8, Count: 2},
+		{Capacity: 16, Count: 2},
+	}, newTestTrackedPoolOptions(tracker, &errs))
+	pool.Init(func(capacity int) interface{} {
+		return make([]byte, 0, capacity)
+	})
+
+	getSmall := func() interface{} {
+		return pool.Get(8)
+	}
+	getLarge := func() interface{} {
+		return pool.Get(16)
+	}
+
+	small := []interface{}{getSmall(), getSmall(), getSmall()}
+	now = now.Add(time.Minute)
+	large := getLarge()
+
+	result := tracker.Outstanding(0)
+	require.Equal(t, 2, len(result))
+	assert.Equal(t, 3, result[0].Count)
+	assert.Equal(t, 1, result[1].Count)
+	assert.NotEqual(t, result[0].CallSite, result[1].CallSite)
+	for _, r := range result {
+		assert.True(t, strings.HasPrefix(r.CallSite, "github.com/m3db/m3x/pool.(*objectPool).get"))
+		assert.True(t, strings.Contains(r.CallSite, "TestObjectTrackerOutstanding"))
+	}
+
+	result = tracker.Outstanding(time.Minute)
+	require.Equal(t, 1, len(result))
+	assert.Equal(t, 3, result[0].Count)
+	assert.Equal(t, now.Add(-time.Minute), result[0].OldestSince)
+
+	for _, v := range small {
+		pool.Put(v, 8)
+	}
+	pool.Put(large, 16)
+
+	assert.Empty(t, tracker.Outstanding(0))
+	assert.Empty(t, errs)
+}
+
+func TestObjectTrackerReslicedPut(t *testing.T) {
+	var errs []error
+	pool := NewObjectPool(newTestTrackedPoolOptions(NewObjectTracker(), &errs))
+	pool.Init(func() interface{} {
+		return make([]byte, 0, 8)
+	})
+
+	// Slices of the same backing array are the same object.
+	b := pool.Get().([]byte)[:8]
+	pool.Put(b[1:])
+	require.Empty(t, errs)
+
+	pool.Put(b[:4])
+	require.Equal(t, 1, len(errs))
+	assert.True(t, strings.HasPrefix(errs[0].Error(), errPoolDoublePut.Error()))
+}
+
+func TestObjectTrackerForgetsDroppedObjects(t *testing.T) {
+	var (
+		errs    []error
+		tracker = newObjectTracker()
+	)
+	pool := NewObjectPool(newTestTrackedPoolOptions(tracker, &errs))
+	pool.Init(func() interface{} {
+		return new(int)
+	})
+
+	values := make([]interface{}, 0, 4)
+	for i := 0; i < 4; i++ {
+		values = append(values, pool.Get())
+	}
+	require.Equal(t, 4, len(tracker.objects))
+
+	// Only the objects the pool keeps remain tracked.
+	for _, v := range values {
+		pool.Put(v)
+	}
+	require.Empty(t, errs)
+	assert.Equal(t, 2, len(tracker.objects))
+}
+
+func TestObjectTrackerBucketized(t *testing.T) {
+	var (
+		errs    []error
+		tracker = NewObjectTracker()
+	)
+	pool := NewBucketizedObjectPool([]Bucket{
+		{Capacity: 8, Count: 2},
+		{Capacity: 16, Count: 2},
+	}, newTestTrackedPoolOptions(tracker, &errs))
+	pool.Init(func(capacity int) interface{} {
+		return make([]byte, 0, capacity)
+	})
+
+	// Objects can be put back to a smaller bucket than they came from.
+	small := pool.Get(8)
+	b := pool.Get(16).([]byte)[:16]
+	pool.Put(b[1:], cap(b[1:]))
+	require.Empty(t, errs)
+
+	pool.Put(b, cap(b))
+	require.Equal(t, 1, len(errs))
+	assert.True(t, strings.HasPrefix(errs[0].Error(), errPoolDoublePut.Error()))
+
+	pool.Put(make([]byte, 0, 8), 8)
+	require.Equal(t, 2, len(errs))
+	assert.True(t, strings.HasPrefix(errs[1].Error(), errPoolPutForeignObject.Error()))
+
+	// A separate bucketized pool sharing the tracker does not own them.
+	other := NewBucketizedObjectPool([]Bucket{
+		{Capacity: 8, Count: 2},
+	}, newTestTrackedPoolOptions(tracker, &errs))
+	other.Init(func(capacity int) interface{} {
+		return make([]byte, 0, capacity)
+	})
+	other.Put(small, 8)
+	require.Equal(t, 3, len(errs))
+	assert.True(t, strings.HasPrefix(errs[2].Error(), errPoolPutForeignObject.Error()))
+}
@@ -22,7 +22,12 @@
 package pool
 
 import (
+	"context"
+	"io"
+	"time"
+
 	"github.com/m3db/m3x/checked"
+	"github.com/m3db/m3x/clock"
 	"github.com/m3db/m3x/instrument"
 )
 
@@ -34,18 +39,34 @@ type CheckedAllocator func() checked.ReadWriteRef
 
 // ObjectPool provides a pool for objects.
 type ObjectPool interface {
+	ReadyWaiter
+
 	// Init initializes the pool.
 	Init(alloc Allocator)
 
-	// Get provides an object from the pool.
+	// Get provides an object from the pool, if the pool is bounded and the
+	// max outstanding limit has been reached this blocks until an object is
+	// returned to the pool.
 	Get() interface{}
 
+	// GetContext provides an object from the pool, if the pool is bounded and
+	// the max outstanding limit has been reached this waits until an object is
+	// returned to the pool or the context is done.
+	GetContext(ctx context.Context) (interface{}, error)
+
+	// GetWithTimeout provides an object from the pool, if the pool is bounded
+	// and the max outstanding limit has been reached this waits until an object
+	// is returned to the pool or the timeout elapses.
+	GetWithTimeout(timeout time.Duration) (interface{}, error)
+
 	// Put returns an object to the pool.
 	Put(obj interface{})
 }
 
 // CheckedObjectPool provides a checked pool for objects.
 type CheckedObjectPool interface {
+	ReadyWaiter
+
 	// Init initializes the pool.
 	Init(alloc CheckedAllocator)
 
@@ -57,12 +78,87 @@ type CheckedObjectPool interface {
 	Get() checked.ReadWriteRef
 }
 
+// ObjectPoolType is a type of object pool implementation.
+type ObjectPoolType int
+
+const (
+	// ChannelObjectPoolType is an object pool backed by a single buffered
+	// channel.
+	ChannelObjectPoolType ObjectPoolType = iota
+
+	// ShardedObjectPoolType is an object pool split into shards each with
+	// a local cache of objects, goroutines use the shard of the P they run
+	// on and steal from neighbouring shards when empty to avoid contention
+	// on a single channel. Sharding only pays off with GOMAXPROCS > 1.
+	ShardedObjectPoolType
+
+	// SyncObjectPoolType is an object pool backed by a sync.Pool which the
+	// GC may empty at any time. The pool has no size, nothing is allocated
+	// on Init since it would not survive the next GC, and size, init
+	// fraction, watermarks, adaptive sizing and object tracking do not
+	// apply. Only the get on empty and max outstanding metrics are reported,
+	// the free and total gauges and the put on full counter are not since a
+	// sync.Pool can neither tell how many objects it holds nor be full.
+	SyncObjectPoolType
+
+	// DefaultObjectPoolType is the default object pool type.
+	DefaultObjectPoolType = ChannelObjectPoolType
+)
+
+func (t ObjectPoolType) String() string {
+	switch t {
+	case ChannelObjectPoolType:
+		return "channel"
+	case ShardedObjectPoolType:
+		return "sharded"
+	case SyncObjectPoolType:
+		return "syncpool"
+	}
+	return "unknown"
+}
+
 // OnPoolAccessErrorFn is a function to call when a pool access error occurs,
 // such as get or put before the pool is initialized.
 type OnPoolAccessErrorFn func(err error)
 
 // ObjectPoolOptions provides options for an object pool.
 type ObjectPoolOptions interface {
+	// SetName sets the name the pool is registered under in the pool
+	// registry, if empty the pool is not registered. A name already in use
+	// is suffixed with a number, e.g. name-2, unless the pool replaces the
+	// pool registered under the name. The registry keeps registered pools
+	// reachable until they are unregistered or replaced.
+	SetName(value string) ObjectPoolOptions
+
+	// Name returns the name the pool is registered under in the pool
+	// registry, if empty the pool is not registered.
+	Name() string
+
+	// SetReplaceRegistered sets whether the pool replaces the pool already
+	// registered under its name instead of being registered under a new
+	// name, which lets pools created again under the same name, e.g. on
+	// reload, release the pools they replace.
+	SetReplaceRegistered(value bool) ObjectPoolOptions
+
+	// ReplaceRegistered returns whether the pool replaces the pool already
+	// registered under its name instead of being registered under a new
+	// name.
+	ReplaceRegistered() bool
+
+	// SetType sets the type of the object pool implementation.
+	SetType(value ObjectPoolType) ObjectPoolOptions
+
+	// Type returns the type of the object pool implementation.
+	Type() ObjectPoolType
+
+	// SetShards sets the number of shards for a sharded object pool, if zero
+	// or less then the shards are set to the value of GOMAXPROCS.
+	SetShards(value int) ObjectPoolOptions
+
+	// Shards returns the number of shards for a sharded object pool, if zero
+	// or less then the shards are set to the value of GOMAXPROCS.
+	Shards() int
+
 	// SetSize sets the size of the object pool.
 	SetSize(value int) ObjectPoolOptions
 
@@ -85,6 +181,37 @@ type ObjectPoolOptions interface {
 	// if less or equal to low watermark then no refills occur.
 	RefillHighWatermark() float64
 
+	// SetMaxOutstanding sets the max number of objects that can be held
+	// outside of the pool at once, if zero or less the pool is unbounded.
+	// When bounded, gets past the limit wait for an object to be put back
+	// instead of allocating a new one.
+	SetMaxOutstanding(value int) ObjectPoolOptions
+
+	// MaxOutstanding returns the max number of objects that can be held
+	// outside of the pool at once, if zero or less the pool is unbounded.
+	MaxOutstanding() int
+
+	// SetAdaptiveSizeOptions sets the adaptive size options, if nil the
+	// pool size is fixed. Only supported by channel object pools, other
+	// pool types report an error when constructed.
+	SetAdaptiveSizeOptions(value AdaptiveSizeOptions) ObjectPoolOptions
+
+	// AdaptiveSizeOptions returns the adaptive size options, if nil the
+	// pool size is fixed. Only supported by channel object pools.
+	AdaptiveSizeOptions() AdaptiveSizeOptions
+
+	// SetObjectTracker sets the object tracker used to record outstanding
+	// objects and detect double puts and puts of foreign objects, which are
+	// reported to the on pool access error callback. If nil no tracking is
+	// performed, tracking is expensive and meant for debugging only.
+	SetObjectTracker(value ObjectTracker) ObjectPoolOptions
+
+	// ObjectTracker returns the object tracker used to record outstanding
+	// objects and detect double puts and puts of foreign objects, which are
+	// reported to the on pool access error callback. If nil no tracking is
+	// performed, tracking is expensive and meant for debugging only.
+	ObjectTracker() ObjectTracker
+
 	// SetInstrumentOptions sets the instrument options.
 	SetInstrumentOptions(value instrument.Options) ObjectPoolOptions
 
@@ -98,6 +225,114 @@ type ObjectPoolOptions interface {
 	// OnPoolAccessErrorFn returns the on pool access error callback, by
 	// default this is a panic.
 	OnPoolAccessErrorFn() OnPoolAccessErrorFn
+
+	// SetMemoryBudget sets the memory budget the pool charges the objects it
+	// retains against, if nil the pool is not limited by a budget. Pools
+	// backed by a sync.Pool do not support memory budgets.
+	SetMemoryBudget(value MemoryBudget) ObjectPoolOptions
+
+	// MemoryBudget returns the memory budget the pool charges the objects it
+	// retains against, if nil the pool is not limited by a budget.
+	MemoryBudget() MemoryBudget
+
+	// SetObjectSizeFn sets the function returning the bytes retained by an
+	// object charged against the memory budget, if nil the size of the
+	// backing array of a slice or of a value is used. The memory a pointer,
+	// map or channel references cannot be known so pools of such objects
+	// require a size fn, pools without one report it to the pool access
+	// error callback once on Init and drop the objects instead of retaining
+	// them.
+	SetObjectSizeFn(value ObjectSizeFn) ObjectPoolOptions
+
+	// ObjectSizeFn returns the function returning the bytes retained by an
+	// object charged against the memory budget.
+	ObjectSizeFn() ObjectSizeFn
+
+	// SetInitFraction sets the fraction of the pool between [0, 1] allocated
+	// synchronously on Init, the rest is allocated in the background. If one
+	// then Init allocates the whole pool.
+	SetInitFraction(value float64) ObjectPoolOptions
+
+	// InitFraction returns the fraction of the pool between [0, 1] allocated
+	// synchronously on Init, the rest is allocated in the background. If one
+	// then Init allocates the whole pool.
+	InitFraction() float64
+
+	// SetOverflowCacheBytes sets the max bytes of objects larger than the
+	// largest bucket retained by bucketized pools, the objects of the largest
+	// capacity are evicted first and least recently put first among them.
+	// Gets only take objects of up to twice the capacity requested. If zero
+	// such objects are dropped on put. It is ignored by other pools.
+	SetOverflowCacheBytes(value int64) ObjectPoolOptions
+
+	// OverflowCacheBytes returns the max bytes of objects larger than the
+	// largest bucket retained by bucketized pools.
+	OverflowCacheBytes() int64
+
+	// SetCapacityProfiler sets the capacity profiler recording the gets and
+	// puts of bucketized pools, if nil the pool is not profiled. It is
+	// ignored by other pools.
+	SetCapacityProfiler(value CapacityProfiler) ObjectPoolOptions
+
+	// CapacityProfiler returns the capacity profiler recording the gets and
+	// puts of bucketized pools, if nil the pool is not profiled.
+	CapacityProfiler() CapacityProfiler
+}
+
+// ReadyWaiter waits for a pool to be fully allocated after Init, pools
+// created by this package all implement ReadyWaiter.
+type ReadyWaiter interface {
+	// WaitReady blocks until the pool is fully allocated or the context is
+	// done, in which case the context error is returned.
+	WaitReady(ctx context.Context) error
+}
+
+// AdaptiveSizeOptions provides options for adaptively sizing an object pool
+// based on the observed get on empty and put on full rates.
+type AdaptiveSizeOptions interface {
+	// SetMinSize sets the minimum size the pool can shrink to, if zero
+	// then the pool will not shrink below its initial size.
+	SetMinSize(value int) AdaptiveSizeOptions
+
+	// MinSize returns the minimum size the pool can shrink to, if zero
+	// then the pool will not shrink below its initial size.
+	MinSize() int
+
+	// SetMaxSize sets the maximum size the pool can grow to, if zero
+	// then the pool will not grow above its initial size.
+	SetMaxSize(value int) AdaptiveSizeOptions
+
+	// MaxSize returns the maximum size the pool can grow to, if zero
+	// then the pool will not grow above its initial size.
+	MaxSize() int
+
+	// SetWindow sets the sliding window over which rates are observed.
+	SetWindow(value time.Duration) AdaptiveSizeOptions
+
+	// Window returns the sliding window over which rates are observed.
+	Window() time.Duration
+
+	// SetGrowThreshold sets the get on empty or put on full rate over the
+	// window, as a fraction of gets or puts, above which the pool grows.
+	SetGrowThreshold(value float64) AdaptiveSizeOptions
+
+	// GrowThreshold returns the get on empty or put on full rate over the
+	// window, as a fraction of gets or puts, above which the pool grows.
+	GrowThreshold() float64
+
+	// SetStepFactor sets the max fraction of the current size the pool
+	// grows or shrinks by on each resize.
+	SetStepFactor(value float64) AdaptiveSizeOptions
+
+	// StepFactor returns the max fraction of the current size the pool
+	// grows or shrinks by on each resize.
+	StepFactor() float64
+
+	// SetNowFn sets the function used to determine the current time.
+	SetNowFn(value clock.NowFn) AdaptiveSizeOptions
+
+	// NowFn returns the function used to determine the current time.
+	NowFn() clock.NowFn
 }
 
 // Bucket specifies a pool bucket.
@@ -107,6 +342,14 @@ type Bucket struct {
 
 	// Count is the number of fixed elements in the bucket.
 	Count int
+
+	// MinCount is the minimum number of elements in the bucket when
+	// adaptively sized, if zero the adaptive size options min size is used.
+	MinCount int
+
+	// MaxCount is the maximum number of elements in the bucket when
+	// adaptively sized, if zero the adaptive size options max size is used.
+	MaxCount int
 }
 
 // BucketByCapacity is a sortable collection of pool buckets.
@@ -127,8 +370,20 @@ func (x BucketByCapacity) Less(i, j int) bool {
 // BucketizedAllocator allocates an object for a bucket given its capacity.
 type BucketizedAllocator func(capacity int) interface{}
 
+// BucketsUpdater updates the bucket layout of a pool at runtime, objects
+// already checked out remain valid and are returned to the buckets of the
+// new layout they can serve, or dropped if there are none.
+type BucketsUpdater interface {
+	// UpdateBuckets updates the buckets, adding new buckets, replacing
+	// resized buckets and draining removed buckets.
+	UpdateBuckets(sizes []Bucket)
+}
+
 // BucketizedObjectPool is a bucketized pool of objects.
 type BucketizedObjectPool interface {
+	BucketsUpdater
+	ReadyWaiter
+
 	// Init initializes the pool.
 	Init(alloc BucketizedAllocator)
 
@@ -139,7 +394,23 @@ type BucketizedObjectPool interface {
 	Put(obj interface{}, capacity int)
 }
 
-// BytesPool provides a pool for variable size buffers.
+// CapacityProfiler records the capacities requested from bucketized pools
+// and how many objects are checked out at once, to recommend a bucket
+// configuration for the observed workload.
+type CapacityProfiler interface {
+	// Profile returns a snapshot of the usage recorded so far.
+	Profile() CapacityProfile
+
+	// Recommend returns a configuration with buckets sized for the usage
+	// recorded so far, capacities are rounded up to powers of two.
+	Recommend() BucketizedPoolConfiguration
+
+	// Reset clears the usage recorded so far.
+	Reset()
+}
+
+// BytesPool provides a pool for variable size buffers, pools created by
+// NewBytesPool also implement BucketsUpdater and ReadyWaiter.
 type BytesPool interface {
 	// Init initializes the pool.
 	Init()
@@ -151,7 +422,19 @@ type BytesPool interface {
 	Put(buffer []byte)
 }
 
-// CheckedBytesPool provides a checked pool for variable size buffers.
+// NativeHeap is a BytesPool backed by native pools which may release idle
+// arenas in the background.
+type NativeHeap interface {
+	BytesPool
+
+	// Close stops releasing idle arenas in the background, the heap may
+	// still be used after closing.
+	Close() error
+}
+
+// CheckedBytesPool provides a checked pool for variable size buffers, pools
+// created by NewCheckedBytesPool also implement BucketsUpdater and
+// ReadyWaiter.
 type CheckedBytesPool interface {
 	// Init initializes the pool.
 	Init()
@@ -164,6 +447,171 @@ type CheckedBytesPool interface {
 	Get(capacity int) checked.Bytes
 }
 
+// Int64sPool provides a pool for variable size int64 slices.
+type Int64sPool interface {
+	// Init initializes the pool.
+	Init()
+
+	// Get provides an int64 slice from the pool.
+	Get(capacity int) []int64
+
+	// Put returns an int64 slice to the pool.
+	Put(value []int64)
+}
+
+// Uint64sPool provides a pool for variable size uint64 slices.
+type Uint64sPool interface {
+	// Init initializes the pool.
+	Init()
+
+	// Get provides a uint64 slice from the pool.
+	Get(capacity int) []uint64
+
+	// Put returns a uint64 slice to the pool.
+	Put(value []uint64)
+}
+
+// IntsPool provides a pool for variable size int slices.
+type IntsPool interface {
+	// Init initializes the pool.
+	Init()
+
+	// Get provides an int slice from the pool.
+	Get(capacity int) []int
+
+	// Put returns an int slice to the pool.
+	Put(value []int)
+}
+
+// StringsPool provides a pool for variable size string slices.
+type StringsPool interface {
+	// Init initializes the pool.
+	Init()
+
+	// Get provides a string slice from the pool.
+	Get(capacity int) []string
+
+	// Put returns a string slice to the pool.
+	Put(value []string)
+}
+
+// TimesPool provides a pool for variable size time.Time slices.
+type TimesPool interface {
+	// Init initializes the pool.
+	Init()
+
+	// Get provides an time.Time slice from the pool.
+	Get(capacity int) []time.Time
+
+	// Put returns an time.Time slice to the pool.
+	Put(value []time.Time)
+}
+
+// CheckedInt64sPool provides a checked pool for variable size int64 slices.
+type CheckedInt64sPool interface {
+	// Init initializes the pool.
+	Init()
+
+	// Get provides a checked int64 slice from the pool, it is returned to
+	// the pool in the same way as a checked.Bytes from a CheckedBytesPool.
+	// The pool uses the finalizer of the slice so be sure not to override it.
+	Get(capacity int) checked.Int64s
+}
+
+// CheckedUint64sPool provides a checked pool for variable size uint64 slices.
+type CheckedUint64sPool interface {
+	// Init initializes the pool.
+	Init()
+
+	// Get provides a checked uint64 slice from the pool, it is returned to
+	// the pool in the same way as a checked.Bytes from a CheckedBytesPool.
+	// The pool uses the finalizer of the slice so be sure not to override it.
+	Get(capacity int) checked.Uint64s
+}
+
+// CheckedIntsPool provides a checked pool for variable size int slices.
+type CheckedIntsPool interface {
+	// Init initializes the pool.
+	Init()
+
+	// Get provides a checked int slice from the pool, it is returned to
+	// the pool in the same way as a checked.Bytes from a CheckedBytesPool.
+	// The pool uses the finalizer of the slice so be sure not to override it.
+	Get(capacity int) checked.Ints
+}
+
+// CheckedStringsPool provides a checked pool for variable size string slices.
+type CheckedStringsPool interface {
+	// Init initializes the pool.
+	Init()
+
+	// Get provides a checked string slice from the pool, it is returned to
+	// the pool in the same way as a checked.Bytes from a CheckedBytesPool.
+	// The pool uses the finalizer of the slice so be sure not to override it.
+	Get(capacity int) checked.Strings
+}
+
+// CheckedTimesPool provides a checked pool for variable size time.Time slices.
+type CheckedTimesPool interface {
+	// Init initializes the pool.
+	Init()
+
+	// Get provides a checked time.Time slice from the pool, it is returned to
+	// the pool in the same way as a checked.Bytes from a CheckedBytesPool.
+	// The pool uses the finalizer of the slice so be sure not to override it.
+	Get(capacity int) checked.Times
+}
+
+// Buffer is a variable size buffer of bytes made of a chain of segments
+// borrowed from a bytes pool, so that growing it never copies the bytes
+// already written. A Buffer is not safe for concurrent use.
+type Buffer interface {
+	io.Writer
+	io.Reader
+	io.WriterTo
+	io.ByteWriter
+
+	// Len returns the number of unread bytes.
+	Len() int
+
+	// Bytes returns the unread bytes, the result aliases the buffer and is
+	// only valid until the next modification. Unread bytes held in several
+	// segments are first moved into a single segment taken from the pool,
+	// so they are only copied once for repeated calls.
+	Bytes() []byte
+
+	// Reset empties the buffer returning all but the first segment to the
+	// pool.
+	Reset()
+
+	// Close empties the buffer returning all segments to the pool, the
+	// buffer may still be written to after closing.
+	Close() error
+}
+
+// Arena is a region allocator for short-lived slices which all die together,
+// slices are carved from chunks with a bump pointer and are all released at
+// once by Reset or Close, after which none of them may be used. An Arena is
+// not safe for concurrent use.
+type Arena interface {
+	// Bytes returns an empty byte slice with the given capacity.
+	Bytes(capacity int) []byte
+
+	// Floats returns an empty float64 slice with the given capacity.
+	Floats(capacity int) []float64
+
+	// Allocated returns the number of bytes handed out since the last reset.
+	Allocated() int
+
+	// Reset releases all slices handed out, the chunks are kept to serve
+	// later allocations.
+	Reset()
+
+	// Close releases all slices handed out and returns the chunks, the
+	// arena may still be used after closing.
+	Close() error
+}
+
 // FloatsPool provides a pool for variable-sized float64 slices.
 type FloatsPool interface {
 	// Init initializes the pool.
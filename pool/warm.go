@@ -0,0 +1,135 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	xlog "github.com/m3db/m3x/log"
+
+	"github.com/uber-go/tally"
+)
+
+const (
+	// Number of times the progress is reported while warming.
+	warmProgressSteps = 10
+)
+
+// warmer allocates the initial fraction of a pool on Init and the rest in
+// the background, reporting its progress and signalling once done.
+type warmer struct {
+	fraction float64
+	ready    chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+	progress tally.Gauge
+	logger   xlog.Logger
+}
+
+func newWarmer(opts ObjectPoolOptions) *warmer {
+	iopts := opts.InstrumentOptions()
+	return &warmer{
+		fraction: math.Max(0, math.Min(1, opts.InitFraction())),
+		ready:    make(chan struct{}),
+		stopped:  make(chan struct{}),
+		progress: iopts.MetricsScope().Gauge("warm-progress"),
+		logger:   iopts.Logger(),
+	}
+}
+
+// warm allocates size objects with fill, the initial fraction is allocated
+// before returning and the rest in the background. Fill returns false once
+// the pool has no room left, which ends warming early.
+func (w *warmer) warm(size int, fill func() bool) {
+	initial := int(math.Ceil(w.fraction * float64(size)))
+	for i := 0; i < initial; i++ {
+		if !fill() {
+			initial = size
+			break
+		}
+	}
+
+	if initial >= size {
+		w.done()
+		return
+	}
+
+	w.progress.Update(float64(initial) / float64(size))
+
+	go func() {
+		start := time.Now()
+		step := size / warmProgressSteps
+		if step == 0 {
+			step = 1
+		}
+
+		for i := initial; i < size; i++ {
+			select {
+			case <-w.stopped:
+				w.logger.Infof("object pool warming stopped, size=%d, warmed=%d",
+					size, i)
+				w.done()
+				return
+			default:
+			}
+			if !fill() {
+				break
+			}
+			if (i+1)%step == 0 {
+				w.progress.Update(float64(i+1) / float64(size))
+			}
+		}
+
+		w.logger.Infof("object pool warmed in the background in %v, size=%d",
+			time.Since(start), size)
+		w.done()
+	}()
+}
+
+// stop stops warming in the background, used when a pool is dropped.
+func (w *warmer) stop() {
+	w.stopOnce.Do(func() {
+		close(w.stopped)
+	})
+}
+
+func (w *warmer) done() {
+	w.progress.Update(1)
+	close(w.ready)
+}
+
+func (w *warmer) WaitReady(ctx context.Context) error {
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// backgroundStopper is implemented by pools that can stop warming and any
+// other work in the background once they are no longer used.
+type backgroundStopper interface {
+	stopBackground()
+}
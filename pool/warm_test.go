@@ -0,0 +1,119 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pool
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/m3db/m3x/instrument"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestObjectPoolWarmInBackground(t *testing.T) {
+	types := []ObjectPoolType{
+		ChannelObjectPoolType,
+		ShardedObjectPoolType,
+	}
+
+	for _, typ := range types {
+		scope := tally.NewTestScope("", nil)
+		opts := NewObjectPoolOptions().
+			SetType(typ).
+			SetSize(100).
+			SetInitFraction(0.25).
+			SetInstrumentOptions(instrument.NewOptions().SetMetricsScope(scope))
+
+		var (
+			allocs  int64
+			release = make(chan struct{})
+		)
+		pool := NewObjectPool(opts)
+		pool.Init(func() interface{} {
+			if atomic.AddInt64(&allocs, 1) > 25 {
+				<-release
+			}
+			return new(int)
+		})
+
+		// Only the initial fraction is allocated on init.
+		require.Equal(t, int64(25), atomic.LoadInt64(&allocs), typ.String())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		require.Equal(t, context.DeadlineExceeded, pool.WaitReady(ctx), typ.String())
+		cancel()
+
+		close(release)
+		require.NoError(t, pool.WaitReady(context.Background()), typ.String())
+		require.Equal(t, int64(100), atomic.LoadInt64(&allocs), typ.String())
+
+		progress, ok := scope.Snapshot().Gauges()["warm-progress+"]
+		require.True(t, ok, typ.String())
+		assert.Equal(t, 1.0, progress.Value(), typ.String())
+
+		stats := pool.(statsReporter).stats()
+		assert.Equal(t, 100, stats.Free, typ.String())
+	}
+}
+
+func TestObjectPoolWarmSynchronousByDefault(t *testing.T) {
+	pool := NewObjectPool(NewObjectPoolOptions().SetSize(10))
+	pool.Init(func() interface{} { return new(int) })
+
+	// Ready as soon as init returns.
+	select {
+	case <-pool.(*objectPool).warmer.ready:
+	default:
+		require.FailNow(t, "pool not ready after init")
+	}
+	assert.Equal(t, 10, len(pool.(*objectPool).values))
+}
+
+func TestBytesPoolWaitReady(t *testing.T) {
+	fraction := 0.0
+	cfg := BucketizedPoolConfiguration{
+		Buckets: []BucketConfiguration{
+			{Count: 10, Capacity: 8},
+			{Count: 10, Capacity: 16},
+		},
+		InitFraction: &fraction,
+	}
+
+	pool, err := cfg.NewBytesPool(instrument.NewOptions())
+	require.NoError(t, err)
+	pool.Init()
+
+	waiter, ok := pool.(ReadyWaiter)
+	require.True(t, ok)
+	require.NoError(t, waiter.WaitReady(context.Background()))
+
+	stats := pool.(*bytesPool).pool.(statsReporter).stats()
+	assert.Equal(t, 20, stats.Free)
+
+	fraction = 2
+	_, err = cfg.NewBytesPool(instrument.NewOptions())
+	require.Equal(t, errInvalidInitFraction, err)
+}
@@ -32,7 +32,9 @@ const (
 	pprofPath = "/debug/pprof/"
 )
 
-// RegisterHandler registers the pprof handler with the given http mux.
+// RegisterHandler registers the pprof handler with the given http mux, all
+// runtime/pprof profiles are served including custom profiles such as the
+// checked ref census.
 func RegisterHandler(mux *http.ServeMux) {
 	mux.Handle(pprofPath, handler())
 }
@@ -21,10 +21,14 @@
 package pprof
 
 import (
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/m3db/m3x/checked"
+
 	"github.com/stretchr/testify/require"
 )
 
@@ -46,3 +50,33 @@ func TestHandler(t *testing.T) {
 		require.Equal(t, http.StatusOK, resp.StatusCode)
 	}
 }
+
+func TestHandlerRefCensus(t *testing.T) {
+	checked.EnableRefCensus()
+	defer checked.DisableRefCensus()
+
+	b := checked.NewBytes(nil, nil)
+	b.IncRef()
+	defer b.DecRef()
+
+	s := httptest.NewServer(handler())
+	defer s.Close()
+
+	resp, err := http.Get(s.URL + pprofPath + checked.RefCensusProfileName + "?debug=1")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.True(t, strings.Contains(string(body), "checked.refs profile: total 1"))
+	require.True(t, strings.Contains(string(body), "pprof.TestHandlerRefCensus"))
+
+	// The census is listed by the index like the runtime/pprof profiles.
+	resp, err = http.Get(s.URL + pprofPath)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err = ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.True(t, strings.Contains(string(body), checked.RefCensusProfileName))
+}